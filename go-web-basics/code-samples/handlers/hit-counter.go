@@ -1,17 +1,35 @@
 package main
 
 import (
+	"flag"
 	"fmt"
 	"log"
 	"net/http"
+	"time"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
-type Counter int
+//A Counter counts hits to the app, keeping the count in a Store so the
+//count stays correct when requests come in on different goroutines.
+type Counter struct {
+	store Store
+}
+
+//NewCounter makes a Counter that keeps its hit count in store
+func NewCounter(store Store) *Counter {
+	return &Counter{store: store}
+}
 
 //This method makes a Counter satisfy the Handler interface
 func (h *Counter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
-	*h++
-	fmt.Fprintf(w, "This app's hit count: %d", *h)
+	hits, err := h.store.Incr()
+	if err != nil {
+		log.Println("Counting hit: " + err.Error())
+		http.Error(w, "500 Internal Server Error", 500)
+		return
+	}
+	fmt.Fprintf(w, "This app's hit count: %d", hits)
 }
 
 //A handler function for the /sloths route
@@ -20,27 +38,54 @@ func slothsRule(w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	//Initialize our counter
-	counter := Counter(0)
+	//This sample has a flag of its own, so register the server's
+	//config flags before parsing the command line
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	dataDir := flag.String("data", "",
+		"directory to keep the hit count in; counts are kept in memory if empty")
+	flag.Parse()
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	//Initialize our counter's store
+	var store Store = NewMemoryStore()
+	if *dataDir != "" {
+		fileStore, err := OpenFileStore(*dataDir, DefaultSnapshotInterval)
+		if err != nil {
+			log.Fatal(err)
+		}
+		store = fileStore
+	}
+	defer store.Close()
 
 	mux := http.NewServeMux()
 	//Use the counter as a Handler
-	mux.Handle("/", &counter)
+	mux.Handle("/", NewCounter(store))
 
 	//Use http.HandlerFunc to convert slothsRule to a Handler
 	slothsRuleHandler := http.HandlerFunc(slothsRule)
 	mux.Handle("/sloths", slothsRuleHandler)
 
-	//Logs what URL the request is to and then sends the request to mux
-	//by calling its ServeHTTP method.
+	//Serve per-path, per-method and per-client hit counts as JSON,
+	//keeping a day of history for time window queries
+	stats := NewStats(24 * time.Hour)
+	mux.Handle("/stats", stats)
+
+	//Logs what URL the request is to, records it in our stats, and then
+	//sends the request to mux by calling its ServeHTTP method.
 	logAndServe := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		log.Println("Request to " + r.URL.String())
+		stats.Record(r)
 		mux.ServeHTTP(w, r)
 	})
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: logAndServe,
+	if err := config.Runner(logAndServe).Run(); err != nil {
+		//log.Fatal exits without running deferred calls, so close the
+		//store first to save the last hits
+		store.Close()
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
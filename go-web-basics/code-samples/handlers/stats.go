@@ -0,0 +1,248 @@
+package main
+
+import (
+	"encoding/json"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+)
+
+//statsResolution is how finely Stats splits hits up by time, so window
+//queries are accurate to about a minute.
+const statsResolution = time.Minute
+
+//DefaultTopN is how many entries each breakdown has in a stats report if
+//the request doesn't ask for a different number.
+const DefaultTopN = 10
+
+//MaxStatsKeys is how many distinct paths, methods or client IPs each
+//breakdown keeps. Hits for any more are counted under OtherKey, so a
+//scanner requesting random paths can't grow the breakdowns forever.
+const MaxStatsKeys = 1000
+
+//OtherKey is the breakdown entry hits past MaxStatsKeys are counted under
+const OtherKey = "(other)"
+
+//hitCounts is a breakdown of hits by path, method and client IP
+type hitCounts struct {
+	total   int64
+	paths   map[string]int64
+	methods map[string]int64
+	clients map[string]int64
+}
+
+func newHitCounts() *hitCounts {
+	return &hitCounts{
+		paths:   make(map[string]int64),
+		methods: make(map[string]int64),
+		clients: make(map[string]int64),
+	}
+}
+
+func (c *hitCounts) add(path, method, client string, n int64) {
+	c.total += n
+	addCapped(c.paths, path, n)
+	addCapped(c.methods, method, n)
+	addCapped(c.clients, client, n)
+}
+
+func (c *hitCounts) merge(other *hitCounts) {
+	c.total += other.total
+	for k, n := range other.paths {
+		addCapped(c.paths, k, n)
+	}
+	for k, n := range other.methods {
+		addCapped(c.methods, k, n)
+	}
+	for k, n := range other.clients {
+		addCapped(c.clients, k, n)
+	}
+}
+
+//addCapped adds n hits to key, or to OtherKey if counts already has
+//MaxStatsKeys other keys and key isn't one of them
+func addCapped(counts map[string]int64, key string, n int64) {
+	if _, ok := counts[key]; !ok && key != OtherKey {
+		keys := len(counts)
+		if _, ok := counts[OtherKey]; ok {
+			keys--
+		}
+		if keys >= MaxStatsKeys {
+			key = OtherKey
+		}
+	}
+	counts[key] += n
+}
+
+//A statsBucket holds the hits from one statsResolution-long slice of time
+type statsBucket struct {
+	start  time.Time
+	counts *hitCounts
+}
+
+//Stats keeps hit counts broken down by URL path, HTTP method and client IP,
+//both for all time and for recent time windows, and serves them as JSON.
+type Stats struct {
+	retention time.Duration
+	now       func() time.Time
+
+	mu      sync.Mutex
+	allTime *hitCounts
+	buckets []statsBucket //oldest first
+}
+
+//NewStats makes a Stats that can answer time window queries going back
+//as far as retention.
+func NewStats(retention time.Duration) *Stats {
+	return &Stats{
+		retention: retention,
+		now:       time.Now,
+		allTime:   newHitCounts(),
+	}
+}
+
+//Record counts r towards its path, method and client IP
+func (s *Stats) Record(r *http.Request) {
+	path, method, client := r.URL.Path, r.Method, clientIP(r)
+	if method == "" {
+		method = "GET"
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	now := s.now()
+	s.allTime.add(path, method, client, 1)
+	s.currentBucket(now).add(path, method, client, 1)
+	s.expire(now)
+}
+
+//currentBucket returns the bucket for now, adding it if it's a new one;
+//s.mu must be held.
+func (s *Stats) currentBucket(now time.Time) *hitCounts {
+	start := now.Truncate(statsResolution)
+	if n := len(s.buckets); n > 0 && !s.buckets[n-1].start.Before(start) {
+		return s.buckets[n-1].counts
+	}
+	s.buckets = append(s.buckets, statsBucket{start: start, counts: newHitCounts()})
+	return s.buckets[len(s.buckets)-1].counts
+}
+
+//expire drops buckets older than the retention period; s.mu must be held.
+func (s *Stats) expire(now time.Time) {
+	cutoff := now.Add(-s.retention)
+	i := 0
+	for i < len(s.buckets) && !s.buckets[i].start.Add(statsResolution).After(cutoff) {
+		i++
+	}
+	s.buckets = s.buckets[i:]
+}
+
+//A HitCount is one entry in a stats report breakdown
+type HitCount struct {
+	Key  string `json:"key"`
+	Hits int64  `json:"hits"`
+}
+
+//A StatsReport is the JSON served on the /stats route
+type StatsReport struct {
+	Total   int64      `json:"total"`
+	Window  string     `json:"window,omitempty"`
+	Paths   []HitCount `json:"paths"`
+	Methods []HitCount `json:"methods"`
+	Clients []HitCount `json:"clients"`
+}
+
+//Report returns the top hits in each breakdown. A window of 0 reports
+//hits for all time, otherwise only hits within the window are reported.
+//A top of 0 or less reports every entry.
+func (s *Stats) Report(window time.Duration, top int) StatsReport {
+	s.mu.Lock()
+	counts := newHitCounts()
+	if window <= 0 {
+		counts.merge(s.allTime)
+	} else {
+		cutoff := s.now().Add(-window)
+		for _, b := range s.buckets {
+			if b.start.Add(statsResolution).After(cutoff) {
+				counts.merge(b.counts)
+			}
+		}
+	}
+	s.mu.Unlock()
+
+	report := StatsReport{
+		Total:   counts.total,
+		Paths:   topHits(counts.paths, top),
+		Methods: topHits(counts.methods, top),
+		Clients: topHits(counts.clients, top),
+	}
+	if window > 0 {
+		report.Window = window.String()
+	}
+	return report
+}
+
+//This method makes Stats a Handler serving its report as JSON. The top and
+//window query parameters pick how many entries to show and how far back to
+//look, like /stats?top=5&window=15m
+func (s *Stats) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	top := DefaultTopN
+	if v := query.Get("top"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "400 Bad Request: top must be a non-negative integer", 400)
+			return
+		}
+		top = n
+	}
+
+	var window time.Duration
+	if v := query.Get("window"); v != "" {
+		d, err := time.ParseDuration(v)
+		if err != nil || d <= 0 {
+			http.Error(w, "400 Bad Request: window must be a positive duration like 15m", 400)
+			return
+		}
+		if d > s.retention {
+			http.Error(w, "400 Bad Request: window can be at most "+s.retention.String(), 400)
+			return
+		}
+		window = d
+	}
+
+	w.Header().Set("Content-Type", "application/json")
+	json.NewEncoder(w).Encode(s.Report(window, top))
+}
+
+//topHits sorts counts from most to fewest hits, breaking ties by key, and
+//returns the first top of them.
+func topHits(counts map[string]int64, top int) []HitCount {
+	hits := make([]HitCount, 0, len(counts))
+	for k, n := range counts {
+		hits = append(hits, HitCount{Key: k, Hits: n})
+	}
+	sort.Slice(hits, func(i, j int) bool {
+		if hits[i].Hits != hits[j].Hits {
+			return hits[i].Hits > hits[j].Hits
+		}
+		return hits[i].Key < hits[j].Key
+	})
+	if top > 0 && len(hits) > top {
+		hits = hits[:top]
+	}
+	return hits
+}
+
+//clientIP is the IP address part of r.RemoteAddr
+func clientIP(r *http.Request) string {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
@@ -0,0 +1,156 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+)
+
+//fakeClock lets tests move Stats through time
+type fakeClock struct{ t time.Time }
+
+func (c *fakeClock) now() time.Time { return c.t }
+
+func newTestStats() (*Stats, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2015, 6, 1, 12, 0, 0, 0, time.UTC)}
+	s := NewStats(time.Hour)
+	s.now = clock.now
+	return s, clock
+}
+
+func record(s *Stats, method, path, remoteAddr string) {
+	r, _ := http.NewRequest(method, path, nil)
+	r.RemoteAddr = remoteAddr
+	s.Record(r)
+}
+
+func getReport(t *testing.T, s *Stats, query string) StatsReport {
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/stats"+query, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.ServeHTTP(w, r)
+
+	if w.Code != 200 {
+		t.Fatalf("Response status code expected 200, got %d: %s", w.Code, w.Body)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type expected application/json, got %s", ct)
+	}
+	var report StatsReport
+	if err := json.Unmarshal(w.Body.Bytes(), &report); err != nil {
+		t.Fatal(err)
+	}
+	return report
+}
+
+func TestStatsBreakdown(t *testing.T) {
+	s, _ := newTestStats()
+	record(s, "GET", "/sloths", "10.0.0.1:5000")
+	record(s, "GET", "/sloths", "10.0.0.2:5000")
+	record(s, "POST", "/sloths", "10.0.0.1:5001")
+	record(s, "GET", "/", "[::1]:5000")
+
+	report := getReport(t, s, "")
+	expected := StatsReport{
+		Total:   4,
+		Paths:   []HitCount{{"/sloths", 3}, {"/", 1}},
+		Methods: []HitCount{{"GET", 3}, {"POST", 1}},
+		Clients: []HitCount{{"10.0.0.1", 2}, {"10.0.0.2", 1}, {"::1", 1}},
+	}
+	if !reflect.DeepEqual(report, expected) {
+		t.Fatalf("Report expected %+v, got %+v", expected, report)
+	}
+}
+
+func TestStatsTopN(t *testing.T) {
+	s, _ := newTestStats()
+	for _, path := range []string{"/a", "/b", "/b", "/c", "/c", "/c"} {
+		record(s, "GET", path, "10.0.0.1:5000")
+	}
+
+	report := getReport(t, s, "?top=2")
+	expected := []HitCount{{"/c", 3}, {"/b", 2}}
+	if !reflect.DeepEqual(report.Paths, expected) {
+		t.Fatalf("Paths expected %v, got %v", expected, report.Paths)
+	}
+	if report.Total != 6 {
+		t.Fatalf("Total expected 6, got %d", report.Total)
+	}
+}
+
+func TestStatsKeyCap(t *testing.T) {
+	s, clock := newTestStats()
+	for i := 0; i < MaxStatsKeys+50; i++ {
+		record(s, "GET", fmt.Sprintf("/scan/%d", i), "10.0.0.1:5000")
+	}
+	//A path that's already counted keeps its own entry
+	record(s, "GET", "/scan/0", "10.0.0.1:5000")
+	clock.t = clock.t.Add(30 * time.Minute)
+	for i := 0; i < 10; i++ {
+		record(s, "GET", fmt.Sprintf("/late/%d", i), "10.0.0.1:5000")
+	}
+
+	report := getReport(t, s, "?top=0")
+	if len(report.Paths) != MaxStatsKeys+1 {
+		t.Fatalf("Paths expected %d entries, got %d", MaxStatsKeys+1, len(report.Paths))
+	}
+	hits := make(map[string]int64)
+	for _, h := range report.Paths {
+		hits[h.Key] = h.Hits
+	}
+	if hits[OtherKey] != 60 {
+		t.Fatalf("%s expected 60 hits, got %d", OtherKey, hits[OtherKey])
+	}
+	if hits["/scan/0"] != 2 {
+		t.Fatalf("/scan/0 expected 2 hits, got %d", hits["/scan/0"])
+	}
+	if report.Total != MaxStatsKeys+61 {
+		t.Fatalf("Total expected %d, got %d", MaxStatsKeys+61, report.Total)
+	}
+}
+
+func TestStatsWindow(t *testing.T) {
+	s, clock := newTestStats()
+	record(s, "GET", "/old", "10.0.0.1:5000")
+	clock.t = clock.t.Add(30 * time.Minute)
+	record(s, "GET", "/new", "10.0.0.1:5000")
+
+	report := getReport(t, s, "?window=10m")
+	if report.Total != 1 || report.Window != "10m0s" {
+		t.Fatalf("Windowed report expected 1 hit in 10m0s, got %d in %q",
+			report.Total, report.Window)
+	}
+	if len(report.Paths) != 1 || report.Paths[0].Key != "/new" {
+		t.Fatalf("Windowed report expected only /new, got %v", report.Paths)
+	}
+
+	//Hits older than the retention period drop out of windows but
+	//still count for all time
+	clock.t = clock.t.Add(45 * time.Minute)
+	record(s, "GET", "/newer", "10.0.0.1:5000")
+	if report := getReport(t, s, "?window=1h"); report.Total != 2 {
+		t.Fatalf("1h report expected 2 hits, got %d", report.Total)
+	}
+	if report := getReport(t, s, ""); report.Total != 3 {
+		t.Fatalf("All time report expected 3 hits, got %d", report.Total)
+	}
+}
+
+func TestStatsBadQuery(t *testing.T) {
+	s, _ := newTestStats()
+	for _, query := range []string{"?top=-1", "?top=lots", "?window=yesterday",
+		"?window=-5m", "?window=2h"} {
+		w := httptest.NewRecorder()
+		r, _ := http.NewRequest("GET", "/stats"+query, nil)
+		s.ServeHTTP(w, r)
+		if w.Code != 400 {
+			t.Errorf("/stats%s status code expected 400, got %d", query, w.Code)
+		}
+	}
+}
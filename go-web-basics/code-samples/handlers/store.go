@@ -0,0 +1,270 @@
+package main
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+//A Store keeps a Counter's hit count. Stores must be safe to use from
+//multiple goroutines since net/http serves each request on its own goroutine.
+type Store interface {
+	//Incr adds one hit and returns the new hit count
+	Incr() (int64, error)
+	//Count returns the current hit count
+	Count() (int64, error)
+	//Close releases anything the Store is holding on to
+	Close() error
+}
+
+//ErrStoreClosed is returned by a Store that has already been closed
+var ErrStoreClosed = errors.New("hit counter store closed")
+
+//MemoryStore is a Store that keeps its count in memory with an atomic
+//integer, so it's fast but starts over from zero on every restart.
+type MemoryStore struct {
+	hits atomic.Int64
+}
+
+//NewMemoryStore makes a MemoryStore starting at 0 hits
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Incr() (int64, error)  { return s.hits.Add(1), nil }
+func (s *MemoryStore) Count() (int64, error) { return s.hits.Load(), nil }
+func (s *MemoryStore) Close() error          { return nil }
+
+const (
+	logFileName      = "hits.log"
+	snapshotFileName = "hits.snapshot"
+)
+
+//DefaultSnapshotInterval is how often a FileStore snapshots its count
+//if no interval is given to OpenFileStore.
+const DefaultSnapshotInterval = 30 * time.Second
+
+//FileStore is a Store that survives restarts. Every hit is appended to a log
+//file in the Store's directory as the new total, and every snapshot interval
+//the total is written to a snapshot file and the log is truncated.
+//
+//Since each log line holds a running total rather than a "+1", replaying
+//the log after a crash between writing a snapshot and truncating the log
+//can't count the same hit twice.
+type FileStore struct {
+	dir string
+
+	mu     sync.Mutex
+	hits   int64
+	logged int64 //hits at the time of the last snapshot
+	log    *os.File
+	closed bool
+
+	stop chan struct{}
+	done chan struct{}
+}
+
+//OpenFileStore opens the FileStore kept in dir, creating the directory if it
+//doesn't exist yet, and starts snapshotting it every interval. An interval
+//of 0 means DefaultSnapshotInterval.
+func OpenFileStore(dir string, interval time.Duration) (*FileStore, error) {
+	if interval <= 0 {
+		interval = DefaultSnapshotInterval
+	}
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+
+	hits, err := readSnapshot(filepath.Join(dir, snapshotFileName))
+	if err != nil {
+		return nil, err
+	}
+	logPath := filepath.Join(dir, logFileName)
+	logged, err := replayLog(logPath)
+	if err != nil {
+		return nil, err
+	}
+	if logged > hits {
+		hits = logged
+	}
+
+	//Fold whatever was replayed into a fresh snapshot so new totals never
+	//get appended onto a torn line
+	if err := writeSnapshot(filepath.Join(dir, snapshotFileName), hits); err != nil {
+		return nil, err
+	}
+	log, err := os.OpenFile(logPath,
+		os.O_CREATE|os.O_WRONLY|os.O_APPEND|os.O_TRUNC, 0644)
+	if err != nil {
+		return nil, err
+	}
+
+	s := &FileStore{
+		dir:    dir,
+		hits:   hits,
+		logged: hits,
+		log:    log,
+		stop:   make(chan struct{}),
+		done:   make(chan struct{}),
+	}
+	go s.snapshotEvery(interval)
+	return s, nil
+}
+
+func (s *FileStore) Incr() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrStoreClosed
+	}
+
+	line := strconv.AppendInt(nil, s.hits+1, 10)
+	if _, err := s.log.Write(append(line, '\n')); err != nil {
+		return 0, err
+	}
+	s.hits++
+	return s.hits, nil
+}
+
+func (s *FileStore) Count() (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return 0, ErrStoreClosed
+	}
+	return s.hits, nil
+}
+
+//Snapshot writes the current count to the snapshot file and truncates the
+//log. It's called periodically, but can also be called directly.
+func (s *FileStore) Snapshot() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if s.closed {
+		return ErrStoreClosed
+	}
+	return s.snapshot()
+}
+
+//snapshot does the work of Snapshot; s.mu must be held.
+func (s *FileStore) snapshot() error {
+	if s.hits == s.logged {
+		return nil
+	}
+	if err := writeSnapshot(filepath.Join(s.dir, snapshotFileName), s.hits); err != nil {
+		return err
+	}
+	if err := s.log.Truncate(0); err != nil {
+		return err
+	}
+	s.logged = s.hits
+	return nil
+}
+
+func (s *FileStore) snapshotEvery(interval time.Duration) {
+	defer close(s.done)
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+			if err := s.Snapshot(); err != nil && err != ErrStoreClosed {
+				fmt.Fprintf(os.Stderr, "hit counter snapshot failed: %v\n", err)
+			}
+		case <-s.stop:
+			return
+		}
+	}
+}
+
+//Close stops the snapshot goroutine, takes a final snapshot and closes
+//the log file.
+func (s *FileStore) Close() error {
+	s.mu.Lock()
+	if s.closed {
+		s.mu.Unlock()
+		return ErrStoreClosed
+	}
+	close(s.stop)
+	s.mu.Unlock()
+	<-s.done
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.closed = true
+	err := s.snapshot()
+	if cerr := s.log.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
+
+func readSnapshot(path string) (int64, error) {
+	b, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+
+	hits, err := strconv.ParseInt(string(bytes.TrimSpace(b)), 10, 64)
+	if err != nil {
+		return 0, fmt.Errorf("reading hit count snapshot %s: %v", path, err)
+	}
+	return hits, nil
+}
+
+//writeSnapshot writes to a temporary file and renames it over the old
+//snapshot so a crash never leaves a half-written snapshot behind.
+func writeSnapshot(path string, hits int64) error {
+	tmp := path + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+	if _, err := fmt.Fprintf(f, "%d\n", hits); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp, path)
+}
+
+//replayLog returns the highest total in the log. A torn last line from a
+//crash mid-write is ignored.
+func replayLog(path string) (int64, error) {
+	f, err := os.Open(path)
+	if os.IsNotExist(err) {
+		return 0, nil
+	} else if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+
+	var hits int64
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		n, err := strconv.ParseInt(scanner.Text(), 10, 64)
+		if err != nil {
+			continue
+		}
+		if n > hits {
+			hits = n
+		}
+	}
+	return hits, scanner.Err()
+}
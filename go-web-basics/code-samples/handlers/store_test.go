@@ -0,0 +1,155 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"testing"
+	"time"
+)
+
+//hitConcurrently calls s.Incr n times from each of workers goroutines
+func hitConcurrently(t *testing.T, s Store, workers, n int) {
+	var wg sync.WaitGroup
+	for i := 0; i < workers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for j := 0; j < n; j++ {
+				if _, err := s.Incr(); err != nil {
+					t.Errorf("Incr failed: %v", err)
+					return
+				}
+			}
+		}()
+	}
+	wg.Wait()
+}
+
+func expectCount(t *testing.T, s Store, expected int64) {
+	count, err := s.Count()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if count != expected {
+		t.Fatalf("Count() expected %d, got %d", expected, count)
+	}
+}
+
+func TestMemoryStoreConcurrent(t *testing.T) {
+	s := NewMemoryStore()
+	hitConcurrently(t, s, 20, 500)
+	expectCount(t, s, 10000)
+}
+
+func TestFileStoreConcurrent(t *testing.T) {
+	s, err := OpenFileStore(t.TempDir(), time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+
+	hitConcurrently(t, s, 20, 100)
+	expectCount(t, s, 2000)
+}
+
+func TestFileStoreSurvivesRestart(t *testing.T) {
+	dir := t.TempDir()
+	s, err := OpenFileStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	hitConcurrently(t, s, 4, 25)
+	if err := s.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	s, err = OpenFileStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	expectCount(t, s, 100)
+
+	hits, err := s.Incr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits != 101 {
+		t.Fatalf("Incr() after restart expected 101, got %d", hits)
+	}
+}
+
+//Without a Close, the count has to come from replaying the log
+func TestFileStoreReplaysLog(t *testing.T) {
+	dir := t.TempDir()
+	os.WriteFile(filepath.Join(dir, snapshotFileName), []byte("10\n"), 0644)
+	//The last line was torn by a crash partway through writing the 16th hit
+	os.WriteFile(filepath.Join(dir, logFileName),
+		[]byte("11\n12\n13\n14\n15\n1"), 0644)
+
+	s, err := OpenFileStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expectCount(t, s, 15)
+
+	hits, err := s.Incr()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if hits != 16 {
+		t.Fatalf("Incr() after replay expected 16, got %d", hits)
+	}
+	s.Close()
+
+	reopened, err := OpenFileStore(dir, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer reopened.Close()
+	expectCount(t, reopened, 16)
+}
+
+func TestFileStoreClosed(t *testing.T) {
+	s, err := OpenFileStore(t.TempDir(), time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	s.Close()
+	if _, err := s.Incr(); err != ErrStoreClosed {
+		t.Fatalf("Incr() on a closed store expected ErrStoreClosed, got %v", err)
+	}
+}
+
+func TestCounterServeHTTP(t *testing.T) {
+	counter := NewCounter(NewMemoryStore())
+
+	var wg sync.WaitGroup
+	for i := 0; i < 50; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r, _ := http.NewRequest("GET", "/", nil)
+			counter.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+	wg.Wait()
+
+	w := httptest.NewRecorder()
+	r, err := http.NewRequest("GET", "/", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	counter.ServeHTTP(w, r)
+
+	if w.Code != 200 {
+		t.Fatalf("Response status code expected 200, got %d", w.Code)
+	}
+	if w.Body.String() != "This app's hit count: 51" {
+		t.Fatalf("w.Body.String() failed, expected %v, got %v",
+			"This app's hit count: 51", w.Body.String())
+	}
+}
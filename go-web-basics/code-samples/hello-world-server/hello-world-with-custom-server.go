@@ -2,7 +2,10 @@
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func serveHello(w http.ResponseWriter, r *http.Request) {
@@ -11,9 +14,7 @@ func serveHello(w http.ResponseWriter, r *http.Request) {
 
 func main() {
 	http.HandleFunc("/", serveHello)
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: http.DefaultServeMux,
+	if err := serve.ListenAndServe(http.DefaultServeMux); err != nil {
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
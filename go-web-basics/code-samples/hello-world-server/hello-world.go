@@ -2,7 +2,10 @@
 
 import (
     "fmt"
+    "log"
     "net/http"
+
+    "github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func serveHello(w http.ResponseWriter, r *http.Request) {
@@ -11,5 +14,7 @@ func serveHello(w http.ResponseWriter, r *http.Request) {
 
 func main() {
     http.HandleFunc("/", serveHello)
-    http.ListenAndServe(":1123", nil)
+    if err := serve.ListenAndServe(nil); err != nil {
+        log.Fatal(err)
+    }
 }
\ No newline at end of file
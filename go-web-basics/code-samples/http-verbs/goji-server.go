@@ -1,32 +1,65 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"html"
+	"log"
 	"net/http"
 
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/csrf"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/order"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/recovery"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 	"github.com/zenazn/goji/web"
 )
 
 func main() {
-	serveOrderForm := func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "pages/order-form.html")
-	}
-	serveCoffeeShopOrderForm := func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "pages/coffee-shop-order-form.html")
+	//This sample has a flag of its own, so register the server's
+	//config flags before parsing the command line
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	ordersDB := flag.String("orders-db", "",
+		"SQLite file to store orders in; orders are kept in memory if empty")
+	flag.Parse()
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	serveSendOrder := func(w http.ResponseWriter, r *http.Request) {
-		r.ParseForm()
-		beverage := html.EscapeString(r.Form.Get("beverage"))
-		name := html.EscapeString(r.Form.Get("name"))
+	//CSRF protection for the HTML order forms: GET requests get a token
+	//cookie and a hidden token field in the form, and POST requests without
+	//a matching token get a 403 Forbidden. The key is read before the
+	//repository is opened, since log.Fatal wouldn't close it.
+	csrfKey, err := csrf.KeyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	protect := csrf.New(csrfKey).Middleware
 
-		fmt.Fprintf(w, "<body>One %s coming right up, %s!</body>",
-			beverage, name)
+	//Orders placed at /send-order and /coffee-shop are stored in a
+	//Repository and served as a REST resource under /orders
+	repo, err := order.Open(*ordersDB)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer repo.Close()
+	orders := order.NewResource(repo)
+
+	//The order forms are rendered from a template instead of served from
+	//pages/ like in the Express server, so they can include the CSRF token
+	serveOrderForm := protect(order.FormHandler("send-order"))
+	serveCoffeeShopOrderForm := protect(order.FormHandler("coffee-shop"))
+
+	//Place validates the order, stores it, and answers with HTML, JSON or
+	//plain text, whichever the client's Accept header prefers
+	serveSendOrder := protect(http.HandlerFunc(orders.Place))
 
 	m := web.New() //Create a Goji Mux
 
+	//Goji middleware can be a plain func(http.Handler) http.Handler, so the
+	//recovery middleware turns panics in any route into a 500 error page
+	m.Use(recovery.Middleware)
+
 	//A Goji Mux comes with Get and Post methods for registering routes for
 	//specific HTTP methods
 	m.Get("/order-form", serveOrderForm)
@@ -36,6 +69,19 @@ func main() {
 	m.Get("/coffee-shop", serveCoffeeShopOrderForm)
 	m.Post("/coffee-shop", serveSendOrder)
 
+	//The orders REST resource. Goji puts the :id URL parameter in the
+	//web.C's URLParams.
+	m.Get("/orders", orders.List)
+	m.Get("/orders/:id", func(c web.C, w http.ResponseWriter, r *http.Request) {
+		orders.Get(w, r, c.URLParams["id"])
+	})
+	m.Patch("/orders/:id", func(c web.C, w http.ResponseWriter, r *http.Request) {
+		orders.Patch(w, r, c.URLParams["id"])
+	})
+	m.Delete("/orders/:id", func(c web.C, w http.ResponseWriter, r *http.Request) {
+		orders.Delete(w, r, c.URLParams["id"])
+	})
+
 	m.Handle("/", func(w http.ResponseWriter, r *http.Request) {
 		reqMethod := r.Method
 		if reqMethod == "" {
@@ -45,9 +91,10 @@ func main() {
 		fmt.Fprintf(w, "Your request method is %s", reqMethod)
 	})
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: m,
+	if err := config.Runner(m).Run(); err != nil {
+		//log.Fatal exits without running deferred calls, so close the
+		//repository first
+		repo.Close()
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
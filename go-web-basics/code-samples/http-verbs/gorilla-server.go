@@ -1,40 +1,82 @@
 package main
 
 import (
+	"flag"
 	"fmt"
-	"html"
+	"log"
 	"net/http"
 
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/csrf"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/order"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/recovery"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 	"github.com/gorilla/mux"
 )
 
 func main() {
-	serveOrderForm := func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "pages/order-form.html")
-	}
-	serveCoffeeShopOrderForm := func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "pages/coffee-shop-order-form.html")
+	//This sample has a flag of its own, so register the server's
+	//config flags before parsing the command line
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	ordersDB := flag.String("orders-db", "",
+		"SQLite file to store orders in; orders are kept in memory if empty")
+	flag.Parse()
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
 	}
 
-	serveSendOrder := func(w http.ResponseWriter, r *http.Request) {
-		r.ParseForm()
-		beverage := html.EscapeString(r.Form.Get("beverage"))
-		name := html.EscapeString(r.Form.Get("name"))
+	//CSRF protection for the HTML order forms: GET requests get a token
+	//cookie and a hidden token field in the form, and POST requests without
+	//a matching token get a 403 Forbidden. The key is read before the
+	//repository is opened, since log.Fatal wouldn't close it.
+	csrfKey, err := csrf.KeyFromEnv()
+	if err != nil {
+		log.Fatal(err)
+	}
+	protect := csrf.New(csrfKey).Middleware
 
-		fmt.Fprintf(w, "<body>One %s coming right up, %s!</body>",
-			beverage, name)
+	//Orders placed at /send-order and /coffee-shop are stored in a
+	//Repository and served as a REST resource under /orders
+	repo, err := order.Open(*ordersDB)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer repo.Close()
+	orders := order.NewResource(repo)
+
+	//The order forms are rendered from a template instead of served from
+	//pages/ like in the Express server, so they can include the CSRF token
+	serveOrderForm := protect(order.FormHandler("send-order"))
+	serveCoffeeShopOrderForm := protect(order.FormHandler("coffee-shop"))
+
+	//Place validates the order, stores it, and answers with HTML, JSON or
+	//plain text, whichever the client's Accept header prefers
+	serveSendOrder := protect(http.HandlerFunc(orders.Place))
 
 	m := mux.NewRouter() //Create a Gorilla mux Router
 
 	//You restrict routes to specific HTTP methods with Route.Methods()
-	m.HandleFunc("/order-form", serveOrderForm).Methods("GET")
-	m.HandleFunc("/send-order", serveSendOrder).Methods("POST")
+	m.Handle("/order-form", serveOrderForm).Methods("GET")
+	m.Handle("/send-order", serveSendOrder).Methods("POST")
 
 	//You can also register multiple handlers to the same path in Gorilla and
 	//having Gorilla resolve which one to serve with Route.Methods
-	m.Path("/coffee-shop").HandlerFunc(serveCoffeeShopOrderForm).Methods("GET")
-	m.Path("/coffee-shop").HandlerFunc(serveSendOrder).Methods("POST")
+	m.Path("/coffee-shop").Handler(serveCoffeeShopOrderForm).Methods("GET")
+	m.Path("/coffee-shop").Handler(serveSendOrder).Methods("POST")
+
+	//The orders REST resource. Gorilla puts the {id} route variable in
+	//mux.Vars.
+	m.HandleFunc("/orders", orders.List).Methods("GET")
+	m.HandleFunc("/orders/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		orders.Get(w, r, mux.Vars(r)["id"])
+	}).Methods("GET")
+	m.HandleFunc("/orders/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		orders.Patch(w, r, mux.Vars(r)["id"])
+	}).Methods("PATCH")
+	m.HandleFunc("/orders/{id:[0-9]+}", func(w http.ResponseWriter, r *http.Request) {
+		orders.Delete(w, r, mux.Vars(r)["id"])
+	}).Methods("DELETE")
 
 	m.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		reqMethod := r.Method
@@ -45,9 +87,12 @@ func main() {
 		fmt.Fprintf(w, "Your request method is %s", reqMethod)
 	})
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: m,
+	//Wrap the Router rather than adding the middleware with m.Use, since a
+	//Router only runs its middleware on requests that match a route
+	if err := config.Runner(recovery.Middleware(m)).Run(); err != nil {
+		//log.Fatal exits without running deferred calls, so close the
+		//repository first
+		repo.Close()
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
@@ -2,77 +2,78 @@ package main
 
 import (
 	"fmt"
-	"html"
+	"log"
 	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/csrf"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/method"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/order"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/recovery"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func main() {
 	mux := http.NewServeMux()
 
-	serveOrderForm := func(w http.ResponseWriter, r *http.Request) {
-		//Restrict the route to only GET requests
-		if r.Method == "GET" || r.Method == "" {
-			http.ServeFile(w, r, "pages/order-form.html")
-		} else {
-			http.Error(w, "405 Method Not Allowed", 405)
-		}
+	//CSRF protection for the HTML order forms: GET requests get a token
+	//cookie and a hidden token field in the form, and POST requests without
+	//a matching token get a 403 Forbidden
+	csrfKey, err := csrf.KeyFromEnv()
+	if err != nil {
+		log.Fatal(err)
 	}
+	protect := csrf.New(csrfKey).Middleware
 
-	serveSendOrder := func(w http.ResponseWriter, r *http.Request) {
-		//Restrict the route to only POST requests
-		if r.Method == "POST" {
-			//Parse the POST data with r.ParseForm() and
-			//get the data with r.Form.Get()
-			r.ParseForm()
-			beverage := html.EscapeString(r.Form.Get("beverage"))
-			name := html.EscapeString(r.Form.Get("name"))
+	//The order form is rendered from a template instead of served from
+	//pages/ like in the Express server, so it can include the CSRF token
+	serveOrderForm := order.FormHandler("send-order")
 
-			fmt.Fprintf(w, "<body>One %s coming right up, %s!</body>",
-				beverage, name)
-		} else {
-			http.Error(w, "405 Method Not Allowed", 405)
+	//One handler takes the orders posted to the send-order and coffee-shop
+	//routes
+	sendOrder := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Parse and validate the POST data, which can be a form or JSON,
+		//with order.Decode, which responds with what's wrong with the
+		//order if it's invalid
+		o, ok := order.Decode(w, r)
+		if !ok {
+			return
 		}
-	}
-	mux.HandleFunc("/order-form", serveOrderForm)
-	mux.HandleFunc("/send-order", serveSendOrder)
+		//Confirm answers with HTML, JSON or plain text, whichever the
+		//client's Accept header prefers
+		order.Confirm(w, r, o)
+	})
+
+	//Restrict the routes to only GET and only POST requests with a
+	//method.Handler, which sends a 405 with an Allow header for any other
+	//method, answers OPTIONS requests, and serves HEAD requests with the
+	//GET handler
+	mux.Handle("/order-form", protect(method.Handler{"GET": serveOrderForm}))
+	mux.Handle("/send-order", protect(method.Handler{"POST": sendOrder}))
+
+	orderForm := order.FormHandler("coffee-shop")
 
 	//This is the version of /coffee-shop that isn't modularized
 	/*mux.HandleFunc("/coffee-shop", func(w http.ResponseWriter, r *http.Request) {
 		if r.Method == "GET" || r.Method == "" {
-			http.ServeFile(w, r, "pages/coffee-shop-order-form.html")
+			orderForm.ServeHTTP(w, r)
 		} else if r.Method == "POST" {
-			r.ParseForm()
-			beverage := html.EscapeString(r.Form.Get("beverage"))
-			name := html.EscapeString(r.Form.Get("name"))
-
-			fmt.Fprintf(w, "One %s coming right up, %s!", beverage, name)
+			o, ok := order.Decode(w, r)
+			if ok {
+				order.Confirm(w, r, o)
+			}
 		} else {
 			http.Error(w, "405 Method Not Allowed", 405)
 		}
 	})*/
 
-	orderForm := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "pages/coffee-shop-order-form.html")
-	})
-	sendOrder := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		r.ParseForm()
-		beverage := html.EscapeString(r.Form.Get("beverage"))
-		name := html.EscapeString(r.Form.Get("name"))
-
-		fmt.Fprintf(w, "<body>One %s coming right up, %s!</body>",
-			beverage, name)
-	})
-
-	//This is the modularized version of coffee-shop
-	mux.HandleFunc("/coffee-shop", func(w http.ResponseWriter, r *http.Request) {
-		if r.Method == "GET" || r.Method == "" {
-			orderForm.ServeHTTP(w, r)
-		} else if r.Method == "POST" {
-			sendOrder.ServeHTTP(w, r)
-		} else {
-			http.Error(w, "405 Method Not Allowed", 405)
-		}
-	})
+	//This is the modularized version of coffee-shop. The method.Handler
+	//passes each request to the Handler for its HTTP method, like a switch
+	//on r.Method with the 405, Allow header, OPTIONS and HEAD handling
+	//written for you.
+	mux.Handle("/coffee-shop", protect(method.Handler{
+		"GET":  orderForm,
+		"POST": sendOrder,
+	}))
 
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		reqMethod := r.Method
@@ -83,9 +84,9 @@ func main() {
 		fmt.Fprintf(w, "Your request method is %s", reqMethod)
 	})
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: mux,
+	//Wrap the ServeMux so a panic in any handler gets a 500 error page
+	//instead of a dropped connection
+	if err := serve.ListenAndServe(recovery.Middleware(mux)); err != nil {
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/chain"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/logging"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/recovery"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/static"
+)
+
+//cacheFor is a middleware constructor that sets responses' Cache-Control
+//max-age to seconds
+func cacheFor(seconds string) chain.Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", "public, max-age="+seconds)
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+func main() {
+	//A middleware function that logs each request with its status code,
+	//size and duration after the next Handler serves it
+	logRequest := logging.Middleware(logging.DefaultLogger())
+
+	mux := http.NewServeMux()
+
+	//Routes
+	//The duck pictures are cached for a day, then revalidated with their
+	//ETags
+	static.Route(mux, "/images/", static.DirFS("public/images"), static.Options{
+		CacheControl: map[string]string{".jpg": "public, max-age=86400"},
+		ETags:        true,
+		Hardened:     true,
+	})
+	//A route can have a chain of its own on top of the one every request
+	//goes through; here /ducks responses get a Cache-Control header
+	chain.New(cacheFor("3600")).HandleFunc(mux, "/ducks",
+		func(w http.ResponseWriter, r *http.Request) {
+			http.ServeFile(w, r, "pages/ducks.html")
+		})
+	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "Beware of ducks! Duck venom can turn people into ducks!")
+	})
+
+	//A middleware chain that gives each request an ID and then chains
+	//logRequest and the recovery middleware with the ServeMux
+	logAndServe := chain.New(requestid.Middleware).
+		AppendNamed("logRequest", logRequest).
+		Append(recovery.Middleware)
+	log.Printf("Middleware chain: %s", logAndServe)
+
+	logAndServeChain := logAndServe.Then(mux)
+
+	if err := serve.ListenAndServe(logAndServeChain); err != nil {
+		log.Fatal(err)
+	}
+}
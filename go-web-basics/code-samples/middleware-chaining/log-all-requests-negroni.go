@@ -2,15 +2,20 @@ package main
 
 import (
 	"fmt"
-	"github.com/codegangsta/negroni"
+	"log"
 	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/logging"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/recovery"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
+	"github.com/codegangsta/negroni"
 )
 
 func main() {
-	//simpleLog converted to a middleware function Negroni can use
-	simpleLog := func(rw http.ResponseWriter, r *http.Request) {
-		fmt.Printf("%s - %s\n", r.Method, r.URL.String())
-	}
+	//A middleware function that logs each request with its status code,
+	//size and duration after the next Handler serves it
+	logRequest := logging.Middleware(logging.DefaultLogger())
 
 	serveMux := http.NewServeMux()
 
@@ -26,19 +31,21 @@ func main() {
 
 	stack := negroni.New() //Create a Negroni middleware stack with negroni.New
 
-	//You can add an HTTP handler function to the middleware stack with
-	//UseHandlerFunc; first we're adding the logger middleware to the stack.
-	stack.UseHandlerFunc(simpleLog)
+	//A Recoverer is a negroni.Handler, so it can be added to the stack with
+	//Use. It turns a panic in any handler after it into a 500 error page.
+	stack.Use(recovery.New(logging.DefaultLogger()))
 
-	//Add a handler like the router to the middleware stack with UseHandler.
-	//In this case we're adding our ServeMux to the stack.
+	//Add a handler like the router to the middleware stack with UseHandler
 	stack.UseHandler(serveMux)
 
-	//Use the Negroni middleware stack as our Server's Handler
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: stack,
-	}
+	//The Negroni stack is an http.Handler too, so the request ID and logger
+	//middleware go around it. With the logger outside the Recoverer, it
+	//gets to see the 500 the Recoverer sends for a panic, like in the chain
+	//sample.
+	logAndServe := requestid.Middleware(logRequest(stack))
 
-	server.ListenAndServe()
+	//Use the wrapped middleware stack as our Server's Handler
+	if err := serve.ListenAndServe(logAndServe); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -2,16 +2,19 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/logging"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/recovery"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func main() {
-	logRequest := func(next http.Handler) http.Handler {
-		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-			fmt.Printf("%s - %s\n", r.Method, r.URL.String())
-			next.ServeHTTP(w, r)
-		})
-	}
+	//A middleware function that logs each request with its status code,
+	//size and duration after the next Handler serves it
+	logRequest := logging.Middleware(logging.DefaultLogger())
 
 	mux := http.NewServeMux()
 
@@ -25,14 +28,12 @@ func main() {
 		fmt.Fprintf(w, "Beware of ducks! Duck venom can turn people into ducks!")
 	})
 
-	//Creates a Handler that when given a request logs the request and
-	//then passes the request to the ServeMux
-	logAndServe := logRequest(mux)
+	//Creates a Handler that when given a request gives it an ID, logs the
+	//request and then passes the request to the ServeMux, turning any panic
+	//into a 500 error page the logger can see
+	logAndServe := requestid.Middleware(logRequest(recovery.Middleware(mux)))
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: logAndServe,
+	if err := serve.ListenAndServe(logAndServe); err != nil {
+		log.Fatal(err)
 	}
-
-	server.ListenAndServe()
 }
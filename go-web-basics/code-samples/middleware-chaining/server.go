@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func main() {
@@ -33,5 +36,7 @@ func main() {
 	http.Handle("/", ducksHandler)
 	http.Handle("/simplelog", simpleLog)
 	http.Handle("/duckChain", logRequestAndRaiseDuckVenomAwarenessChain)
-	http.ListenAndServe(":1123", http.DefaultServeMux)
+	if err := serve.ListenAndServe(http.DefaultServeMux); err != nil {
+		log.Fatal(err)
+	}
 }
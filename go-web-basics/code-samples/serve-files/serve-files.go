@@ -1,28 +1,138 @@
 package main
 
-import "net/http"
+import (
+	"embed"
+	"flag"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path/filepath"
 
-func FileServerRoute(mux *http.ServeMux, path, dir string) {
-	mux.Handle(path, http.StripPrefix(path, http.FileServer(http.Dir(dir))))
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/auth"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/chain"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/imgproc"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/render"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/static"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/upload"
+)
+
+//The pages and images are compiled into the binary, so it can be run from
+//any directory
+//
+//go:embed pages public/images
+var assets embed.FS
+
+//FileServerRoute serves the files in dir on mux under the route path, with
+//the cache headers, compression and fingerprinting set in opts. Requests
+//go through the middleware first, after the path prefix is stripped.
+func FileServerRoute(mux *http.ServeMux, path, dir string, opts static.Options,
+	middleware ...chain.Constructor) *static.Server {
+	return FileServerRouteFS(mux, path, static.DirFS(dir), opts, middleware...)
+}
+
+//FileServerRouteFS is FileServerRoute for an fs.FS, like an embed.FS,
+//instead of a directory on disk
+func FileServerRouteFS(mux *http.ServeMux, path string, fsys fs.FS, opts static.Options,
+	middleware ...chain.Constructor) *static.Server {
+	s := static.New(fsys, opts)
+	mux.Handle(path, http.StripPrefix(path, chain.New(middleware...).Then(s)))
+	return s
+}
+
+//imageOptions has browsers cache images for a day, revalidating them with
+//their ETags after that, and forever at their fingerprinted URLs. Hardened,
+//the route doesn't list directories or serve hidden files.
+var imageOptions = static.Options{
+	CacheControl:  map[string]string{"": "public, max-age=86400"},
+	ETags:         true,
+	Precompressed: true,
+	Fingerprint:   true,
+	Hardened:      true,
 }
 
 func main() {
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	dev := flag.Bool("dev", render.Dev(),
+		"serve pages and images from the directories on disk instead of the "+
+			"copies compiled in, for editing them (env "+render.DevEnv+")")
+	throttle := flag.Int64("throttle", 0,
+		"bytes per second to send images at to each connection, or 0 for no limit")
+	imageCache := flag.String("image-cache", filepath.Join(os.TempDir(), "mean-gopher-images"),
+		"directory to cache resized images in, or \"\" to not cache them")
+	uploadDir := flag.String("upload-dir", "",
+		"directory POST /img/ stores uploaded images in (default public/images "+
+			"with -dev, or mean-gopher-uploads in the temp directory)")
+	adminToken := flag.String("admin-token", auth.TokenFromEnv(),
+		"bearer token POST /img/ and DELETE /img/{name} requests need (env "+auth.TokenEnv+")")
+	flag.Parse()
+
+	//Like the images, uploads go in public/images on disk only with -dev.
+	//Otherwise that's relative to wherever the binary is run from, so they
+	//go in a directory of their own.
+	if *uploadDir == "" {
+		*uploadDir = filepath.Join(os.TempDir(), "mean-gopher-uploads")
+		if *dev {
+			*uploadDir = "public/images"
+		}
+	}
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	images, err := static.Dir(assets, "public/images", *dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+	//Uploaded images are served along with the ones compiled in
+	images = static.Overlay(static.DirFS(*uploadDir), images)
+	pages, err := static.Dir(assets, "pages", *dev)
+	if err != nil {
+		log.Fatal(err)
+	}
+
+	imageOptions.Throttle = *throttle
+
 	mux := http.NewServeMux()
 
 	//imgServer := http.StripPrefix("/img/",
 	//	http.FileServer(http.Dir("public/images")))
 	//mux.Handle("/img/", imgServer)
 
-	FileServerRoute(mux, "/img/", "public/images")
+	//Images can be resized and converted with query parameters, in URLs
+	//like /img/sloth.jpg?w=200&h=200&fit=cover&fmt=png
+	resizer := imgproc.New(images, imgproc.Options{CacheDir: *imageCache})
 
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
-		http.ServeFile(w, r, "pages/index.html")
-	})
+	imageServer := FileServerRouteFS(mux, "/img/", images, imageOptions, resizer.Middleware)
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: mux,
+	//The admin can upload images in a multipart form's file field, and
+	//delete them
+	admin := auth.Bearer(*adminToken)
+	uploads := upload.New(*uploadDir, upload.Options{})
+	mux.Handle("POST /img/", admin(http.HandlerFunc(uploads.Upload)))
+	mux.Handle("DELETE /img/{name}", admin(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			uploads.Delete(w, r, r.PathValue("name"))
+		})))
+
+	//A page built with a template would link to the image with its
+	//fingerprinted URL
+	if url, err := imageServer.URL("sloth.jpg"); err == nil {
+		log.Printf("Fingerprinted URL for sloth.jpg: /img/%s", url)
 	}
 
-	server.ListenAndServe()
+	//The catch-all route serves index.html for browsers navigating to any
+	//page, like a single-page app, but a mistyped asset URL is a 404
+	FileServerRouteFS(mux, "/", pages, static.Options{
+		CacheControl: map[string]string{".html": "no-cache"},
+		ETags:        true,
+		Hardened:     true,
+		Fallback:     "index.html",
+	})
+
+	if err := config.Runner(mux).Run(); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func main() {
@@ -11,9 +14,7 @@ func main() {
 		fmt.Fprintf(w, "Sloths rule!")
 	})
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: mux,
+	if err := serve.ListenAndServe(mux); err != nil {
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
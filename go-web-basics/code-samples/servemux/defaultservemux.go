@@ -2,7 +2,10 @@ package main
 
 import (
 	"fmt"
+	"log"
 	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func main() {
@@ -17,5 +20,7 @@ func main() {
 	//     fmt.Fprintf(w, "Sloths rule!")
 	// })
 
-	http.ListenAndServe(":1123", nil)
+	if err := serve.ListenAndServe(nil); err != nil {
+		log.Fatal(err)
+	}
 }
@@ -1,12 +1,25 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/routes"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 )
 
 func main() {
-	mux := http.NewServeMux()
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	printRoutes := routes.RegisterFlag(flag.CommandLine)
+	flag.Parse()
+
+	//The ServeMux records its routes in reg, so we can see which patterns
+	//are registered when a request doesn't go where we expect
+	reg := routes.New()
+	mux := reg.ServeMux(http.NewServeMux())
 
 	//Matches ONLY /sloths, not /sloths/ or /sloths/are-awesome
 	mux.HandleFunc("/sloths", func(w http.ResponseWriter, r *http.Request) {
@@ -35,9 +48,29 @@ func main() {
 		fmt.Fprintf(w, "One hibiscus tea coming right up!")
 	})
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: mux,
+	//Lists the routes above
+	mux.Handle("/debug/routes", reg.Handler())
+
+	//Warn about routes that other routes take some requests from, and stop
+	//on routes that can't be reached at all
+	checkErr := reg.Check(nil)
+
+	//With -routes, print the routes instead of serving them
+	if *printRoutes {
+		if err := reg.WriteTable(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if checkErr != nil {
+		log.Fatal(checkErr)
+	}
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := config.Runner(mux).Run(); err != nil {
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
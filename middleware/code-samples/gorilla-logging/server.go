@@ -1,27 +1,62 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"io"
+	"log"
 	"net/http"
 	"os"
+	"time"
 
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/logging"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 	"github.com/gorilla/handlers"
 )
 
 func main() {
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	logFile := flag.String("access-log", "",
+		"file to write the access log to instead of stdout")
+	flag.Parse()
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+
 	mux := http.NewServeMux()
 	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "This is the catch-all route")
 	})
 
-	//As our io.Writer, we use os.Stdout and we chain our LoggingHandler
-	//with our ServeMux.
-	logAndServe := handlers.LoggingHandler(os.Stdout, mux)
+	//By default our io.Writer is os.Stdout. In production, log to a file
+	//that rotates daily or at 100MB, keeping a week of gzipped backups.
+	var out io.Writer = os.Stdout
+	closeLog := func() error { return nil }
+	if *logFile != "" {
+		rotatingFile, err := logging.OpenRotatingFile(*logFile, logging.RotateOptions{
+			MaxSize:        100 << 20,
+			Interval:       24 * time.Hour,
+			MaxBackups:     7,
+			ReopenOnSIGHUP: true,
+		})
+		if err != nil {
+			log.Fatal(err)
+		}
+		closeLog = rotatingFile.Close
+		out = rotatingFile
+	}
+	defer closeLog()
+
+	//We chain our LoggingHandler with our ServeMux.
+	logAndServe := handlers.LoggingHandler(out, mux)
 
 	//Now just pass in logAndServe as our server's Handler
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: logAndServe,
+	if err := config.Runner(logAndServe).Run(); err != nil {
+		//log.Fatal exits without running deferred calls, so close the log
+		//file first to write the queued log lines
+		closeLog()
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
@@ -0,0 +1,43 @@
+//Package auth protects routes that change things, like deleting an
+//uploaded image, with a bearer token only the samples' admin knows.
+package auth
+
+import (
+	"crypto/sha256"
+	"crypto/subtle"
+	"net/http"
+	"os"
+	"strings"
+)
+
+//TokenEnv is the environment variable TokenFromEnv reads the token from
+const TokenEnv = "MEAN_GOPHER_ADMIN_TOKEN"
+
+//TokenFromEnv returns the token in the MEAN_GOPHER_ADMIN_TOKEN environment
+//variable, or "" if it's not set
+func TokenFromEnv() string {
+	return os.Getenv(TokenEnv)
+}
+
+//Bearer returns middleware that only lets through requests with the header
+//"Authorization: Bearer token". Other requests get a 401 Unauthorized. If
+//token is "", every request is turned away, so forgetting to set a token
+//doesn't leave a route open.
+func Bearer(token string) func(http.Handler) http.Handler {
+	//Comparing hashes keeps the comparison constant time even when the
+	//lengths differ
+	want := sha256.Sum256([]byte(token))
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			scheme, got, ok := strings.Cut(r.Header.Get("Authorization"), " ")
+			gotSum := sha256.Sum256([]byte(strings.TrimSpace(got)))
+			if token == "" || !ok || !strings.EqualFold(scheme, "Bearer") ||
+				subtle.ConstantTimeCompare(gotSum[:], want[:]) != 1 {
+				w.Header().Set("WWW-Authenticate", `Bearer realm="MEAN-Gopher"`)
+				http.Error(w, "401 Unauthorized", http.StatusUnauthorized)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
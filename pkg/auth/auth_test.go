@@ -0,0 +1,52 @@
+package auth
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+var deleted = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.WriteHeader(http.StatusNoContent)
+})
+
+func do(h http.Handler, authorization string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("DELETE", "/img/sloth.jpg", nil)
+	if authorization != "" {
+		r.Header.Set("Authorization", authorization)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestBearer(t *testing.T) {
+	h := Bearer("sloth-admin")(deleted)
+	tests := map[string]int{
+		"Bearer sloth-admin":      204,
+		"bearer sloth-admin":      204,
+		"":                        401,
+		"sloth-admin":             401,
+		"Bearer duck-admin":       401,
+		"Bearer sloth-admin-plus": 401,
+		"Basic c2xvdGg6YWRtaW4=":  401,
+	}
+	for authorization, code := range tests {
+		w := do(h, authorization)
+		if w.Code != code {
+			t.Errorf("Authorization %q expected %d, got %d", authorization, code, w.Code)
+		}
+		if code == 401 && w.Header().Get("WWW-Authenticate") == "" {
+			t.Errorf("Authorization %q expected a WWW-Authenticate header", authorization)
+		}
+	}
+}
+
+func TestBearerWithoutToken(t *testing.T) {
+	h := Bearer("")(deleted)
+	for _, authorization := range []string{"", "Bearer", "Bearer "} {
+		if w := do(h, authorization); w.Code != 401 {
+			t.Errorf("Authorization %q with no token set expected 401, got %d", authorization, w.Code)
+		}
+	}
+}
@@ -0,0 +1,149 @@
+//Package chain composes func(http.Handler) http.Handler middleware
+//constructors into a single Handler, like github.com/justinas/alice, with
+//helpers for giving individual ServeMux routes their own chains and for
+//seeing what order a chain runs its middleware in.
+package chain
+
+import (
+	"log/slog"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+)
+
+//A Constructor is a middleware constructor: it takes the next Handler in a
+//chain and returns a Handler that runs some middleware around it
+type Constructor func(http.Handler) http.Handler
+
+//A Chain is an immutable list of middleware constructors. Requests go
+//through them in the order they were added, so the first constructor's
+//middleware sees the request first and the response last.
+type Chain struct {
+	constructors []Constructor
+	names        []string
+}
+
+//New makes a Chain from constructors
+func New(constructors ...Constructor) Chain {
+	return Chain{}.Append(constructors...)
+}
+
+//Append returns a new Chain with constructors added to the end of c.
+//c itself is left unchanged, so one Chain can be the base of several.
+func (c Chain) Append(constructors ...Constructor) Chain {
+	names := make([]string, len(constructors))
+	for i, constructor := range constructors {
+		names[i] = funcName(constructor)
+	}
+	return c.appendNamed(constructors, names)
+}
+
+//AppendNamed is like Append with one constructor, but with name shown for
+//it in Names and String instead of the constructor's function name. It's
+//handy for closures, whose function names aren't very descriptive.
+func (c Chain) AppendNamed(name string, constructor Constructor) Chain {
+	return c.appendNamed([]Constructor{constructor}, []string{name})
+}
+
+//Extend returns a new Chain with the constructors of other added to the
+//end of c
+func (c Chain) Extend(other Chain) Chain {
+	return c.appendNamed(other.constructors, other.names)
+}
+
+func (c Chain) appendNamed(constructors []Constructor, names []string) Chain {
+	n := len(c.constructors)
+	newCons := make([]Constructor, 0, n+len(constructors))
+	newCons = append(append(newCons, c.constructors...), constructors...)
+	newNames := make([]string, 0, n+len(names))
+	newNames = append(append(newNames, c.names...), names...)
+	return Chain{constructors: newCons, names: newNames}
+}
+
+//Then returns h wrapped in the chain's middleware. If h is nil,
+//http.DefaultServeMux is used.
+func (c Chain) Then(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	for i := len(c.constructors) - 1; i >= 0; i-- {
+		h = c.constructors[i](h)
+	}
+	return h
+}
+
+//ThenFunc is Then for a handler function. If fn is nil,
+//http.DefaultServeMux is used.
+func (c Chain) ThenFunc(fn http.HandlerFunc) http.Handler {
+	if fn == nil {
+		return c.Then(nil)
+	}
+	return c.Then(fn)
+}
+
+//Handle registers h wrapped in the chain on mux for pattern, so a route can
+//have middleware the rest of the ServeMux doesn't. If mux is nil, the route
+//is registered on http.DefaultServeMux.
+func (c Chain) Handle(mux *http.ServeMux, pattern string, h http.Handler) {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	mux.Handle(pattern, c.Then(h))
+}
+
+//HandleFunc is Handle for a handler function
+func (c Chain) HandleFunc(mux *http.ServeMux, pattern string, fn http.HandlerFunc) {
+	c.Handle(mux, pattern, fn)
+}
+
+//Len returns the number of constructors in the chain
+func (c Chain) Len() int {
+	return len(c.constructors)
+}
+
+//Names returns the names of the chain's constructors in the order requests
+//go through them
+func (c Chain) Names() []string {
+	return append([]string(nil), c.names...)
+}
+
+//String describes the chain, like
+//"requestid.Middleware -> logRequest -> recovery.Middleware"
+func (c Chain) String() string {
+	return strings.Join(c.names, " -> ")
+}
+
+//Debug returns a copy of c that logs, at debug level, the name of each
+//middleware as a request enters it and as the response leaves it, to show
+//the order the chain actually runs in.
+func (c Chain) Debug(logger *slog.Logger) Chain {
+	constructors := make([]Constructor, len(c.constructors))
+	for i, constructor := range c.constructors {
+		name, constructor := c.names[i], constructor
+		constructors[i] = func(next http.Handler) http.Handler {
+			h := constructor(next)
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				logger.DebugContext(r.Context(), "entering middleware",
+					"middleware", name, "position", i, "path", r.URL.Path)
+				defer logger.DebugContext(r.Context(), "leaving middleware",
+					"middleware", name, "position", i, "path", r.URL.Path)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	return Chain{}.appendNamed(constructors, c.names)
+}
+
+//funcName returns fn's name qualified by the last element of its package
+//path, like "requestid.Middleware"
+func funcName(fn Constructor) string {
+	if fn == nil {
+		return "<nil>"
+	}
+	name := runtime.FuncForPC(reflect.ValueOf(fn).Pointer()).Name()
+	if i := strings.LastIndex(name, "/"); i >= 0 {
+		name = name[i+1:]
+	}
+	return name
+}
@@ -0,0 +1,132 @@
+package chain
+
+import (
+	"bytes"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+//tag makes a constructor whose middleware writes name before and after the
+//next Handler
+func tag(name string) Constructor {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Write([]byte(name + "("))
+			next.ServeHTTP(w, r)
+			w.Write([]byte(")"))
+		})
+	}
+}
+
+var sloths = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("sloths"))
+})
+
+func body(h http.Handler, path string) string {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", path, nil))
+	return w.Body.String()
+}
+
+func TestThenOrder(t *testing.T) {
+	h := New(tag("a"), tag("b")).Append(tag("c")).Then(sloths)
+	if got := body(h, "/"); got != "a(b(c(sloths)))" {
+		t.Fatalf("Chained response expected a(b(c(sloths))), got %q", got)
+	}
+	if got := body(New().ThenFunc(sloths), "/"); got != "sloths" {
+		t.Fatalf("Empty chain response expected sloths, got %q", got)
+	}
+}
+
+func TestThenNilUsesDefaultServeMux(t *testing.T) {
+	if h := New().Then(nil); h != http.DefaultServeMux {
+		t.Fatalf("Then(nil) on an empty chain expected http.DefaultServeMux, got %v", h)
+	}
+	if h := New().ThenFunc(nil); h != http.DefaultServeMux {
+		t.Fatalf("ThenFunc(nil) on an empty chain expected http.DefaultServeMux, got %v", h)
+	}
+}
+
+func TestAppendDoesNotModify(t *testing.T) {
+	base := New(tag("a"))
+	b := base.Append(tag("b"))
+	c := base.Append(tag("c"))
+	extended := b.Extend(c)
+
+	tests := map[string]struct {
+		chain Chain
+		want  string
+	}{
+		"base":     {base, "a(sloths)"},
+		"b":        {b, "a(b(sloths))"},
+		"c":        {c, "a(c(sloths))"},
+		"extended": {extended, "a(b(a(c(sloths))))"},
+	}
+	for name, test := range tests {
+		if got := body(test.chain.Then(sloths), "/"); got != test.want {
+			t.Errorf("Response through %s expected %s, got %q", name, test.want, got)
+		}
+	}
+}
+
+func TestPerRouteChains(t *testing.T) {
+	mux := http.NewServeMux()
+	common := New(tag("log"))
+	common.HandleFunc(mux, "/sloths", sloths)
+	common.Append(tag("auth")).Handle(mux, "/api/", sloths)
+
+	if got := body(mux, "/sloths"); got != "log(sloths)" {
+		t.Fatalf("Response on /sloths expected log(sloths), got %q", got)
+	}
+	if got := body(mux, "/api/sloths"); got != "log(auth(sloths))" {
+		t.Fatalf("Response on /api/sloths expected log(auth(sloths)), got %q", got)
+	}
+}
+
+func TestNames(t *testing.T) {
+	c := New(requestid.Middleware).AppendNamed("auth", tag("auth")).Append(tag("c"))
+	names := c.Names()
+	if len(names) != 3 || c.Len() != 3 {
+		t.Fatalf("Names expected 3 entries, got %v", names)
+	}
+	if names[0] != "requestid.Middleware" || names[1] != "auth" ||
+		!strings.HasPrefix(names[2], "chain.tag.") {
+		t.Fatalf("Names expected [requestid.Middleware auth chain.tag.funcN], got %v", names)
+	}
+	if s := New(requestid.Middleware).AppendNamed("auth", nil).String(); s != "requestid.Middleware -> auth" {
+		t.Fatalf("String expected \"requestid.Middleware -> auth\", got %q", s)
+	}
+
+	names[0] = "changed"
+	if c.Names()[0] != "requestid.Middleware" {
+		t.Fatal("Modifying the slice from Names expected to leave the chain unchanged")
+	}
+}
+
+func TestDebug(t *testing.T) {
+	var logs bytes.Buffer
+	logger := slog.New(slog.NewTextHandler(&logs, &slog.HandlerOptions{Level: slog.LevelDebug}))
+
+	c := New().AppendNamed("a", tag("a")).AppendNamed("b", tag("b")).Debug(logger)
+	if got := body(c.Then(sloths), "/"); got != "a(b(sloths))" {
+		t.Fatalf("Response through a debug chain expected a(b(sloths)), got %q", got)
+	}
+
+	var order []string
+	for _, line := range strings.Split(strings.TrimSpace(logs.String()), "\n") {
+		for _, field := range strings.Fields(line) {
+			if strings.HasPrefix(field, "middleware=") {
+				order = append(order, strings.TrimPrefix(field, "middleware="))
+			}
+		}
+	}
+	if want := []string{"a", "b", "b", "a"}; !reflect.DeepEqual(order, want) {
+		t.Fatalf("Logged middleware order expected %v, got %v", want, order)
+	}
+}
@@ -0,0 +1,215 @@
+//Package content decodes request bodies according to their Content-Type
+//and writes responses in whichever format the request's Accept header
+//prefers, so one handler can serve HTML forms, JSON clients and curl.
+package content
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	htmltemplate "html/template"
+	"io"
+	"mime"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+)
+
+//Media types Decode understands and Respond's helpers produce
+const (
+	JSONType      = "application/json"
+	FormType      = "application/x-www-form-urlencoded"
+	MultipartType = "multipart/form-data"
+	HTMLType      = "text/html"
+	TextType      = "text/plain"
+)
+
+//ErrUnsupportedMediaType is returned by Decode for a body in a format it
+//doesn't understand
+var ErrUnsupportedMediaType = errors.New("content: unsupported media type")
+
+//Decode reads r's body into the struct dst points to and validates it
+//with form.Validate. JSON bodies are decoded with encoding/json, and form
+//and multipart bodies with form.Decode, as is a request without a
+//Content-Type, which only has its URL query to bind.
+//Use Status to pick the status code to respond to an error with.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	mediaType := FormType
+	if ct := r.Header.Get("Content-Type"); ct != "" {
+		var err error
+		if mediaType, _, err = mime.ParseMediaType(ct); err != nil {
+			return ErrUnsupportedMediaType
+		}
+	}
+
+	switch mediaType {
+	case FormType, MultipartType:
+		return form.Decode(w, r, dst)
+	case JSONType:
+		return decodeJSON(w, r, dst)
+	default:
+		return ErrUnsupportedMediaType
+	}
+}
+
+func decodeJSON(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	dec := json.NewDecoder(http.MaxBytesReader(w, r.Body, form.MaxBodyBytes))
+	if err := dec.Decode(dst); err != nil {
+		//A value of the wrong type is a problem with a field, like a
+		//form value that doesn't convert
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) && typeErr.Field != "" {
+			return form.Errors{typeErr.Field: typeErr.Field + " " + typeMessage(typeErr.Type)}
+		}
+		return err
+	}
+	if dec.More() {
+		return errors.New("content: more than one JSON value in the body")
+	}
+
+	if errs := form.Validate(dst); errs != nil {
+		return errs
+	}
+	return nil
+}
+
+func typeMessage(t reflect.Type) string {
+	switch t.Kind() {
+	case reflect.String:
+		return "must be a string"
+	case reflect.Bool:
+		return "must be true or false"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64,
+		reflect.Float32, reflect.Float64:
+		return "must be a number"
+	default:
+		return "has the wrong type"
+	}
+}
+
+//Status returns the HTTP status code to respond to a Decode error with:
+//415 for ErrUnsupportedMediaType, otherwise what form.Status returns.
+func Status(err error) int {
+	if errors.Is(err, ErrUnsupportedMediaType) {
+		return http.StatusUnsupportedMediaType
+	}
+	return form.Status(err)
+}
+
+//An Offer is one format a response can be written in
+type Offer struct {
+	//Type is the offer's media type, like "application/json"
+	Type string
+	//Write writes the response body
+	Write func(w io.Writer) error
+}
+
+//HTML offers the response as tmpl executed with data
+func HTML(tmpl *htmltemplate.Template, data interface{}) Offer {
+	return Offer{HTMLType, func(w io.Writer) error {
+		return tmpl.Execute(w, data)
+	}}
+}
+
+//JSON offers the response as v encoded as JSON
+func JSON(v interface{}) Offer {
+	return Offer{JSONType, func(w io.Writer) error {
+		return json.NewEncoder(w).Encode(v)
+	}}
+}
+
+//Text offers the response as plain text formatted like fmt.Sprintf, with
+//a trailing newline
+func Text(format string, args ...interface{}) Offer {
+	return Offer{TextType, func(w io.Writer) error {
+		_, err := fmt.Fprintf(w, format+"\n", args...)
+		return err
+	}}
+}
+
+//Respond writes the offer r's Accept header prefers, with status. The first
+//offer is used if the request doesn't say what it accepts; if it accepts
+//none of them, Respond sends a 406 Not Acceptable instead.
+func Respond(w http.ResponseWriter, r *http.Request, status int, offers ...Offer) error {
+	types := make([]string, len(offers))
+	for i, offer := range offers {
+		types[i] = offer.Type
+	}
+
+	w.Header().Add("Vary", "Accept")
+	best := Negotiate(r.Header.Get("Accept"), types...)
+	if best == "" {
+		http.Error(w, http.StatusText(http.StatusNotAcceptable), http.StatusNotAcceptable)
+		return nil
+	}
+	for _, offer := range offers {
+		if offer.Type == best {
+			contentType := offer.Type
+			if strings.HasPrefix(contentType, "text/") {
+				contentType += "; charset=utf-8"
+			}
+			w.Header().Set("Content-Type", contentType)
+			w.WriteHeader(status)
+			return offer.Write(w)
+		}
+	}
+	return nil
+}
+
+//Negotiate returns the offered media type accept ranks highest, or "" if
+//it doesn't accept any of them. A missing Accept header accepts anything,
+//and ties go to the type offered first.
+func Negotiate(accept string, offers ...string) string {
+	if strings.TrimSpace(accept) == "" {
+		accept = "*/*"
+	}
+
+	best, bestQ := "", 0.0
+	for _, offer := range offers {
+		if q := quality(accept, offer); q > bestQ {
+			best, bestQ = offer, q
+		}
+	}
+	return best
+}
+
+//quality returns the q-value accept gives mediaType, using its most
+//specific matching range
+func quality(accept, mediaType string) float64 {
+	typ, _, _ := strings.Cut(mediaType, "/")
+	q, specificity := 0.0, -1
+	for _, part := range strings.Split(accept, ",") {
+		rng, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+
+		var s int
+		switch {
+		case rng == mediaType:
+			s = 2
+		case rng == typ+"/*":
+			s = 1
+		case rng == "*/*":
+			s = 0
+		default:
+			continue
+		}
+		if s <= specificity {
+			continue
+		}
+
+		rangeQ := 1.0
+		if v, ok := params["q"]; ok {
+			if rangeQ, err = strconv.ParseFloat(v, 64); err != nil {
+				continue
+			}
+		}
+		q, specificity = rangeQ, s
+	}
+	return q
+}
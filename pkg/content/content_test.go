@@ -0,0 +1,136 @@
+package content
+
+import (
+	"bytes"
+	"html/template"
+	"mime/multipart"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+)
+
+type sloth struct {
+	Name string `form:"name" json:"name" validate:"required,max=8"`
+	Age  int    `form:"age" json:"age"`
+}
+
+func decode(contentType, body string) (sloth, error) {
+	var s sloth
+	r := httptest.NewRequest("POST", "/sloths", strings.NewReader(body))
+	if contentType != "" {
+		r.Header.Set("Content-Type", contentType)
+	}
+	err := Decode(httptest.NewRecorder(), r, &s)
+	return s, err
+}
+
+func TestDecodeFormats(t *testing.T) {
+	var multi bytes.Buffer
+	mw := multipart.NewWriter(&multi)
+	mw.WriteField("name", "Larry")
+	mw.WriteField("age", "12")
+	mw.Close()
+
+	tests := []struct {
+		contentType, body string
+	}{
+		{"application/json", `{"name": "Larry", "age": 12}`},
+		{"application/json; charset=utf-8", `{"name": "Larry", "age": 12}`},
+		{"application/x-www-form-urlencoded", "name=Larry&age=12"},
+		{mw.FormDataContentType(), multi.String()},
+	}
+	for _, test := range tests {
+		s, err := decode(test.contentType, test.body)
+		if err != nil {
+			t.Errorf("Decoding %q expected no error, got %v", test.contentType, err)
+		} else if s != (sloth{"Larry", 12}) {
+			t.Errorf("Decoding %q expected {Larry 12}, got %+v", test.contentType, s)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	tests := []struct {
+		contentType, body string
+		status            int
+	}{
+		{"application/json", `{"name": "Larry"`, 400},
+		{"application/json", `{"name": "Larry"} {}`, 400},
+		{"application/json", `{"name": ""}`, 422},
+		{"application/json", `{"name": "Larry", "age": "twelve"}`, 422},
+		{"application/json", `{"name": "` + strings.Repeat("a", form.MaxBodyBytes) + `"}`, 413},
+		{"text/csv", "Larry,12", 415},
+		{"not a media type", "", 415},
+	}
+	for _, test := range tests {
+		_, err := decode(test.contentType, test.body)
+		if status := Status(err); status != test.status {
+			t.Errorf("Status decoding %q %.20q expected %d, got %d (%v)",
+				test.contentType, test.body, test.status, status, err)
+		}
+	}
+
+	_, err := decode("application/json", `{"name": "Larry", "age": "twelve"}`)
+	if expected := (form.Errors{"age": "age must be a number"}); !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Error for a mistyped JSON field expected %v, got %v", expected, err)
+	}
+}
+
+func TestNegotiate(t *testing.T) {
+	offers := []string{HTMLType, JSONType, TextType}
+	tests := map[string]string{
+		"":                                  HTMLType,
+		"*/*":                               HTMLType,
+		"application/json":                  JSONType,
+		"text/*":                            HTMLType,
+		"text/*, text/html;q=0":             TextType,
+		"text/plain, */*;q=0.1":             TextType,
+		"text/html;q=0.5, application/json": JSONType,
+		"application/json;q=0.5, text/html;q=0.5": HTMLType,
+		"image/png":                 "",
+		"application/json;q=0, */*": HTMLType,
+	}
+	for accept, expected := range tests {
+		if got := Negotiate(accept, offers...); got != expected {
+			t.Errorf("Negotiate(%q) expected %q, got %q", accept, expected, got)
+		}
+	}
+}
+
+func TestRespond(t *testing.T) {
+	tmpl := template.Must(template.New("sloth").Parse("<b>{{.Name}}</b>"))
+	s := sloth{"<Larry>", 12}
+	tests := []struct {
+		accept, contentType, body string
+	}{
+		{"text/html", "text/html; charset=utf-8", "<b>&lt;Larry&gt;</b>"},
+		{"application/json", "application/json", `{"name":"\u003cLarry\u003e","age":12}` + "\n"},
+		{"text/plain", "text/plain; charset=utf-8", "<Larry> is 12\n"},
+	}
+	for _, test := range tests {
+		r := httptest.NewRequest("GET", "/sloths", nil)
+		r.Header.Set("Accept", test.accept)
+		w := httptest.NewRecorder()
+		Respond(w, r, 201, HTML(tmpl, s), JSON(s), Text("%s is %d", s.Name, s.Age))
+
+		if w.Code != 201 || w.Header().Get("Content-Type") != test.contentType ||
+			w.Body.String() != test.body {
+			t.Errorf("Response for %s expected 201 %s %q, got %d %s %q", test.accept,
+				test.contentType, test.body, w.Code, w.Header().Get("Content-Type"), w.Body.String())
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept" {
+			t.Errorf("Vary header expected Accept, got %q", vary)
+		}
+	}
+
+	r := httptest.NewRequest("GET", "/sloths", nil)
+	r.Header.Set("Accept", "image/png")
+	w := httptest.NewRecorder()
+	Respond(w, r, 200, JSON(s))
+	if w.Code != 406 {
+		t.Fatalf("Status for an unacceptable response expected 406, got %d", w.Code)
+	}
+}
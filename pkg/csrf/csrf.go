@@ -0,0 +1,243 @@
+//Package csrf protects forms from cross-site request forgery with signed
+//double-submit cookies: a request that changes something has to send back
+//a token matching the one in a cookie this server signed, which another
+//site's form has no way of knowing.
+package csrf
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"crypto/subtle"
+	"encoding/base64"
+	"encoding/hex"
+	"fmt"
+	"html/template"
+	"mime"
+	"net/http"
+	"os"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+)
+
+//Defaults for the cookie, form field and header tokens are sent in
+const (
+	DefaultCookieName = "csrf_token"
+	DefaultFieldName  = "csrf_token"
+	DefaultHeaderName = "X-CSRF-Token"
+)
+
+//KeyEnv is the environment variable KeyFromEnv reads the key from, as hex
+const KeyEnv = "MEAN_GOPHER_CSRF_KEY"
+
+const tokenLength = 32
+
+//A Protector is CSRF protection middleware. Requests with safe methods
+//(GET, HEAD, OPTIONS and TRACE) are given a token cookie if they don't have
+//one; any other request needs the token in its form or header, or it's
+//rejected with a 403 Forbidden.
+//
+//Requests with a body no HTML form can send, like JSON, are let through
+//without a token, since browsers only send those cross-origin if the
+//server allows it with CORS.
+type Protector struct {
+	//Key signs the token cookies
+	Key []byte
+	//CookieName, FieldName and HeaderName default to DefaultCookieName,
+	//DefaultFieldName and DefaultHeaderName
+	CookieName string
+	FieldName  string
+	HeaderName string
+	//ErrorHandler responds to rejected requests. If it's nil, they get a
+	//plain text 403.
+	ErrorHandler http.Handler
+}
+
+//New makes a Protector signing its cookies with key
+func New(key []byte) *Protector {
+	return &Protector{Key: key}
+}
+
+//KeyFromEnv returns the hex key in the MEAN_GOPHER_CSRF_KEY environment
+//variable, or a random key if it's not set. With a random key, forms
+//served before the server restarts can't be submitted after it.
+func KeyFromEnv() ([]byte, error) {
+	if s := os.Getenv(KeyEnv); s != "" {
+		key, err := hex.DecodeString(s)
+		if err != nil {
+			return nil, fmt.Errorf("csrf: %s isn't hex: %w", KeyEnv, err)
+		}
+		return key, nil
+	}
+	key := make([]byte, 32)
+	_, err := rand.Read(key)
+	return key, err
+}
+
+type contextKey struct{}
+
+//Middleware protects next
+func (p *Protector) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		//Vary on Cookie so caches don't hand one client's token to another
+		w.Header().Add("Vary", "Cookie")
+
+		secret, haveCookie := p.readCookie(r)
+		if !haveCookie {
+			secret = make([]byte, tokenLength)
+			rand.Read(secret)
+		}
+
+		switch r.Method {
+		case "GET", "HEAD", "OPTIONS", "TRACE", "":
+		default:
+			//The token check parses the form, so limit the body like
+			//form.Decode does first
+			if r.Body != nil {
+				r.Body = http.MaxBytesReader(w, r.Body, form.MaxBodyBytes)
+			}
+			if formBody(r) && !(haveCookie && p.validToken(r, secret)) {
+				p.reject(w, r)
+				return
+			}
+		}
+
+		if !haveCookie {
+			http.SetCookie(w, &http.Cookie{
+				Name:     p.cookieName(),
+				Value:    p.sign(secret),
+				Path:     "/",
+				HttpOnly: true,
+				Secure:   r.TLS != nil,
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+		next.ServeHTTP(w, r.WithContext(context.WithValue(r.Context(), contextKey{}, secret)))
+	})
+}
+
+//Token returns a token for r to put in a form or header, or "" if r didn't
+//go through a Protector. Every call returns a different token, so the
+//token can't be guessed from a compressed response (the BREACH attack);
+//they all unmask to the same secret in the cookie.
+func Token(r *http.Request) string {
+	secret, ok := r.Context().Value(contextKey{}).([]byte)
+	if !ok {
+		return ""
+	}
+	masked := make([]byte, 2*tokenLength)
+	pad, xored := masked[:tokenLength], masked[tokenLength:]
+	rand.Read(pad)
+	subtle.XORBytes(xored, pad, secret)
+	return base64.RawURLEncoding.EncodeToString(masked)
+}
+
+//TemplateField returns a hidden input with r's token for an html/template
+//form, using DefaultFieldName, or "" if r didn't go through a Protector
+func TemplateField(r *http.Request) template.HTML {
+	token := Token(r)
+	if token == "" {
+		return ""
+	}
+	return template.HTML(fmt.Sprintf(`<input type="hidden" name="%s" value="%s">`,
+		DefaultFieldName, token))
+}
+
+//FuncMap returns template functions for r: csrfField, which returns
+//TemplateField(r), and csrfToken, which returns Token(r)
+func FuncMap(r *http.Request) template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML { return TemplateField(r) },
+		"csrfToken": func() string { return Token(r) },
+	}
+}
+
+//formBody reports whether r's body is one an HTML form could have sent
+func formBody(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	if ct == "" {
+		return true
+	}
+	mediaType, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return true
+	}
+	switch mediaType {
+	case "application/x-www-form-urlencoded", "multipart/form-data", "text/plain":
+		return true
+	}
+	return false
+}
+
+//validToken reports whether r sent a token matching secret
+func (p *Protector) validToken(r *http.Request, secret []byte) bool {
+	token := r.Header.Get(p.headerName())
+	if token == "" {
+		token = r.PostFormValue(p.fieldName())
+	}
+	masked, err := base64.RawURLEncoding.DecodeString(token)
+	if err != nil || len(masked) != 2*tokenLength {
+		return false
+	}
+	unmasked := make([]byte, tokenLength)
+	subtle.XORBytes(unmasked, masked[:tokenLength], masked[tokenLength:])
+	return subtle.ConstantTimeCompare(unmasked, secret) == 1
+}
+
+//readCookie returns the secret in r's token cookie if it has one this
+//server signed
+func (p *Protector) readCookie(r *http.Request) ([]byte, bool) {
+	c, err := r.Cookie(p.cookieName())
+	if err != nil {
+		return nil, false
+	}
+	b, err := base64.RawURLEncoding.DecodeString(c.Value)
+	if err != nil || len(b) != tokenLength+sha256.Size {
+		return nil, false
+	}
+	secret, mac := b[:tokenLength], b[tokenLength:]
+	if !hmac.Equal(mac, p.mac(secret)) {
+		return nil, false
+	}
+	return secret, true
+}
+
+func (p *Protector) sign(secret []byte) string {
+	return base64.RawURLEncoding.EncodeToString(append(append([]byte(nil), secret...), p.mac(secret)...))
+}
+
+func (p *Protector) mac(secret []byte) []byte {
+	m := hmac.New(sha256.New, p.Key)
+	m.Write(secret)
+	return m.Sum(nil)
+}
+
+func (p *Protector) reject(w http.ResponseWriter, r *http.Request) {
+	if p.ErrorHandler != nil {
+		p.ErrorHandler.ServeHTTP(w, r)
+		return
+	}
+	http.Error(w, "403 Forbidden: missing or invalid CSRF token", http.StatusForbidden)
+}
+
+func (p *Protector) cookieName() string {
+	if p.CookieName != "" {
+		return p.CookieName
+	}
+	return DefaultCookieName
+}
+
+func (p *Protector) fieldName() string {
+	if p.FieldName != "" {
+		return p.FieldName
+	}
+	return DefaultFieldName
+}
+
+func (p *Protector) headerName() string {
+	if p.HeaderName != "" {
+		return p.HeaderName
+	}
+	return DefaultHeaderName
+}
@@ -0,0 +1,140 @@
+package csrf
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var orderForm = template.Must(template.New("form").Parse(
+	`<form method="POST">{{.}}<input name="beverage"></form>`))
+
+//newServer serves the order form on GET and "order sent" on POST, behind
+//a Protector
+func newServer(p *Protector) http.Handler {
+	return p.Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Method == "POST" {
+			w.Write([]byte("order sent"))
+			return
+		}
+		orderForm.Execute(w, TemplateField(r))
+	}))
+}
+
+var tokenField = regexp.MustCompile(`name="csrf_token" value="([^"]+)"`)
+
+//getForm gets the order form, returning the token cookie and the token in
+//the form
+func getForm(t *testing.T, h http.Handler) (*http.Cookie, string) {
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/order-form", nil))
+
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != DefaultCookieName || !cookies[0].HttpOnly {
+		t.Fatalf("Form response expected an HttpOnly %s cookie, got %v", DefaultCookieName, cookies)
+	}
+	m := tokenField.FindStringSubmatch(w.Body.String())
+	if m == nil {
+		t.Fatalf("Form expected a hidden CSRF token field, got %q", w.Body.String())
+	}
+	return cookies[0], m[1]
+}
+
+func post(h http.Handler, cookie *http.Cookie, form url.Values, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("POST", "/send-order", strings.NewReader(form.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	if cookie != nil {
+		r.AddCookie(cookie)
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestValidToken(t *testing.T) {
+	h := newServer(New([]byte("sloth key")))
+	cookie, token := getForm(t, h)
+
+	w := post(h, cookie, url.Values{"beverage": {"tea"}, "csrf_token": {token}})
+	if w.Code != 200 || w.Body.String() != "order sent" {
+		t.Fatalf("POST with a valid token expected 200 \"order sent\", got %d %q", w.Code, w.Body.String())
+	}
+	if len(w.Result().Cookies()) != 0 {
+		t.Fatal("POST with a valid cookie expected not to get a new cookie")
+	}
+
+	w = post(h, cookie, url.Values{"beverage": {"tea"}}, DefaultHeaderName, token)
+	if w.Code != 200 {
+		t.Fatalf("POST with a valid token header expected 200, got %d", w.Code)
+	}
+}
+
+func TestRejected(t *testing.T) {
+	h := newServer(New([]byte("sloth key")))
+	cookie, token := getForm(t, h)
+	otherCookie, otherToken := getForm(t, h)
+	attackerCookie, attackerToken := getForm(t, newServer(New([]byte("attacker key"))))
+
+	tests := map[string]struct {
+		cookie *http.Cookie
+		token  string
+	}{
+		"no token":                     {cookie, ""},
+		"no cookie":                    {nil, token},
+		"garbage token":                {cookie, "not-a-token"},
+		"another client's token":       {cookie, otherToken},
+		"another client's cookie":      {otherCookie, token},
+		"cookie signed by another key": {attackerCookie, attackerToken},
+	}
+	for name, test := range tests {
+		w := post(h, test.cookie, url.Values{"beverage": {"tea"}, "csrf_token": {test.token}})
+		if w.Code != 403 {
+			t.Errorf("POST with %s expected 403, got %d", name, w.Code)
+		}
+	}
+}
+
+func TestTokensAreMasked(t *testing.T) {
+	h := newServer(New([]byte("sloth key")))
+	cookie, first := getForm(t, h)
+
+	r := httptest.NewRequest("GET", "/order-form", nil)
+	r.AddCookie(cookie)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	second := tokenField.FindStringSubmatch(w.Body.String())[1]
+
+	if first == second {
+		t.Fatal("Tokens for the same cookie expected to differ")
+	}
+	for _, token := range []string{first, second} {
+		if w := post(h, cookie, url.Values{"csrf_token": {token}}); w.Code != 200 {
+			t.Errorf("POST with either masked token expected 200, got %d", w.Code)
+		}
+	}
+}
+
+func TestJSONNotChecked(t *testing.T) {
+	h := newServer(New([]byte("sloth key")))
+	r := httptest.NewRequest("POST", "/send-order", strings.NewReader(`{"beverage": "tea"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != 200 {
+		t.Fatalf("JSON POST expected 200, got %d", w.Code)
+	}
+}
+
+func TestWithoutProtector(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	if Token(r) != "" || TemplateField(r) != "" {
+		t.Fatal("Token and TemplateField without a Protector expected \"\"")
+	}
+}
@@ -0,0 +1,315 @@
+//Package form binds submitted form fields into a struct and validates them
+//with rules declared in the struct's tags:
+//
+//	type Order struct {
+//		Name     string `form:"name" label:"Your name" validate:"required,max=64"`
+//		Beverage string `form:"beverage" validate:"required,oneof=coffee|tea"`
+//	}
+//
+//The form tag names the field's form key; without one the field is
+//skipped. The supported rules are required, min=N and max=N (a length for
+//strings, a value for numbers) and oneof=a|b|c, which for strings ignores
+//case. Checks that can't be written in a tag go in a Validate method; see
+//Validator.
+package form
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+//MaxBodyBytes is the largest request body Decode will read
+const MaxBodyBytes = 1 << 20
+
+//Errors maps form keys to what's wrong with their values. It's returned by
+//Decode and Validate when a form doesn't pass validation.
+type Errors map[string]string
+
+func (e Errors) Error() string {
+	keys := make([]string, 0, len(e))
+	for key := range e {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	msgs := make([]string, len(keys))
+	for i, key := range keys {
+		msgs[i] = e[key]
+	}
+	return strings.Join(msgs, "; ")
+}
+
+//Decode parses r's urlencoded or multipart form, binds it into the struct
+//dst points to and validates it. For a POST, PUT or PATCH request only
+//the body's fields are bound, so the URL's query can't fill in or change
+//fields the form didn't send; for other requests, the form is the query.
+//If the body can't be parsed, the error is the one from parsing it; if
+//fields are invalid, it's an Errors.
+func Decode(w http.ResponseWriter, r *http.Request, dst interface{}) error {
+	if r.Body != nil {
+		r.Body = http.MaxBytesReader(w, r.Body, MaxBodyBytes)
+	}
+	var values map[string][]string
+	if mediaType, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type")); mediaType == "multipart/form-data" {
+		if err := r.ParseMultipartForm(MaxBodyBytes); err != nil {
+			return err
+		}
+		values = r.MultipartForm.Value
+	} else {
+		if err := r.ParseForm(); err != nil {
+			return err
+		}
+		values = r.Form
+		if r.Method == "POST" || r.Method == "PUT" || r.Method == "PATCH" {
+			values = r.PostForm
+		}
+	}
+
+	errs := Bind(values, dst)
+	for key, msg := range Validate(dst) {
+		if _, ok := errs[key]; !ok {
+			errs[key] = msg
+		}
+	}
+	if len(errs) > 0 {
+		return errs
+	}
+	return nil
+}
+
+//Status returns the HTTP status code to respond to a Decode error with:
+//422 for invalid fields, 413 for a body over MaxBodyBytes and 400 for a
+//body that couldn't be parsed.
+func Status(err error) int {
+	var errs Errors
+	var tooLarge *http.MaxBytesError
+	switch {
+	case err == nil:
+		return http.StatusOK
+	case errors.As(err, &errs):
+		return http.StatusUnprocessableEntity
+	case errors.As(err, &tooLarge):
+		return http.StatusRequestEntityTooLarge
+	default:
+		return http.StatusBadRequest
+	}
+}
+
+//Bind copies values into the fields of the struct dst points to that have
+//form tags, trimming spaces around strings. Values that don't convert to
+//their field's type are reported in the returned Errors, which is empty if
+//there weren't any.
+func Bind(values map[string][]string, dst interface{}) Errors {
+	errs := make(Errors)
+	v := structValue(dst)
+	t := v.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		key := sf.Tag.Get("form")
+		if key == "" || key == "-" || len(values[key]) == 0 {
+			continue
+		}
+		if err := set(v.Field(i), strings.TrimSpace(values[key][0])); err != nil {
+			errs[key] = fmt.Sprintf("%s %s", label(sf), err)
+		}
+	}
+	return errs
+}
+
+func set(f reflect.Value, s string) error {
+	//An empty value leaves the field zero for the required rule to catch
+	if s == "" {
+		f.SetZero()
+		return nil
+	}
+
+	switch f.Kind() {
+	case reflect.String:
+		f.SetString(s)
+	case reflect.Bool:
+		//A checked checkbox with no value attribute sends "on"
+		if s == "on" {
+			s = "true"
+		}
+		b, err := strconv.ParseBool(s)
+		if err != nil {
+			return errors.New("must be true or false")
+		}
+		f.SetBool(b)
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		n, err := strconv.ParseInt(s, 10, f.Type().Bits())
+		if err != nil {
+			return errors.New("must be a whole number")
+		}
+		f.SetInt(n)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		n, err := strconv.ParseUint(s, 10, f.Type().Bits())
+		if err != nil {
+			return errors.New("must be a whole number that isn't negative")
+		}
+		f.SetUint(n)
+	case reflect.Float32, reflect.Float64:
+		n, err := strconv.ParseFloat(s, f.Type().Bits())
+		if err != nil {
+			return errors.New("must be a number")
+		}
+		f.SetFloat(n)
+	default:
+		panic("form: unsupported field type " + f.Type().String())
+	}
+	return nil
+}
+
+//A Validator is a struct with checks that can't be written as tag rules,
+//like a field that has to be one of a list kept in a variable. Validate
+//adds the Errors its Validate method returns to the ones from the tags,
+//keeping the tag's error for a field that has both.
+type Validator interface {
+	Validate() Errors
+}
+
+//Validate checks the struct v, or the struct v points to, against the
+//rules in its fields' validate tags, then with its Validate method if it's
+//a Validator. The returned Errors is nil if every field is valid.
+func Validate(v interface{}) Errors {
+	var errs Errors
+	sv := reflect.Indirect(reflect.ValueOf(v))
+	t := sv.Type()
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		rules := sf.Tag.Get("validate")
+		if rules == "" {
+			continue
+		}
+		if msg := check(sv.Field(i), rules); msg != "" {
+			if errs == nil {
+				errs = make(Errors)
+			}
+			key := sf.Tag.Get("form")
+			if key == "" {
+				key = sf.Name
+			}
+			errs[key] = label(sf) + " " + msg
+		}
+	}
+	if validator, ok := v.(Validator); ok {
+		for key, msg := range validator.Validate() {
+			if errs == nil {
+				errs = make(Errors)
+			}
+			if _, ok := errs[key]; !ok {
+				errs[key] = msg
+			}
+		}
+	}
+	return errs
+}
+
+//check returns what's wrong with f according to rules, or "" if f passes
+//all of them
+func check(f reflect.Value, rules string) string {
+	for _, rule := range strings.Split(rules, ",") {
+		name, arg, _ := strings.Cut(rule, "=")
+		switch name {
+		case "required":
+			if f.IsZero() {
+				return "is required"
+			}
+		case "min", "max":
+			n, err := strconv.ParseFloat(arg, 64)
+			if err != nil {
+				panic("form: bad " + name + " rule " + strconv.Quote(rule))
+			}
+			if f.Kind() == reflect.String {
+				length := float64(utf8.RuneCountInString(f.String()))
+				if name == "min" && length < n && length > 0 {
+					return fmt.Sprintf("must be at least %s characters", arg)
+				} else if name == "max" && length > n {
+					return fmt.Sprintf("must be at most %s characters", arg)
+				}
+				continue
+			}
+			x, ok := number(f)
+			if !ok {
+				panic("form: " + name + " rule on unsupported type " + f.Type().String())
+			}
+			if name == "min" && x < n {
+				return "must be at least " + arg
+			} else if name == "max" && x > n {
+				return "must be at most " + arg
+			}
+		case "oneof":
+			if f.IsZero() {
+				//Leave empty values to the required rule
+				continue
+			}
+			choices := strings.Split(arg, "|")
+			if !oneOf(f, choices) {
+				return "must be one of " + strings.Join(choices, ", ")
+			}
+		default:
+			panic("form: unknown validation rule " + strconv.Quote(rule))
+		}
+	}
+	return ""
+}
+
+func number(f reflect.Value) (float64, bool) {
+	switch {
+	case f.CanInt():
+		return float64(f.Int()), true
+	case f.CanUint():
+		return float64(f.Uint()), true
+	case f.CanFloat():
+		return f.Float(), true
+	}
+	return 0, false
+}
+
+func oneOf(f reflect.Value, choices []string) bool {
+	if f.Kind() == reflect.String {
+		return OneOf(f.String(), choices)
+	}
+	s := fmt.Sprint(f.Interface())
+	for _, choice := range choices {
+		if s == choice {
+			return true
+		}
+	}
+	return false
+}
+
+//OneOf is whether s is one of choices, ignoring case like the oneof rule
+func OneOf(s string, choices []string) bool {
+	for _, choice := range choices {
+		if strings.EqualFold(s, choice) {
+			return true
+		}
+	}
+	return false
+}
+
+func label(sf reflect.StructField) string {
+	if l := sf.Tag.Get("label"); l != "" {
+		return l
+	}
+	if key := sf.Tag.Get("form"); key != "" && key != "-" {
+		return key
+	}
+	return sf.Name
+}
+
+func structValue(dst interface{}) reflect.Value {
+	v := reflect.ValueOf(dst)
+	if v.Kind() != reflect.Pointer || v.Elem().Kind() != reflect.Struct {
+		panic("form: destination must be a pointer to a struct, not " + v.Type().String())
+	}
+	return v.Elem()
+}
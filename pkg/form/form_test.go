@@ -0,0 +1,159 @@
+package form
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+)
+
+type sloth struct {
+	Name    string  `form:"name" label:"Name" validate:"required,min=2,max=8"`
+	Species string  `form:"species" validate:"oneof=two-toed|three-toed"`
+	Age     int     `form:"age" validate:"min=0,max=40"`
+	Speed   float64 `form:"speed"`
+	Sleepy  bool    `form:"sleepy"`
+	Secret  string
+}
+
+func post(body string) *http.Request {
+	r := httptest.NewRequest("POST", "/sloths", strings.NewReader(body))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	return r
+}
+
+func TestDecode(t *testing.T) {
+	var s sloth
+	body := url.Values{"name": {" Larry "}, "species": {"Three-Toed"}, "age": {"12"},
+		"speed": {"0.24"}, "sleepy": {"on"}, "Secret": {"hi"}}.Encode()
+	if err := Decode(httptest.NewRecorder(), post(body), &s); err != nil {
+		t.Fatal(err)
+	}
+
+	expected := sloth{Name: "Larry", Species: "Three-Toed", Age: 12, Speed: 0.24, Sleepy: true}
+	if s != expected {
+		t.Fatalf("Decoded sloth expected %+v, got %+v", expected, s)
+	}
+}
+
+func TestDecodeIgnoresQueryForPost(t *testing.T) {
+	var multipartBody bytes.Buffer
+	mw := multipart.NewWriter(&multipartBody)
+	mw.WriteField("species", "two-toed")
+	mw.Close()
+	multipartPost := httptest.NewRequest("POST", "/sloths", &multipartBody)
+	multipartPost.Header.Set("Content-Type", mw.FormDataContentType())
+
+	for _, r := range []*http.Request{post(url.Values{"species": {"two-toed"}}.Encode()), multipartPost} {
+		//The query's name can't stand in for the one the form didn't send,
+		//and its species can't change the form's
+		r.URL.RawQuery = url.Values{"name": {"Larry"}, "species": {"three-toed"}}.Encode()
+		var s sloth
+		err := Decode(httptest.NewRecorder(), r, &s)
+		expected := Errors{"name": "Name is required"}
+		if !reflect.DeepEqual(err, expected) {
+			t.Errorf("Decode errors for %s expected %v, got %v", r.Header.Get("Content-Type"), expected, err)
+		}
+		if s.Species != "two-toed" {
+			t.Errorf("Species for %s expected the form's two-toed, got %q", r.Header.Get("Content-Type"), s.Species)
+		}
+	}
+}
+
+func TestDecodeErrors(t *testing.T) {
+	body := url.Values{"name": {"Larry the sloth"}, "species": {"koala"},
+		"age": {"twelve"}, "sleepy": {"maybe"}}.Encode()
+	err := Decode(httptest.NewRecorder(), post(body), &sloth{})
+
+	expected := Errors{
+		"name":    "Name must be at most 8 characters",
+		"species": "species must be one of two-toed, three-toed",
+		"age":     "age must be a whole number",
+		"sleepy":  "sleepy must be true or false",
+	}
+	if !reflect.DeepEqual(err, expected) {
+		t.Fatalf("Decode errors expected %v, got %v", expected, err)
+	}
+	if status := Status(err); status != 422 {
+		t.Fatalf("Status for invalid fields expected 422, got %d", status)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		s    sloth
+		errs Errors
+	}{
+		{sloth{Name: "Larry"}, nil},
+		{sloth{}, Errors{"name": "Name is required"}},
+		{sloth{Name: "L"}, Errors{"name": "Name must be at least 2 characters"}},
+		{sloth{Name: "Larry", Age: 41}, Errors{"age": "age must be at most 40"}},
+		{sloth{Name: "Larry", Age: -1}, Errors{"age": "age must be at least 0"}},
+		{sloth{Name: "Larry", Species: "TWO-TOED"}, nil},
+	}
+	for _, test := range tests {
+		if errs := Validate(test.s); !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("Validate(%+v) expected %v, got %v", test.s, test.errs, errs)
+		}
+	}
+}
+
+//nap has a check its tags can't express
+type nap struct {
+	Sloth string `form:"sloth" validate:"required"`
+	Hours int    `form:"hours"`
+}
+
+var sleepers = []string{"Larry", "Moe"}
+
+func (n nap) Validate() Errors {
+	errs := Errors{}
+	if n.Sloth != "" && !OneOf(n.Sloth, sleepers) {
+		errs["sloth"] = "sloth must be a sleeper"
+	}
+	if n.Hours > 20 {
+		errs["hours"] = "hours is too long"
+	}
+	return errs
+}
+
+func TestValidator(t *testing.T) {
+	tests := []struct {
+		n    nap
+		errs Errors
+	}{
+		{nap{Sloth: "larry", Hours: 15}, nil},
+		{nap{Sloth: "Curly"}, Errors{"sloth": "sloth must be a sleeper"}},
+		//The tag's error wins for a field that has both
+		{nap{Hours: 21}, Errors{"sloth": "sloth is required", "hours": "hours is too long"}},
+	}
+	for _, test := range tests {
+		if errs := Validate(&test.n); !reflect.DeepEqual(errs, test.errs) {
+			t.Errorf("Validate(%+v) expected %v, got %v", test.n, test.errs, errs)
+		}
+	}
+}
+
+func TestDecodeBadBody(t *testing.T) {
+	err := Decode(httptest.NewRecorder(), post("name=%zz"), &sloth{})
+	if status := Status(err); status != 400 {
+		t.Fatalf("Status for a malformed body expected 400, got %d (%v)", status, err)
+	}
+
+	big := "name=" + strings.Repeat("a", MaxBodyBytes)
+	err = Decode(httptest.NewRecorder(), post(big), &sloth{})
+	if status := Status(err); status != 413 {
+		t.Fatalf("Status for a body over MaxBodyBytes expected 413, got %d (%v)", status, err)
+	}
+}
+
+func TestErrorsError(t *testing.T) {
+	errs := Errors{"b": "b is required", "a": "a is required"}
+	if msg := errs.Error(); msg != "a is required; b is required" {
+		t.Fatalf("Error message expected \"a is required; b is required\", got %q", msg)
+	}
+}
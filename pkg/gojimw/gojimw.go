@@ -0,0 +1,34 @@
+//Package gojimw adapts this repo's middleware to Goji, for middleware that
+//needs to put things in a Goji web.C's Env.
+package gojimw
+
+import (
+	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+	"github.com/zenazn/goji/web"
+)
+
+//RequestIDKey is the c.Env key RequestID stores the request ID under
+const RequestIDKey = "requestID"
+
+//RequestID is requestid.Middleware as Goji middleware: along with putting
+//the request ID in the request's context and response header, it stores it
+//in c.Env[RequestIDKey] for Goji handlers.
+func RequestID(c *web.C, h http.Handler) http.Handler {
+	setEnv := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if c.Env == nil {
+			c.Env = make(map[interface{}]interface{})
+		}
+		c.Env[RequestIDKey] = requestid.Get(r)
+		h.ServeHTTP(w, r)
+	})
+	return requestid.Middleware(setEnv)
+}
+
+//GetRequestID returns the request ID RequestID stored in c.Env, or "" if
+//there isn't one.
+func GetRequestID(c web.C) string {
+	id, _ := c.Env[RequestIDKey].(string)
+	return id
+}
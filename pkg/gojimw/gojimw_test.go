@@ -0,0 +1,31 @@
+package gojimw
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+	"github.com/zenazn/goji/web"
+)
+
+func TestRequestIDInEnv(t *testing.T) {
+	m := web.New()
+	m.Use(RequestID)
+	m.Get("/sloths", func(c web.C, w http.ResponseWriter, r *http.Request) {
+		fmt.Fprintf(w, "%s %s", GetRequestID(c), requestid.Get(r))
+	})
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/sloths", nil)
+	r.Header.Set(requestid.Header, "sloth-7")
+	m.ServeHTTP(w, r)
+
+	if w.Body.String() != "sloth-7 sloth-7" {
+		t.Fatalf("Request ID in c.Env and the context expected sloth-7, got %q", w.Body.String())
+	}
+	if id := w.Header().Get(requestid.Header); id != "sloth-7" {
+		t.Fatalf("Echoed request ID expected sloth-7, got %q", id)
+	}
+}
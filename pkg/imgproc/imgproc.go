@@ -0,0 +1,567 @@
+//Package imgproc resizes, crops and converts images on the fly for URLs
+//like /img/sloth.jpg?w=200&h=200&fit=cover&fmt=png, using only the
+//standard library's image packages. It's middleware for a file server
+//route: requests without any of its query parameters go to the file
+//server unchanged.
+package imgproc
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"image"
+	"image/color"
+	"image/draw"
+	"image/gif"
+	"image/jpeg"
+	"image/png"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/static"
+)
+
+//Defaults for the Options limits
+const (
+	DefaultMaxWidth        = 2048
+	DefaultMaxHeight       = 2048
+	DefaultMaxSourcePixels = 40 * 1000 * 1000
+	DefaultJPEGQuality     = 85
+	DefaultMaxCacheBytes   = 256 << 20
+)
+
+//Fits are the values of the fit query parameter. With both w and h,
+//contain scales the image to fit inside them, cover scales and crops it to
+//fill them and fill stretches it to them. With only one of them, the image
+//is scaled to it, keeping its aspect ratio.
+var Fits = []string{"contain", "cover", "fill"}
+
+//Formats maps the values of the fmt query parameter to the formats
+//images can be converted to
+var Formats = map[string]string{"jpeg": "jpeg", "jpg": "jpeg", "png": "png", "gif": "gif"}
+
+var contentTypes = map[string]string{"jpeg": "image/jpeg", "png": "image/png", "gif": "image/gif"}
+
+//Options configure a Processor
+type Options struct {
+	//MaxWidth and MaxHeight limit the size of processed images. They
+	//default to DefaultMaxWidth and DefaultMaxHeight.
+	MaxWidth  int
+	MaxHeight int
+	//MaxSourcePixels limits the size of the images that are decoded to be
+	//processed, checked before they're decoded. It defaults to
+	//DefaultMaxSourcePixels.
+	MaxSourcePixels int
+	//JPEGQuality defaults to DefaultJPEGQuality
+	JPEGQuality int
+	//CacheDir is the directory processed images are cached in. If it's "",
+	//they're processed again for every request.
+	CacheDir string
+	//MaxCacheBytes limits the size of the images in CacheDir. Once they
+	//add up to more, the ones used least recently are removed. It
+	//defaults to DefaultMaxCacheBytes.
+	MaxCacheBytes int64
+	//MaxConcurrent limits how many images are decoded and processed at
+	//once, since each one takes a CPU and its pixels in memory. It
+	//defaults to runtime.GOMAXPROCS(0).
+	MaxConcurrent int
+}
+
+//A Params is what a request asks to be done to an image
+type Params struct {
+	Width, Height int
+	Fit           string
+	Format        string
+	Quality       int
+}
+
+//A Processor processes the images in a file system
+type Processor struct {
+	fsys fs.FS
+	opts Options
+	//sem holds a token for each image being processed
+	sem chan struct{}
+
+	mu    sync.Mutex
+	calls map[string]*call
+
+	cacheMu sync.Mutex
+	//cacheBytes is the size of the cached images, or -1 before CacheDir
+	//is first measured
+	cacheBytes int64
+}
+
+//A call is an image being processed, which concurrent requests for the
+//same processed image wait for instead of processing it again
+type call struct {
+	done   chan struct{}
+	b      []byte
+	format string
+	err    error
+}
+
+//New makes a Processor for the images in fsys
+func New(fsys fs.FS, opts Options) *Processor {
+	if opts.MaxWidth <= 0 {
+		opts.MaxWidth = DefaultMaxWidth
+	}
+	if opts.MaxHeight <= 0 {
+		opts.MaxHeight = DefaultMaxHeight
+	}
+	if opts.MaxSourcePixels <= 0 {
+		opts.MaxSourcePixels = DefaultMaxSourcePixels
+	}
+	if opts.JPEGQuality <= 0 {
+		opts.JPEGQuality = DefaultJPEGQuality
+	}
+	if opts.MaxCacheBytes <= 0 {
+		opts.MaxCacheBytes = DefaultMaxCacheBytes
+	}
+	if opts.MaxConcurrent <= 0 {
+		opts.MaxConcurrent = runtime.GOMAXPROCS(0)
+	}
+	return &Processor{
+		fsys:       fsys,
+		opts:       opts,
+		sem:        make(chan struct{}, opts.MaxConcurrent),
+		calls:      make(map[string]*call),
+		cacheBytes: -1,
+	}
+}
+
+//Middleware processes images for requests with any of the w, h, fit, fmt
+//or q query parameters, passing other requests to next. Like a file
+//server, it takes the image's name from the request's URL path, so it goes
+//after http.StripPrefix.
+func (p *Processor) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		q := r.URL.Query()
+		if !q.Has("w") && !q.Has("h") && !q.Has("fit") && !q.Has("fmt") && !q.Has("q") {
+			next.ServeHTTP(w, r)
+			return
+		}
+		p.ServeHTTP(w, r)
+	})
+}
+
+func (p *Processor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" && r.Method != "HEAD" && r.Method != "" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	params, err := p.ParseParams(r)
+	if err != nil {
+		http.Error(w, "400 Bad Request: "+err.Error(), http.StatusBadRequest)
+		return
+	}
+	name := strings.TrimPrefix(path.Clean("/"+r.URL.Path), "/")
+	if static.Hidden(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	info, err := fs.Stat(p.fsys, name)
+	if err != nil || info.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+
+	key := cacheKey(name, info, params)
+	b, format, err := p.processed(name, key, params)
+	if errors.Is(err, fs.ErrNotExist) {
+		http.NotFound(w, r)
+		return
+	}
+	var tooLarge *TooLargeError
+	if errors.As(err, &tooLarge) {
+		http.Error(w, "422 Unprocessable Entity: "+err.Error(), http.StatusUnprocessableEntity)
+		return
+	}
+	if errors.Is(err, image.ErrFormat) {
+		http.Error(w, "415 Unsupported Media Type: not an image", http.StatusUnsupportedMediaType)
+		return
+	}
+	if err != nil {
+		log.Printf("imgproc: %s: %v", name, err)
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+
+	w.Header().Set("Content-Type", contentTypes[format])
+	w.Header().Set("ETag", `"`+key[:32]+`"`)
+	http.ServeContent(w, r, "", info.ModTime(), bytes.NewReader(b))
+}
+
+//ParseParams reads a Params from r's query, checking them against the
+//Processor's limits
+func (p *Processor) ParseParams(r *http.Request) (Params, error) {
+	q := r.URL.Query()
+	var params Params
+	var err error
+	if params.Width, err = queryInt(q.Get("w"), "w", p.opts.MaxWidth); err != nil {
+		return params, err
+	}
+	if params.Height, err = queryInt(q.Get("h"), "h", p.opts.MaxHeight); err != nil {
+		return params, err
+	}
+	if params.Quality, err = queryInt(q.Get("q"), "q", 100); err != nil {
+		return params, err
+	}
+
+	params.Fit = strings.ToLower(q.Get("fit"))
+	switch params.Fit {
+	case "":
+		params.Fit = "contain"
+	case "contain", "cover", "fill":
+	default:
+		return params, fmt.Errorf("fit must be one of %s", strings.Join(Fits, ", "))
+	}
+
+	if f := q.Get("fmt"); f != "" {
+		var ok bool
+		if params.Format, ok = Formats[strings.ToLower(f)]; !ok {
+			return params, errors.New("fmt must be jpeg, png or gif")
+		}
+	}
+	return params, nil
+}
+
+func queryInt(s, name string, limit int) (int, error) {
+	if s == "" {
+		return 0, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < 1 || n > limit {
+		return 0, fmt.Errorf("%s must be a number from 1 to %d", name, limit)
+	}
+	return n, nil
+}
+
+//A TooLargeError is returned for images with more pixels than
+//Options.MaxSourcePixels
+type TooLargeError struct {
+	Width, Height, Max int
+}
+
+func (err *TooLargeError) Error() string {
+	return fmt.Sprintf("the image is %dx%d, more than the %d pixels images can have to be processed",
+		err.Width, err.Height, err.Max)
+}
+
+//cacheKey is the hex SHA-256 of everything a processed image depends on:
+//the source image's name, modification time and size and the params
+func cacheKey(name string, info fs.FileInfo, params Params) string {
+	sum := sha256.Sum256([]byte(fmt.Sprintf("%s\x00%d\x00%d\x00%+v",
+		name, info.ModTime().UnixNano(), info.Size(), params)))
+	return hex.EncodeToString(sum[:])
+}
+
+//processed returns the image name processed with params, and its format.
+//Concurrent requests for the same processed image share one call to load.
+func (p *Processor) processed(name, key string, params Params) ([]byte, string, error) {
+	p.mu.Lock()
+	if c, ok := p.calls[key]; ok {
+		p.mu.Unlock()
+		<-c.done
+		return c.b, c.format, c.err
+	}
+	c := &call{done: make(chan struct{})}
+	p.calls[key] = c
+	p.mu.Unlock()
+
+	c.b, c.format, c.err = p.load(name, key, params)
+
+	p.mu.Lock()
+	delete(p.calls, key)
+	p.mu.Unlock()
+	close(c.done)
+	return c.b, c.format, c.err
+}
+
+//load returns the processed image from the cache if it's there, and
+//processes and caches it if it isn't
+func (p *Processor) load(name, key string, params Params) ([]byte, string, error) {
+	if p.opts.CacheDir == "" {
+		return p.process(name, params)
+	}
+
+	cached := filepath.Join(p.opts.CacheDir, key[:2], key)
+	if b, err := os.ReadFile(cached); err == nil && len(b) > 0 {
+		//The format is the cached file's first line
+		if format, data, ok := bytes.Cut(b, []byte("\n")); ok {
+			//The modification time is when the image was last used, for
+			//evicting the least recently used ones
+			now := time.Now()
+			os.Chtimes(cached, now, now)
+			return data, string(format), nil
+		}
+	}
+
+	b, format, err := p.process(name, params)
+	if err != nil {
+		return nil, "", err
+	}
+	if err := writeCache(cached, format, b); err != nil {
+		//The image can still be served; it'll just be processed again
+		log.Printf("imgproc: caching %s: %v", name, err)
+		return b, format, nil
+	}
+	if err := p.cached(int64(len(format) + 1 + len(b))); err != nil {
+		log.Printf("imgproc: evicting cached images: %v", err)
+	}
+	return b, format, nil
+}
+
+//cached adds n bytes written to the cache to its size, and once it's over
+//Options.MaxCacheBytes, removes the images used least recently until it
+//isn't
+func (p *Processor) cached(n int64) error {
+	p.cacheMu.Lock()
+	defer p.cacheMu.Unlock()
+	if p.cacheBytes >= 0 {
+		p.cacheBytes += n
+		if p.cacheBytes <= p.opts.MaxCacheBytes {
+			return nil
+		}
+	}
+
+	//The directory is measured the first time, since it can have images
+	//cached by an earlier run, and when it's over the limit, since other
+	//processes can share it
+	files, total, err := cacheFiles(p.opts.CacheDir)
+	if err != nil {
+		return err
+	}
+	sort.Slice(files, func(i, j int) bool { return files[i].used.Before(files[j].used) })
+	for _, f := range files {
+		if total <= p.opts.MaxCacheBytes {
+			break
+		}
+		if err := os.Remove(f.path); err != nil && !errors.Is(err, fs.ErrNotExist) {
+			return err
+		}
+		total -= f.size
+	}
+	p.cacheBytes = total
+	return nil
+}
+
+//A cacheFile is a processed image in the cache
+type cacheFile struct {
+	path string
+	size int64
+	used time.Time
+}
+
+//cacheFiles lists the images in the cache directory dir, leaving out
+//temporary files that are still being written, and adds up their sizes
+func cacheFiles(dir string) ([]cacheFile, int64, error) {
+	var files []cacheFile
+	var total int64
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			if errors.Is(err, fs.ErrNotExist) {
+				return nil
+			}
+			return err
+		}
+		if d.IsDir() || strings.HasPrefix(d.Name(), ".") {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil {
+			//Removed since the directory was read
+			return nil
+		}
+		files = append(files, cacheFile{path, info.Size(), info.ModTime()})
+		total += info.Size()
+		return nil
+	})
+	return files, total, err
+}
+
+//writeCache writes a processed image to the cache file path, through a
+//temporary file so a request never reads half of one
+func writeCache(path, format string, b []byte) error {
+	if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(path), ".tmp-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := fmt.Fprintf(tmp, "%s\n", format); err != nil {
+		tmp.Close()
+		return err
+	}
+	if _, err := tmp.Write(b); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), path)
+}
+
+//process decodes the image name, transforms it and encodes it in the
+//format params asks for, or the format it was in
+func (p *Processor) process(name string, params Params) ([]byte, string, error) {
+	f, err := p.fsys.Open(name)
+	if err != nil {
+		return nil, "", err
+	}
+	defer f.Close()
+	rs, ok := f.(io.ReadSeeker)
+	if !ok {
+		b, err := io.ReadAll(f)
+		if err != nil {
+			return nil, "", err
+		}
+		rs = bytes.NewReader(b)
+	}
+
+	config, format, err := image.DecodeConfig(rs)
+	if err != nil {
+		return nil, "", err
+	}
+	if config.Width*config.Height > p.opts.MaxSourcePixels {
+		return nil, "", &TooLargeError{config.Width, config.Height, p.opts.MaxSourcePixels}
+	}
+
+	//Wait for a turn to decode and resize the image, so a burst of
+	//requests can't make every image's pixels be in memory at once
+	p.sem <- struct{}{}
+	defer func() { <-p.sem }()
+	if _, err := rs.Seek(0, io.SeekStart); err != nil {
+		return nil, "", err
+	}
+	src, _, err := image.Decode(rs)
+	if err != nil {
+		return nil, "", err
+	}
+
+	dst := Transform(src, params)
+	if params.Format != "" {
+		format = params.Format
+	}
+
+	var buf bytes.Buffer
+	switch format {
+	case "jpeg":
+		quality := params.Quality
+		if quality == 0 {
+			quality = p.opts.JPEGQuality
+		}
+		err = jpeg.Encode(&buf, flatten(dst), &jpeg.Options{Quality: quality})
+	case "gif":
+		err = gif.Encode(&buf, dst, nil)
+	default:
+		format = "png"
+		err = png.Encode(&buf, dst)
+	}
+	return buf.Bytes(), format, err
+}
+
+//Transform resizes and crops src like params asks
+func Transform(src image.Image, params Params) image.Image {
+	b := src.Bounds()
+	sw, sh := b.Dx(), b.Dy()
+	w, h := params.Width, params.Height
+	crop := b
+
+	switch {
+	case w == 0 && h == 0:
+		return src
+	case w == 0:
+		w = max(1, (sw*h+sh/2)/sh)
+	case h == 0:
+		h = max(1, (sh*w+sw/2)/sw)
+	case params.Fit == "cover":
+		//Crop the middle of src to the aspect ratio of w x h
+		if sw*h > sh*w {
+			cw := max(1, (sh*w+h/2)/h)
+			crop.Min.X += (sw - cw) / 2
+			crop.Max.X = crop.Min.X + cw
+		} else {
+			ch := max(1, (sw*h+w/2)/w)
+			crop.Min.Y += (sh - ch) / 2
+			crop.Max.Y = crop.Min.Y + ch
+		}
+	case params.Fit == "fill":
+	default:
+		//contain: shrink whichever side would stick out
+		if sw*h > sh*w {
+			h = max(1, (sh*w+sw/2)/sw)
+		} else {
+			w = max(1, (sw*h+sh/2)/sh)
+		}
+	}
+	return resize(src, crop, w, h)
+}
+
+//resize scales the part of src in crop to w x h, making each destination
+//pixel the average of the source pixels it covers, weighted by how much
+//of each it covers
+func resize(src image.Image, crop image.Rectangle, w, h int) *image.RGBA {
+	s := image.NewRGBA(image.Rect(0, 0, crop.Dx(), crop.Dy()))
+	draw.Draw(s, s.Bounds(), src, crop.Min, draw.Src)
+	dst := image.NewRGBA(image.Rect(0, 0, w, h))
+
+	sx := float64(crop.Dx()) / float64(w)
+	sy := float64(crop.Dy()) / float64(h)
+	for y := 0; y < h; y++ {
+		y0, y1 := float64(y)*sy, float64(y+1)*sy
+		for x := 0; x < w; x++ {
+			x0, x1 := float64(x)*sx, float64(x+1)*sx
+			var r, g, b, a, total float64
+			for py := int(y0); float64(py) < y1 && py < crop.Dy(); py++ {
+				wy := min(y1, float64(py+1)) - max(y0, float64(py))
+				for px := int(x0); float64(px) < x1 && px < crop.Dx(); px++ {
+					weight := wy * (min(x1, float64(px+1)) - max(x0, float64(px)))
+					i := s.PixOffset(px, py)
+					r += weight * float64(s.Pix[i])
+					g += weight * float64(s.Pix[i+1])
+					b += weight * float64(s.Pix[i+2])
+					a += weight * float64(s.Pix[i+3])
+					total += weight
+				}
+			}
+			if total == 0 {
+				continue
+			}
+			i := dst.PixOffset(x, y)
+			dst.Pix[i] = uint8(r/total + 0.5)
+			dst.Pix[i+1] = uint8(g/total + 0.5)
+			dst.Pix[i+2] = uint8(b/total + 0.5)
+			dst.Pix[i+3] = uint8(a/total + 0.5)
+		}
+	}
+	return dst
+}
+
+//flatten draws img on white, since JPEGs can't be transparent
+func flatten(img image.Image) image.Image {
+	if opaque, ok := img.(interface{ Opaque() bool }); ok && opaque.Opaque() {
+		return img
+	}
+	dst := image.NewRGBA(img.Bounds())
+	draw.Draw(dst, dst.Bounds(), image.NewUniform(color.White), image.Point{}, draw.Src)
+	draw.Draw(dst, dst.Bounds(), img, img.Bounds().Min, draw.Over)
+	return dst
+}
@@ -0,0 +1,366 @@
+package imgproc
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"image/color"
+	"image/jpeg"
+	"image/png"
+	"io/fs"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+var (
+	red  = color.RGBA{255, 0, 0, 255}
+	blue = color.RGBA{0, 0, 255, 255}
+)
+
+//flag is a 400x200 PNG, red on the left half and blue on the right
+func flag(t *testing.T) []byte {
+	img := image.NewRGBA(image.Rect(0, 0, 400, 200))
+	for y := 0; y < 200; y++ {
+		for x := 0; x < 400; x++ {
+			if x < 200 {
+				img.Set(x, y, red)
+			} else {
+				img.Set(x, y, blue)
+			}
+		}
+	}
+	var buf bytes.Buffer
+	if err := png.Encode(&buf, img); err != nil {
+		t.Fatal(err)
+	}
+	return buf.Bytes()
+}
+
+func images(t *testing.T) fstest.MapFS {
+	return fstest.MapFS{
+		"flag.png":  {Data: flag(t)},
+		"notes.txt": {Data: []byte("sloths are slow")},
+		".flag.png": {Data: flag(t)},
+	}
+}
+
+func serve(h http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+var fileServer = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Write([]byte("original"))
+})
+
+func decode(t *testing.T, w *httptest.ResponseRecorder) image.Image {
+	img, _, err := image.Decode(w.Body)
+	if err != nil {
+		t.Fatalf("Response expected to be an image, got %d %q: %v", w.Code, w.Body.String(), err)
+	}
+	return img
+}
+
+func near(c color.Color, expected color.RGBA) bool {
+	r, g, b, _ := c.RGBA()
+	diff := func(a uint32, b uint8) bool { return int(a>>8)-int(b) < 8 && int(b)-int(a>>8) < 8 }
+	return diff(r, expected.R) && diff(g, expected.G) && diff(b, expected.B)
+}
+
+func TestMiddlewarePassesThrough(t *testing.T) {
+	h := New(images(t), Options{}).Middleware(fileServer)
+	for _, target := range []string{"/flag.png", "/flag.png?v=2"} {
+		if w := serve(h, target); w.Body.String() != "original" {
+			t.Errorf("%s expected to go to the file server, got %q", target, w.Body.String())
+		}
+	}
+}
+
+func TestResize(t *testing.T) {
+	h := New(images(t), Options{}).Middleware(fileServer)
+	tests := []struct {
+		query                 string
+		width, height         int
+		leftColor, rightColor color.RGBA
+	}{
+		{"w=100", 100, 50, red, blue},
+		{"h=50", 100, 50, red, blue},
+		{"w=100&h=100", 100, 50, red, blue},
+		{"w=100&h=100&fit=contain", 100, 50, red, blue},
+		{"w=100&h=100&fit=fill", 100, 100, red, blue},
+		{"w=100&h=100&fit=cover", 100, 100, red, blue},
+		{"w=50&h=100&fit=cover", 50, 100, red, blue},
+		{"w=800", 800, 400, red, blue},
+		{"fmt=png", 400, 200, red, blue},
+	}
+	for _, test := range tests {
+		w := serve(h, "/flag.png?"+test.query)
+		img := decode(t, w)
+		b := img.Bounds()
+		if b.Dx() != test.width || b.Dy() != test.height {
+			t.Errorf("%s expected %dx%d, got %dx%d", test.query, test.width, test.height, b.Dx(), b.Dy())
+			continue
+		}
+		if left := img.At(1, b.Dy()/2); !near(left, test.leftColor) {
+			t.Errorf("%s expected the left edge to be %v, got %v", test.query, test.leftColor, left)
+		}
+		if right := img.At(b.Dx()-2, b.Dy()/2); !near(right, test.rightColor) {
+			t.Errorf("%s expected the right edge to be %v, got %v", test.query, test.rightColor, right)
+		}
+	}
+
+	//Covering a square crops the sides off the flag, but the middle is
+	//still half red and half blue
+	img := decode(t, serve(h, "/flag.png?w=100&h=100&fit=cover"))
+	if !near(img.At(45, 50), red) || !near(img.At(55, 50), blue) {
+		t.Fatalf("Cover expected to crop the middle of the image, got %v and %v",
+			img.At(45, 50), img.At(55, 50))
+	}
+}
+
+func TestTransformCoverThinImages(t *testing.T) {
+	wide := image.NewRGBA(image.Rect(0, 0, 100, 1))
+	tall := image.NewRGBA(image.Rect(0, 0, 1, 100))
+	for i := 0; i < 100; i++ {
+		wide.Set(i, 0, red)
+		tall.Set(0, i, red)
+	}
+	tests := []struct {
+		name          string
+		src           image.Image
+		width, height int
+	}{
+		{"100x1 covering 1x100", wide, 1, 100},
+		{"1x100 covering 100x1", tall, 100, 1},
+	}
+	for _, test := range tests {
+		//The crop to the covered aspect ratio rounds down to less than a
+		//pixel, so it has to be at least one
+		dst := Transform(test.src, Params{Width: test.width, Height: test.height, Fit: "cover"})
+		b := dst.Bounds()
+		if b.Dx() != test.width || b.Dy() != test.height {
+			t.Errorf("%s expected %dx%d, got %dx%d", test.name, test.width, test.height, b.Dx(), b.Dy())
+			continue
+		}
+		if c := dst.At(b.Dx()-1, b.Dy()-1); !near(c, red) {
+			t.Errorf("%s expected red pixels, got %v", test.name, c)
+		}
+	}
+}
+
+func TestConvert(t *testing.T) {
+	h := New(images(t), Options{}).Middleware(fileServer)
+	w := serve(h, "/flag.png?w=40&fmt=jpg&q=90")
+	if ct := w.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Fatalf("fmt=jpg expected Content-Type image/jpeg, got %q", ct)
+	}
+	if _, err := jpeg.Decode(w.Body); err != nil {
+		t.Fatal(err)
+	}
+
+	w = serve(h, "/flag.png?fmt=gif")
+	if ct := w.Header().Get("Content-Type"); ct != "image/gif" {
+		t.Fatalf("fmt=gif expected Content-Type image/gif, got %q", ct)
+	}
+	if img := decode(t, w); !near(img.At(10, 10), red) {
+		t.Fatalf("GIF expected to keep the flag's colors, got %v", img.At(10, 10))
+	}
+}
+
+func TestErrors(t *testing.T) {
+	h := New(images(t), Options{MaxWidth: 1000, MaxHeight: 1000}).Middleware(fileServer)
+	tests := map[string]int{
+		"/flag.png?w=0":             400,
+		"/flag.png?w=sloth":         400,
+		"/flag.png?w=1001":          400,
+		"/flag.png?h=-5":            400,
+		"/flag.png?fit=zoom":        400,
+		"/flag.png?fmt=webp":        400,
+		"/flag.png?q=101":           400,
+		"/hippo.png?w=10":           404,
+		"/.flag.png?w=10":           404,
+		"/../flag.png?w=10":         200,
+		"/notes.txt?w=10":           415,
+		"/flag.png?w=1000&h=1000":   200,
+		"/flag.png?w=10&fmt=PNG":    200,
+		"/flag.png?w=10&fit=Cover":  200,
+		"/flag.png?fmt=jpeg&q=1":    200,
+		"/flag.png?w=10&unknown=yo": 200,
+	}
+	for target, code := range tests {
+		if w := serve(h, target); w.Code != code {
+			t.Errorf("%s expected %d, got %d %q", target, code, w.Code, w.Body.String())
+		}
+	}
+
+	small := New(images(t), Options{MaxSourcePixels: 400*200 - 1}).Middleware(fileServer)
+	if w := serve(small, "/flag.png?w=10"); w.Code != 422 {
+		t.Fatalf("Image over MaxSourcePixels expected 422, got %d", w.Code)
+	}
+
+	r := httptest.NewRequest("POST", "/flag.png?w=10", nil)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	if w.Code != 405 || w.Header().Get("Allow") != "GET, HEAD" {
+		t.Fatalf("POST expected 405 with Allow \"GET, HEAD\", got %d with %q", w.Code, w.Header().Get("Allow"))
+	}
+}
+
+func TestCache(t *testing.T) {
+	dir := t.TempDir()
+	h := New(images(t), Options{CacheDir: dir}).Middleware(fileServer)
+
+	w := serve(h, "/flag.png?w=100")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag == "" {
+		t.Fatalf("Resized image expected 200 with an ETag, got %d with %q", w.Code, etag)
+	}
+	cached, err := filepath.Glob(filepath.Join(dir, "*", "*"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(cached) != 1 {
+		t.Fatalf("Resized image expected to be cached in one file, got %v", cached)
+	}
+
+	//Swap the cached image out to see that it's what gets served
+	if err := os.WriteFile(cached[0], []byte("png\ncached flag"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if w = serve(h, "/flag.png?w=100"); w.Body.String() != "cached flag" || w.Header().Get("ETag") != etag {
+		t.Fatalf("Second request expected the cached image with the same ETag, got %q with %q",
+			w.Body.String(), w.Header().Get("ETag"))
+	}
+	if w = serve(h, "/flag.png?w=100", "If-None-Match", etag); w.Code != 304 {
+		t.Fatalf("Request with the image's ETag expected 304, got %d", w.Code)
+	}
+	if w = serve(h, "/flag.png?w=101"); w.Body.String() == "cached flag" {
+		t.Fatal("Different size expected to be processed, not taken from the cache")
+	}
+}
+
+func TestCacheEviction(t *testing.T) {
+	fsys := images(t)
+	info, err := fs.Stat(fsys, "flag.png")
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := t.TempDir()
+	cached := func(width int) string {
+		key := cacheKey("flag.png", info, Params{Width: width, Fit: "contain"})
+		return filepath.Join(dir, key[:2], key)
+	}
+	size := func(width int) int64 {
+		info, err := os.Stat(cached(width))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return info.Size()
+	}
+
+	//Measure the processed images with a cache big enough for all of them
+	h := New(fsys, Options{CacheDir: dir}).Middleware(fileServer)
+	for _, width := range []int{100, 101, 102} {
+		serve(h, fmt.Sprintf("/flag.png?w=%d", width))
+	}
+	sizes := map[int]int64{100: size(100), 101: size(101), 102: size(102)}
+	if err := os.RemoveAll(dir); err != nil {
+		t.Fatal(err)
+	}
+
+	//Room for two of them
+	h = New(fsys, Options{
+		CacheDir:      dir,
+		MaxCacheBytes: sizes[100] + max(sizes[101], sizes[102]),
+	}).Middleware(fileServer)
+	serve(h, "/flag.png?w=100")
+	serve(h, "/flag.png?w=101")
+	now := time.Now()
+	os.Chtimes(cached(100), now.Add(-2*time.Hour), now.Add(-2*time.Hour))
+	os.Chtimes(cached(101), now.Add(-time.Hour), now.Add(-time.Hour))
+
+	//Using the w=100 image makes w=101 the least recently used
+	serve(h, "/flag.png?w=100")
+	serve(h, "/flag.png?w=102")
+	for width, expected := range map[int]bool{100: true, 101: false, 102: true} {
+		if _, err := os.Stat(cached(width)); (err == nil) != expected {
+			t.Errorf("Cached w=%d image expected to exist %v, got error %v", width, expected, err)
+		}
+	}
+}
+
+//countingFS counts the times flag.png is opened, and makes each open wait
+//for release
+type countingFS struct {
+	fstest.MapFS
+	opens   atomic.Int32
+	release chan struct{}
+}
+
+func (fsys *countingFS) Open(name string) (fs.File, error) {
+	if name == "flag.png" {
+		fsys.opens.Add(1)
+		<-fsys.release
+	}
+	return fsys.MapFS.Open(name)
+}
+
+func TestConcurrentRequestsShareProcessing(t *testing.T) {
+	fsys := &countingFS{MapFS: images(t), release: make(chan struct{})}
+	h := New(fsys, Options{}).Middleware(fileServer)
+
+	var wg sync.WaitGroup
+	codes := make([]int, 5)
+	for i := range codes {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			codes[i] = serve(h, "/flag.png?w=100").Code
+		}()
+	}
+	//Give the requests time to all wait for the first one
+	time.Sleep(50 * time.Millisecond)
+	close(fsys.release)
+	wg.Wait()
+
+	for i, code := range codes {
+		if code != 200 {
+			t.Errorf("Request %d expected 200, got %d", i, code)
+		}
+	}
+	if opens := fsys.opens.Load(); opens != 1 {
+		t.Fatalf("Image expected to be processed once without a cache, got %d times", opens)
+	}
+}
+
+func TestMaxConcurrent(t *testing.T) {
+	p := New(images(t), Options{MaxConcurrent: 1})
+	h := p.Middleware(fileServer)
+
+	//Take the only turn to process an image
+	p.sem <- struct{}{}
+	done := make(chan int)
+	go func() { done <- serve(h, "/flag.png?w=100").Code }()
+	select {
+	case code := <-done:
+		t.Fatalf("Request expected to wait for a turn, got %d", code)
+	case <-time.After(50 * time.Millisecond):
+	}
+
+	<-p.sem
+	if code := <-done; code != 200 {
+		t.Fatalf("Request expected 200 once it got a turn, got %d", code)
+	}
+}
@@ -0,0 +1,316 @@
+package logging
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"text/template"
+	"time"
+	"unicode/utf8"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+//An AccessEntry is everything known about a served request when its access
+//log line is written.
+type AccessEntry struct {
+	Request *http.Request
+	//URL is a copy of the request's URL from before any handler (like
+	//http.StripPrefix) could change it
+	URL url.URL
+	//Time is when the request came in
+	Time     time.Time
+	Status   int
+	Size     int64
+	Duration time.Duration
+
+	//RequestID is the ID the requestid middleware gave the request
+	RequestID string
+	//Route is the pattern of the route that served the request
+	Route string
+	//Upstream is how long the handler spent waiting on a backend
+	Upstream time.Duration
+}
+
+//RemoteHost is the client's IP address
+func (e *AccessEntry) RemoteHost() string {
+	host, _, err := net.SplitHostPort(e.Request.RemoteAddr)
+	if err != nil {
+		return e.Request.RemoteAddr
+	}
+	return host
+}
+
+//Username is the user from the request URL, or "-" if there isn't one
+func (e *AccessEntry) Username() string {
+	if e.URL.User != nil {
+		if name := e.URL.User.Username(); name != "" {
+			return name
+		}
+	}
+	return "-"
+}
+
+//Timestamp is Time in the Apache log format, like
+//10/Oct/2000:13:55:36 -0700
+func (e *AccessEntry) Timestamp() string {
+	return e.Time.Format("02/Jan/2006:15:04:05 -0700")
+}
+
+//Method is the request's HTTP method
+func (e *AccessEntry) Method() string { return e.Request.Method }
+
+//Proto is the request's protocol, like HTTP/1.1
+func (e *AccessEntry) Proto() string { return e.Request.Proto }
+
+//Referer is the request's Referer header
+func (e *AccessEntry) Referer() string { return e.Request.Referer() }
+
+//UserAgent is the request's User-Agent header
+func (e *AccessEntry) UserAgent() string { return e.Request.UserAgent() }
+
+//URI is the request target as the client sent it
+func (e *AccessEntry) URI() string {
+	//Requests using the CONNECT method over HTTP/2 identify the target
+	//with the authority field instead.
+	if e.Request.ProtoMajor == 2 && e.Request.Method == "CONNECT" {
+		return e.Request.Host
+	}
+	if e.Request.RequestURI != "" {
+		return e.Request.RequestURI
+	}
+	return e.URL.RequestURI()
+}
+
+//A Format appends the access log line for an entry to buf, without the
+//trailing newline.
+type Format func(buf []byte, e *AccessEntry) []byte
+
+//CommonFormat is the Apache Common Log Format, the same as Gorilla's
+//handlers.LoggingHandler writes:
+//
+//	127.0.0.1 - frank [10/Oct/2000:13:55:36 -0700] "GET /sloth.jpg HTTP/1.0" 200 2326
+func CommonFormat(buf []byte, e *AccessEntry) []byte {
+	buf = append(buf, e.RemoteHost()...)
+	buf = append(buf, " - "...)
+	buf = append(buf, e.Username()...)
+	buf = append(buf, " ["...)
+	buf = append(buf, e.Timestamp()...)
+	buf = append(buf, `] "`...)
+	buf = append(buf, e.Request.Method...)
+	buf = append(buf, ' ')
+	buf = appendQuoted(buf, e.URI())
+	buf = append(buf, ' ')
+	buf = append(buf, e.Request.Proto...)
+	buf = append(buf, `" `...)
+	buf = strconv.AppendInt(buf, int64(e.Status), 10)
+	buf = append(buf, ' ')
+	buf = strconv.AppendInt(buf, e.Size, 10)
+	return buf
+}
+
+//CombinedFormat is the Apache Combined Log Format, the same as Gorilla's
+//handlers.CombinedLoggingHandler writes. It's CommonFormat followed by the
+//quoted Referer and User-Agent.
+func CombinedFormat(buf []byte, e *AccessEntry) []byte {
+	buf = CommonFormat(buf, e)
+	buf = append(buf, ` "`...)
+	buf = appendQuoted(buf, e.Referer())
+	buf = append(buf, `" "`...)
+	buf = appendQuoted(buf, e.UserAgent())
+	buf = append(buf, '"')
+	return buf
+}
+
+var templateFuncs = template.FuncMap{
+	//quote escapes a string the way the Apache formats do inside quotes
+	"quote": func(s string) string { return string(appendQuoted(nil, s)) },
+	//ms formats a duration as milliseconds with three decimal places
+	"ms": func(d time.Duration) string {
+		return strconv.FormatFloat(float64(d)/float64(time.Millisecond), 'f', 3, 64)
+	},
+	//dash replaces an empty string with "-"
+	"dash": func(s string) string {
+		if s == "" {
+			return "-"
+		}
+		return s
+	},
+}
+
+//ParseFormat makes a Format from a text/template executed on each
+//AccessEntry, with the extra functions quote, ms and dash. For example,
+//this is the Common Log Format plus the request ID, route and latencies:
+//
+//	{{.RemoteHost}} - {{.Username}} [{{.Timestamp}}] "{{.Method}} {{quote .URI}} {{.Proto}}" {{.Status}} {{.Size}} {{dash .RequestID}} {{dash .Route}} {{ms .Duration}} {{ms .Upstream}}
+func ParseFormat(text string) (Format, error) {
+	tmpl, err := template.New("access log").Funcs(templateFuncs).Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	return func(buf []byte, e *AccessEntry) []byte {
+		var out bytes.Buffer
+		if err := tmpl.Execute(&out, e); err != nil {
+			return append(buf, "access log template error: "+err.Error()...)
+		}
+		return append(buf, out.Bytes()...)
+	}, nil
+}
+
+//accessAnnotations are the parts of an AccessEntry handlers fill in
+//themselves, kept in the request's context.
+type accessAnnotations struct {
+	mu       sync.Mutex
+	route    string
+	upstream time.Duration
+}
+
+type annotationsKey struct{}
+
+func annotations(r *http.Request) *accessAnnotations {
+	a, _ := r.Context().Value(annotationsKey{}).(*accessAnnotations)
+	return a
+}
+
+//SetRoute records the pattern of the route serving r for the access log,
+//for routers that don't set r.Pattern the way http.ServeMux does.
+func SetRoute(r *http.Request, pattern string) {
+	if a := annotations(r); a != nil {
+		a.mu.Lock()
+		a.route = pattern
+		a.mu.Unlock()
+	}
+}
+
+//AddUpstreamLatency adds d to the time r's access log line says was spent
+//waiting on backends.
+func AddUpstreamLatency(r *http.Request, d time.Duration) {
+	if a := annotations(r); a != nil {
+		a.mu.Lock()
+		a.upstream += d
+		a.mu.Unlock()
+	}
+}
+
+//AccessLog returns middleware that writes a line in format to out for
+//every request after the next handler serves it. Each line is written
+//with a single Write, and writes are serialized so out doesn't have to be
+//safe for concurrent use.
+func AccessLog(out io.Writer, format Format) func(http.Handler) http.Handler {
+	var mu sync.Mutex
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			e := &AccessEntry{Time: time.Now(), URL: *r.URL}
+			a := &accessAnnotations{}
+			r = r.WithContext(context.WithValue(r.Context(), annotationsKey{}, a))
+			rec := NewStatusRecorder(w)
+
+			next.ServeHTTP(rec, r)
+
+			e.Request = r
+			e.Status = rec.StatusCode()
+			e.Size = rec.Size
+			e.Duration = time.Since(e.Time)
+			//The ID is only in the response header if the request ID
+			//middleware runs after this one
+			e.RequestID = requestid.Get(r)
+			if e.RequestID == "" {
+				e.RequestID = rec.Header().Get(requestid.Header)
+			}
+			a.mu.Lock()
+			e.Route, e.Upstream = a.route, a.upstream
+			a.mu.Unlock()
+			if e.Route == "" {
+				e.Route = r.Pattern
+			}
+
+			line := append(format(nil, e), '\n')
+			mu.Lock()
+			out.Write(line)
+			mu.Unlock()
+		})
+	}
+}
+
+//LoggingHandler logs requests to h in the Common Log Format, as a drop-in
+//replacement for Gorilla's handlers.LoggingHandler.
+func LoggingHandler(out io.Writer, h http.Handler) http.Handler {
+	return AccessLog(out, CommonFormat)(h)
+}
+
+//CombinedLoggingHandler logs requests to h in the Combined Log Format, as
+//a drop-in replacement for Gorilla's handlers.CombinedLoggingHandler.
+func CombinedLoggingHandler(out io.Writer, h http.Handler) http.Handler {
+	return AccessLog(out, CombinedFormat)(h)
+}
+
+//CustomLoggingHandler logs requests to h in format
+func CustomLoggingHandler(out io.Writer, h http.Handler, format Format) http.Handler {
+	return AccessLog(out, format)(h)
+}
+
+const lowerhex = "0123456789abcdef"
+
+//appendQuoted escapes s like strconv.Quote, minus the surrounding quotes,
+//except that invalid UTF-8 bytes are written as \xNN. It matches the
+//escaping in Gorilla's logging handlers.
+func appendQuoted(buf []byte, s string) []byte {
+	for width := 0; len(s) > 0; s = s[width:] {
+		r := rune(s[0])
+		width = 1
+		if r >= utf8.RuneSelf {
+			r, width = utf8.DecodeRuneInString(s)
+		}
+		if width == 1 && r == utf8.RuneError {
+			buf = append(buf, `\x`...)
+			buf = append(buf, lowerhex[s[0]>>4], lowerhex[s[0]&0xF])
+			continue
+		}
+		if r == '"' || r == '\\' {
+			buf = append(buf, '\\', byte(r))
+			continue
+		}
+		if strconv.IsPrint(r) {
+			buf = utf8.AppendRune(buf, r)
+			continue
+		}
+		switch r {
+		case '\a':
+			buf = append(buf, `\a`...)
+		case '\b':
+			buf = append(buf, `\b`...)
+		case '\f':
+			buf = append(buf, `\f`...)
+		case '\n':
+			buf = append(buf, `\n`...)
+		case '\r':
+			buf = append(buf, `\r`...)
+		case '\t':
+			buf = append(buf, `\t`...)
+		case '\v':
+			buf = append(buf, `\v`...)
+		default:
+			switch {
+			case r < ' ':
+				buf = append(buf, `\x`...)
+				buf = append(buf, lowerhex[s[0]>>4], lowerhex[s[0]&0xF])
+			case r < 0x10000:
+				buf = append(buf, `\u`...)
+				for shift := 12; shift >= 0; shift -= 4 {
+					buf = append(buf, lowerhex[r>>uint(shift)&0xF])
+				}
+			default:
+				buf = append(buf, `\U`...)
+				for shift := 28; shift >= 0; shift -= 4 {
+					buf = append(buf, lowerhex[r>>uint(shift)&0xF])
+				}
+			}
+		}
+	}
+	return buf
+}
@@ -0,0 +1,148 @@
+package logging
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/gorilla/handlers"
+)
+
+//accessLogRequests are the requests the access log is compared with
+//Gorilla's on, including URIs and headers that need escaping.
+func accessLogRequests() []*http.Request {
+	plain := httptest.NewRequest("GET", "/sloths", nil)
+
+	withUser := httptest.NewRequest("POST", "/send-order?beverage=tea", nil)
+	withUser.URL.User = url.User("frank")
+	withUser.Header.Set("Referer", "http://localhost:1123/order-form")
+	withUser.Header.Set("User-Agent", `Mozilla/5.0 "quoted" \ agent`)
+
+	escaped := httptest.NewRequest("GET", "/", nil)
+	escaped.RequestURI = "/tea/\"hibiscus\"\t\n\x01\xff/ünïcode/ /\U0001F9A5"
+	escaped.RemoteAddr = "[::1]:5000"
+	escaped.Proto = "HTTP/1.0"
+
+	noRequestURI := httptest.NewRequest("GET", "/kangaroos/tree-kangaroos?x=1", nil)
+	noRequestURI.RequestURI = ""
+
+	connect := httptest.NewRequest("CONNECT", "/", nil)
+	connect.ProtoMajor, connect.Proto = 2, "HTTP/2.0"
+	connect.Host = "example.com:443"
+
+	return []*http.Request{plain, withUser, escaped, noRequestURI, connect}
+}
+
+var accessLogHandler = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	if r.Method == "POST" {
+		w.WriteHeader(http.StatusCreated)
+	}
+	fmt.Fprintf(w, "Sloths rule!")
+})
+
+//logLines serves r with both loggers and returns each one's output
+func logLines(ours, gorillas func(*bytes.Buffer) http.Handler, r *http.Request) (string, string) {
+	var ourBuf, gorillaBuf bytes.Buffer
+	ours(&ourBuf).ServeHTTP(httptest.NewRecorder(), r)
+	gorillas(&gorillaBuf).ServeHTTP(httptest.NewRecorder(), r)
+	return ourBuf.String(), gorillaBuf.String()
+}
+
+func compareWithGorilla(t *testing.T, ours, gorillas func(*bytes.Buffer) http.Handler) {
+	for _, r := range accessLogRequests() {
+		//Retry if the two lines were logged on either side of a second
+		//boundary, since the timestamps would differ
+		var ourLine, gorillaLine string
+		for i := 0; i < 3; i++ {
+			ourLine, gorillaLine = logLines(ours, gorillas, r)
+			if ourLine == gorillaLine {
+				break
+			}
+		}
+		if ourLine != gorillaLine {
+			t.Errorf("Access log line for %s %q\nexpected %q\n     got %q",
+				r.Method, r.RequestURI, gorillaLine, ourLine)
+		}
+	}
+}
+
+func TestCommonFormatMatchesGorilla(t *testing.T) {
+	compareWithGorilla(t,
+		func(b *bytes.Buffer) http.Handler { return LoggingHandler(b, accessLogHandler) },
+		func(b *bytes.Buffer) http.Handler { return handlers.LoggingHandler(b, accessLogHandler) })
+}
+
+func TestCombinedFormatMatchesGorilla(t *testing.T) {
+	compareWithGorilla(t,
+		func(b *bytes.Buffer) http.Handler { return CombinedLoggingHandler(b, accessLogHandler) },
+		func(b *bytes.Buffer) http.Handler {
+			return handlers.CombinedLoggingHandler(b, accessLogHandler)
+		})
+}
+
+func TestCustomFormat(t *testing.T) {
+	format, err := ParseFormat(`{{.Method}} {{quote .URI}} {{.Status}} ` +
+		`{{dash .RequestID}} {{dash .Route}} {{ms .Upstream}}`)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /tea/{flavor}", func(w http.ResponseWriter, r *http.Request) {
+		AddUpstreamLatency(r, 1500*time.Microsecond)
+		AddUpstreamLatency(r, 500*time.Microsecond)
+		w.Header().Set("X-Request-ID", "abc123")
+		w.WriteHeader(http.StatusTeapot)
+	})
+	mux.HandleFunc("/coffee", func(w http.ResponseWriter, r *http.Request) {
+		SetRoute(r, "/{drink:(coffee)+}")
+	})
+
+	var buf bytes.Buffer
+	handler := CustomLoggingHandler(&buf, mux, format)
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", `/tea/"earl-grey"`, nil))
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/coffee", nil))
+
+	expected := `GET /tea/\"earl-grey\" 418 abc123 GET /tea/{flavor} 2.000` + "\n" +
+		`GET /coffee 200 - /{drink:(coffee)+} 0.000` + "\n"
+	if buf.String() != expected {
+		t.Fatalf("Custom access log expected\n%s\ngot\n%s", expected, buf.String())
+	}
+}
+
+func TestParseFormatError(t *testing.T) {
+	if _, err := ParseFormat("{{.Status"); err == nil {
+		t.Fatalf("ParseFormat with an unclosed action expected an error, got nil")
+	}
+}
+
+func TestAccessLogOneLinePerRequest(t *testing.T) {
+	var buf bytes.Buffer
+	handler := LoggingHandler(&buf, accessLogHandler)
+
+	done := make(chan struct{})
+	for i := 0; i < 20; i++ {
+		go func() {
+			handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/sloths", nil))
+			done <- struct{}{}
+		}()
+	}
+	for i := 0; i < 20; i++ {
+		<-done
+	}
+
+	lines := strings.Split(strings.TrimSuffix(buf.String(), "\n"), "\n")
+	if len(lines) != 20 {
+		t.Fatalf("Access log expected 20 lines, got %d", len(lines))
+	}
+	for _, line := range lines {
+		if !strings.HasSuffix(line, `"GET /sloths HTTP/1.1" 200 12`) {
+			t.Fatalf("Access log line garbled: %q", line)
+		}
+	}
+}
@@ -0,0 +1,114 @@
+//Package logging has middleware for logging requests with log/slog once
+//they've been served, so each record has the response's status code, size
+//and how long it took.
+package logging
+
+import (
+	"fmt"
+	"io"
+	"log/slog"
+	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+//FormatEnv and LevelEnv are the environment variables DefaultLogger reads
+//the log format ("text" or "json") and minimum level ("debug", "info",
+//"warn" or "error") from.
+const (
+	FormatEnv = "MEAN_GOPHER_LOG_FORMAT"
+	LevelEnv  = "MEAN_GOPHER_LOG_LEVEL"
+)
+
+//NewLogger makes a slog.Logger writing to w in format, which is either
+//"text" or "json".
+func NewLogger(w io.Writer, format string, level slog.Leveler) (*slog.Logger, error) {
+	opts := &slog.HandlerOptions{Level: level}
+	switch format {
+	case "", "text":
+		return slog.New(slog.NewTextHandler(w, opts)), nil
+	case "json":
+		return slog.New(slog.NewJSONHandler(w, opts)), nil
+	}
+	return nil, fmt.Errorf("logging: unknown log format %q, expected text or json", format)
+}
+
+//DefaultLogger makes a logger writing to stdout with the format and level
+//from FormatEnv and LevelEnv, falling back to text at info level if they're
+//unset or invalid.
+func DefaultLogger() *slog.Logger {
+	var level slog.Level
+	if err := level.UnmarshalText([]byte(os.Getenv(LevelEnv))); err != nil {
+		level = slog.LevelInfo
+	}
+	logger, err := NewLogger(os.Stdout, strings.ToLower(os.Getenv(FormatEnv)), level)
+	if err != nil {
+		logger, _ = NewLogger(os.Stdout, "text", level)
+		logger.Warn(err.Error())
+	}
+	return logger
+}
+
+//LevelFor is the level a request with the given status is logged at:
+//server errors are errors, client errors are warnings and everything else
+//is info.
+func LevelFor(status int) slog.Level {
+	switch {
+	case status >= 500:
+		return slog.LevelError
+	case status >= 400:
+		return slog.LevelWarn
+	}
+	return slog.LevelInfo
+}
+
+//Middleware returns middleware that logs every request to logger after
+//the next handler serves it. It's a plain func(http.Handler) http.Handler,
+//so it can be called directly, passed to chain.New, or wrapped around a
+//router given to a Negroni stack's UseHandler.
+func Middleware(logger *slog.Logger) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			start := time.Now()
+			rec := NewStatusRecorder(w)
+			next.ServeHTTP(rec, r)
+			//If the request ID middleware runs after this one, the ID is
+			//only in the response header
+			if requestid.Get(r) == "" {
+				if id := rec.Header().Get(requestid.Header); id != "" {
+					r = r.WithContext(requestid.NewContext(r.Context(), id))
+				}
+			}
+			LogRequest(logger, r, rec.StatusCode(), rec.Size, time.Since(start))
+		})
+	}
+}
+
+//LogRequest writes one record for a served request, including its request
+//ID if it has one.
+func LogRequest(logger *slog.Logger, r *http.Request, status int, size int64, duration time.Duration) {
+	ctx := r.Context()
+	level := LevelFor(status)
+	if !logger.Enabled(ctx, level) {
+		return
+	}
+
+	attrs := make([]slog.Attr, 0, 9)
+	if id := requestid.FromContext(ctx); id != "" {
+		attrs = append(attrs, slog.String("request_id", id))
+	}
+	attrs = append(attrs,
+		slog.String("method", r.Method),
+		slog.String("path", r.URL.RequestURI()),
+		slog.Int("status", status),
+		slog.Int64("bytes", size),
+		slog.Duration("duration", duration),
+		slog.String("remote_addr", r.RemoteAddr),
+		slog.String("proto", r.Proto),
+		slog.String("user_agent", r.UserAgent()),
+	)
+	logger.LogAttrs(ctx, level, "request", attrs...)
+}
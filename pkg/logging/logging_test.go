@@ -0,0 +1,141 @@
+package logging
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+//serveLogged serves one request through the logging middleware and
+//returns the JSON log record it wrote.
+func serveLogged(t *testing.T, handler http.HandlerFunc, r *http.Request) (*httptest.ResponseRecorder, map[string]interface{}) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "json", slog.LevelDebug)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	w := httptest.NewRecorder()
+	Middleware(logger)(handler).ServeHTTP(w, r)
+
+	var record map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+		t.Fatalf("Log output isn't one JSON record: %v\n%s", err, buf.String())
+	}
+	return w, record
+}
+
+func expectField(t *testing.T, record map[string]interface{}, key string, expected interface{}) {
+	if record[key] != expected {
+		t.Errorf("Log record %s expected %v, got %v", key, expected, record[key])
+	}
+}
+
+func TestMiddlewareLogsResponse(t *testing.T) {
+	r := httptest.NewRequest("POST", "/ducks?venom=yes", nil)
+	w, record := serveLogged(t, func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("Quack"))
+	}, r)
+
+	if w.Code != http.StatusCreated || w.Body.String() != "Quack" {
+		t.Fatalf("Response expected 201 Quack, got %d %s", w.Code, w.Body)
+	}
+	expectField(t, record, "msg", "request")
+	expectField(t, record, "level", "INFO")
+	expectField(t, record, "method", "POST")
+	expectField(t, record, "path", "/ducks?venom=yes")
+	expectField(t, record, "status", float64(201))
+	expectField(t, record, "bytes", float64(5))
+	if _, ok := record["duration"].(float64); !ok {
+		t.Errorf("Log record expected a numeric duration, got %v", record["duration"])
+	}
+}
+
+func TestMiddlewareDefaultStatus(t *testing.T) {
+	r := httptest.NewRequest("GET", "/", nil)
+	_, record := serveLogged(t, func(w http.ResponseWriter, r *http.Request) {}, r)
+	expectField(t, record, "status", float64(200))
+	expectField(t, record, "bytes", float64(0))
+}
+
+func TestMiddlewareLevels(t *testing.T) {
+	for status, level := range map[int]string{404: "WARN", 503: "ERROR", 302: "INFO"} {
+		r := httptest.NewRequest("GET", "/", nil)
+		_, record := serveLogged(t, func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(status)
+		}, r)
+		expectField(t, record, "level", level)
+	}
+}
+
+func TestMiddlewareCountsServeFile(t *testing.T) {
+	r := httptest.NewRequest("GET", "/logging.go", nil)
+	_, record := serveLogged(t, func(w http.ResponseWriter, r *http.Request) {
+		http.ServeFile(w, r, "logging.go")
+	}, r)
+	if size, _ := record["bytes"].(float64); size == 0 {
+		t.Fatalf("Log record expected the file's size in bytes, got %v", record["bytes"])
+	}
+}
+
+func TestMiddlewareLogsRequestID(t *testing.T) {
+	var buf bytes.Buffer
+	logger, _ := NewLogger(&buf, "json", slog.LevelInfo)
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	//The request ID middleware can go on either side of the logger
+	chains := map[string]http.Handler{
+		"outside": requestid.Middleware(Middleware(logger)(handler)),
+		"inside":  Middleware(logger)(requestid.Middleware(handler)),
+	}
+	for name, chain := range chains {
+		buf.Reset()
+		r := httptest.NewRequest("GET", "/", nil)
+		r.Header.Set(requestid.Header, "duck-42")
+		chain.ServeHTTP(httptest.NewRecorder(), r)
+
+		var record map[string]interface{}
+		if err := json.Unmarshal(buf.Bytes(), &record); err != nil {
+			t.Fatal(err)
+		}
+		if record["request_id"] != "duck-42" {
+			t.Errorf("Request ID middleware %s the logger: request_id expected duck-42, got %v",
+				name, record["request_id"])
+		}
+	}
+}
+
+func TestStatusRecorderFlush(t *testing.T) {
+	w := httptest.NewRecorder()
+	rec := NewStatusRecorder(w)
+	rec.Write([]byte("streaming"))
+	if err := http.NewResponseController(rec).Flush(); err != nil {
+		t.Fatalf("Flush through a StatusRecorder failed: %v", err)
+	}
+	if !w.Flushed {
+		t.Fatalf("Flush didn't reach the underlying ResponseWriter")
+	}
+}
+
+func TestNewLoggerFormats(t *testing.T) {
+	var buf bytes.Buffer
+	logger, err := NewLogger(&buf, "text", slog.LevelInfo)
+	if err != nil {
+		t.Fatal(err)
+	}
+	logger.Info("request", "status", 200)
+	if !strings.Contains(buf.String(), "msg=request status=200") {
+		t.Fatalf("Text log expected key=value pairs, got %s", buf.String())
+	}
+
+	if _, err := NewLogger(&buf, "xml", slog.LevelInfo); err == nil {
+		t.Fatalf("NewLogger with format xml expected an error, got nil")
+	}
+}
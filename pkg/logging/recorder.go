@@ -0,0 +1,86 @@
+package logging
+
+import (
+	"bufio"
+	"io"
+	"net"
+	"net/http"
+)
+
+//A StatusRecorder wraps an http.ResponseWriter to keep track of the status
+//code and number of bytes written, which a plain middleware never gets to
+//see since the handler writes the response after the middleware calls it.
+type StatusRecorder struct {
+	http.ResponseWriter
+	Status int
+	Size   int64
+}
+
+//NewStatusRecorder wraps w in a StatusRecorder
+func NewStatusRecorder(w http.ResponseWriter) *StatusRecorder {
+	return &StatusRecorder{ResponseWriter: w}
+}
+
+func (w *StatusRecorder) WriteHeader(status int) {
+	if w.Status == 0 {
+		w.Status = status
+	}
+	w.ResponseWriter.WriteHeader(status)
+}
+
+func (w *StatusRecorder) Write(b []byte) (int, error) {
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
+	n, err := w.ResponseWriter.Write(b)
+	w.Size += int64(n)
+	return n, err
+}
+
+//ReadFrom keeps http.ServeFile able to use sendfile when the underlying
+//ResponseWriter supports it.
+func (w *StatusRecorder) ReadFrom(r io.Reader) (int64, error) {
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
+	var n int64
+	var err error
+	if rf, ok := w.ResponseWriter.(io.ReaderFrom); ok {
+		n, err = rf.ReadFrom(r)
+	} else {
+		n, err = io.Copy(writerOnly{w.ResponseWriter}, r)
+	}
+	w.Size += n
+	return n, err
+}
+
+//writerOnly hides everything but Write so io.Copy doesn't loop back
+//into ReadFrom.
+type writerOnly struct{ io.Writer }
+
+//Flush passes flushes through for streaming responses
+func (w *StatusRecorder) Flush() {
+	if w.Status == 0 {
+		w.Status = http.StatusOK
+	}
+	http.NewResponseController(w.ResponseWriter).Flush()
+}
+
+//Hijack passes hijacking through for protocols like WebSockets
+func (w *StatusRecorder) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return http.NewResponseController(w.ResponseWriter).Hijack()
+}
+
+//Unwrap lets http.ResponseController reach the underlying ResponseWriter
+func (w *StatusRecorder) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
+
+//StatusCode is the response's status code, or 200 if the handler never
+//wrote anything since that's what net/http sends in that case.
+func (w *StatusRecorder) StatusCode() int {
+	if w.Status == 0 {
+		return http.StatusOK
+	}
+	return w.Status
+}
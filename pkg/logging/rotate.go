@@ -0,0 +1,406 @@
+package logging
+
+import (
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"os/signal"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+//ErrRotatingFileClosed is returned by writes to a closed RotatingFile
+var ErrRotatingFileClosed = errors.New("logging: rotating file closed")
+
+//DefaultBufferSize is how many writes a RotatingFile queues up if its
+//options don't say otherwise.
+const DefaultBufferSize = 1024
+
+//backupTimeFormat names rotated files so they sort oldest first
+const backupTimeFormat = "2006-01-02T15-04-05.000"
+
+//RotateOptions say when a RotatingFile rotates and what it keeps
+type RotateOptions struct {
+	//MaxSize rotates the file before a write would make it bigger than
+	//this many bytes. 0 means never rotate by size.
+	MaxSize int64
+	//Interval rotates the file this often. 0 means never rotate by time.
+	Interval time.Duration
+	//MaxBackups is how many gzipped old files to keep. 0 keeps them all.
+	MaxBackups int
+	//BufferSize is how many writes can be queued waiting for the disk
+	//before writes start getting dropped. 0 means DefaultBufferSize.
+	BufferSize int
+	//ReopenOnSIGHUP closes and reopens the file on SIGHUP, for when an
+	//external tool like logrotate has moved it.
+	ReopenOnSIGHUP bool
+}
+
+//A RotatingFile is an io.Writer for log files, like the destination of a
+//LoggingHandler. Writes are queued and written by a background goroutine,
+//so a slow disk never holds up a request; when the queue is full, writes
+//are dropped and counted instead of blocking.
+type RotatingFile struct {
+	path string
+	opts RotateOptions
+
+	queue   chan []byte
+	control chan func()
+	quit    chan struct{}
+	done    chan struct{}
+	dropped atomic.Int64
+
+	mu     sync.RWMutex //guards closed against Write
+	closed bool
+
+	//owned by the background goroutine
+	file *os.File
+	size int64
+
+	errMu sync.Mutex
+	err   error //last error writing, rotating or compressing, for Close
+
+	compressing sync.WaitGroup
+	pruneMu     sync.Mutex
+
+	beforeWrite func() //test hook
+}
+
+//OpenRotatingFile opens the log file at path for appending, creating it if
+//it doesn't exist.
+func OpenRotatingFile(path string, opts RotateOptions) (*RotatingFile, error) {
+	return openRotatingFile(path, opts, nil)
+}
+
+func openRotatingFile(path string, opts RotateOptions, beforeWrite func()) (*RotatingFile, error) {
+	if opts.BufferSize <= 0 {
+		opts.BufferSize = DefaultBufferSize
+	}
+	f := &RotatingFile{
+		path:        path,
+		opts:        opts,
+		queue:       make(chan []byte, opts.BufferSize),
+		control:     make(chan func()),
+		quit:        make(chan struct{}),
+		done:        make(chan struct{}),
+		beforeWrite: beforeWrite,
+	}
+	if err := f.open(); err != nil {
+		return nil, err
+	}
+
+	var hup chan os.Signal
+	if opts.ReopenOnSIGHUP {
+		hup = make(chan os.Signal, 1)
+		signal.Notify(hup, syscall.SIGHUP)
+	}
+	go f.run(hup)
+	return f, nil
+}
+
+//Write queues a copy of p to be written. It never blocks; if the queue is
+//full, p is dropped and counted in Dropped.
+func (f *RotatingFile) Write(p []byte) (int, error) {
+	f.mu.RLock()
+	defer f.mu.RUnlock()
+	if f.closed {
+		return 0, ErrRotatingFileClosed
+	}
+
+	select {
+	case f.queue <- append([]byte(nil), p...):
+	default:
+		f.dropped.Add(1)
+	}
+	return len(p), nil
+}
+
+//Dropped is how many writes have been dropped because the queue was full
+func (f *RotatingFile) Dropped() int64 {
+	return f.dropped.Load()
+}
+
+//Rotate rotates the file now, after writing everything queued before it
+func (f *RotatingFile) Rotate() error {
+	return f.do(f.rotate)
+}
+
+//Reopen closes and reopens the file at the same path, after writing
+//everything queued before it.
+func (f *RotatingFile) Reopen() error {
+	return f.do(f.reopen)
+}
+
+//do runs fn on the background goroutine once the queue has been written
+func (f *RotatingFile) do(fn func() error) error {
+	errc := make(chan error, 1)
+	select {
+	case f.control <- func() { errc <- fn() }:
+		return <-errc
+	case <-f.done:
+		return ErrRotatingFileClosed
+	}
+}
+
+//Close writes everything queued, waits for backups to finish compressing
+//and closes the file.
+func (f *RotatingFile) Close() error {
+	f.mu.Lock()
+	if f.closed {
+		f.mu.Unlock()
+		return ErrRotatingFileClosed
+	}
+	f.closed = true
+	f.mu.Unlock()
+
+	close(f.quit)
+	<-f.done
+	f.compressing.Wait()
+
+	f.errMu.Lock()
+	defer f.errMu.Unlock()
+	return f.err
+}
+
+func (f *RotatingFile) run(hup chan os.Signal) {
+	defer close(f.done)
+	if hup != nil {
+		defer signal.Stop(hup)
+	}
+
+	var tick <-chan time.Time
+	if f.opts.Interval > 0 {
+		ticker := time.NewTicker(f.opts.Interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case p := <-f.queue:
+			f.write(p)
+		case fn := <-f.control:
+			f.drain()
+			fn()
+		case <-tick:
+			if f.size > 0 {
+				f.record(f.rotate())
+			}
+		case <-hup:
+			f.drain()
+			f.record(f.reopen())
+		case <-f.quit:
+			f.drain()
+			f.record(f.file.Close())
+			return
+		}
+	}
+}
+
+//drain writes everything currently queued
+func (f *RotatingFile) drain() {
+	for {
+		select {
+		case p := <-f.queue:
+			f.write(p)
+		default:
+			return
+		}
+	}
+}
+
+func (f *RotatingFile) write(p []byte) {
+	if f.beforeWrite != nil {
+		f.beforeWrite()
+	}
+	if f.opts.MaxSize > 0 && f.size > 0 && f.size+int64(len(p)) > f.opts.MaxSize {
+		f.record(f.rotate())
+	}
+	n, err := f.file.Write(p)
+	f.size += int64(n)
+	f.record(err)
+}
+
+func (f *RotatingFile) record(err error) {
+	if err != nil {
+		f.errMu.Lock()
+		f.err = err
+		f.errMu.Unlock()
+		fmt.Fprintf(os.Stderr, "logging: %s: %v\n", f.path, err)
+	}
+}
+
+func (f *RotatingFile) open() error {
+	file, size, err := f.openFile()
+	if err != nil {
+		return err
+	}
+	f.file, f.size = file, size
+	return nil
+}
+
+//openFile opens the file at the path for appending, with its size
+func (f *RotatingFile) openFile() (*os.File, int64, error) {
+	file, err := os.OpenFile(f.path, os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0644)
+	if err != nil {
+		return nil, 0, err
+	}
+	info, err := file.Stat()
+	if err != nil {
+		file.Close()
+		return nil, 0, err
+	}
+	return file, info.Size(), nil
+}
+
+//reopen switches to a newly opened file at the path. The old file is only
+//closed once the new one is open, so if it can't be opened, like after a
+//permissions change, logging carries on in the old one.
+func (f *RotatingFile) reopen() error {
+	file, size, err := f.openFile()
+	if err != nil {
+		return err
+	}
+	f.record(f.file.Close())
+	f.file, f.size = file, size
+	return nil
+}
+
+//rotate moves the current file aside, starts a new one, and compresses
+//the old one in the background.
+func (f *RotatingFile) rotate() error {
+	//The file is moved while it's still open, so if anything fails, the
+	//lines keep going to it rather than getting lost
+	backup := f.backupName()
+	if err := os.Rename(f.path, backup); err != nil {
+		return err
+	}
+	if err := f.reopen(); err != nil {
+		f.record(os.Rename(backup, f.path))
+		return err
+	}
+
+	f.compressing.Add(1)
+	go func() {
+		defer f.compressing.Done()
+		f.record(compressFile(backup))
+		f.record(f.prune())
+	}()
+	return nil
+}
+
+//backupName is the path to move the current file to, unique even if the
+//file is rotated twice in the same millisecond.
+func (f *RotatingFile) backupName() string {
+	base := f.path + "." + time.Now().Format(backupTimeFormat)
+	name := base
+	for i := 1; ; i++ {
+		_, err := os.Stat(name)
+		_, gzErr := os.Stat(name + ".gz")
+		if os.IsNotExist(err) && os.IsNotExist(gzErr) {
+			return name
+		}
+		name = fmt.Sprintf("%s-%d", base, i)
+	}
+}
+
+//prune deletes the oldest compressed backups past MaxBackups
+func (f *RotatingFile) prune() error {
+	if f.opts.MaxBackups <= 0 {
+		return nil
+	}
+	f.pruneMu.Lock()
+	defer f.pruneMu.Unlock()
+
+	backups, err := f.Backups()
+	if err != nil {
+		return err
+	}
+	for len(backups) > f.opts.MaxBackups {
+		if err := os.Remove(backups[0]); err != nil {
+			return err
+		}
+		backups = backups[1:]
+	}
+	return nil
+}
+
+//Backups lists the compressed backups of the file, oldest first
+func (f *RotatingFile) Backups() ([]string, error) {
+	matches, err := filepath.Glob(f.path + ".*.gz")
+	if err != nil {
+		return nil, err
+	}
+	type backup struct {
+		path, stamp string
+		seq         int
+	}
+	var found []backup
+	for _, m := range matches {
+		name := strings.TrimSuffix(strings.TrimPrefix(m, f.path+"."), ".gz")
+		if len(name) < len(backupTimeFormat) {
+			continue
+		}
+		stamp, rest := name[:len(backupTimeFormat)], name[len(backupTimeFormat):]
+		if _, err := time.Parse(backupTimeFormat, stamp); err != nil {
+			continue
+		}
+		b := backup{path: m, stamp: stamp}
+		if rest != "" {
+			if b.seq, err = strconv.Atoi(strings.TrimPrefix(rest, "-")); err != nil {
+				continue
+			}
+		}
+		found = append(found, b)
+	}
+
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].stamp != found[j].stamp {
+			return found[i].stamp < found[j].stamp
+		}
+		return found[i].seq < found[j].seq
+	})
+	backups := make([]string, len(found))
+	for i, b := range found {
+		backups[i] = b.path
+	}
+	return backups, nil
+}
+
+//compressFile gzips path to path.gz and removes path
+func compressFile(path string) error {
+	in, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+
+	out, err := os.Create(path + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	zw.Name = filepath.Base(path)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		os.Remove(path + ".gz")
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(path)
+}
@@ -0,0 +1,204 @@
+package logging
+
+import (
+	"compress/gzip"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func readGzip(t *testing.T, path string) string {
+	file, err := os.Open(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer file.Close()
+	zr, err := gzip.NewReader(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(zr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func readFile(t *testing.T, path string) string {
+	b, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return string(b)
+}
+
+func TestRotatingFileRotatesBySize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxSize: 20})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lines := []string{"first line\n", "second line\n", "third line\n"}
+	for _, line := range lines {
+		f.Write([]byte(line))
+	}
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+	for i, backup := range backups {
+		if contents := readGzip(t, backup); contents != lines[i] {
+			t.Errorf("Backup %d expected %q, got %q", i, lines[i], contents)
+		}
+	}
+	if contents := readFile(t, path); contents != lines[2] {
+		t.Errorf("Current log file expected %q, got %q", lines[2], contents)
+	}
+}
+
+func TestRotatingFileKeepsMaxBackups(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{MaxBackups: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	for _, line := range []string{"1\n", "2\n", "3\n", "4\n"} {
+		f.Write([]byte(line))
+		if err := f.Rotate(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	f.compressing.Wait()
+
+	backups, err := f.Backups()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(backups) != 2 {
+		t.Fatalf("Expected 2 backups, got %v", backups)
+	}
+	if a, b := readGzip(t, backups[0]), readGzip(t, backups[1]); a != "3\n" || b != "4\n" {
+		t.Fatalf("Expected the newest backups 3 and 4 to be kept, got %q and %q", a, b)
+	}
+}
+
+func TestRotatingFileRotatesByTime(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{Interval: 20 * time.Millisecond})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before the interval\n"))
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		f.Reopen() //waits for the write to land
+		f.compressing.Wait()
+		if backups, _ := f.Backups(); len(backups) == 1 {
+			if contents := readGzip(t, backups[0]); contents != "before the interval\n" {
+				t.Fatalf("Backup expected the line written before rotating, got %q", contents)
+			}
+			return
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("File wasn't rotated after its interval")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+}
+
+func TestRotatingFileDropsInsteadOfBlocking(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "access.log")
+	//Simulate a disk that's stuck until we say otherwise
+	stuck := make(chan struct{})
+	f, err := openRotatingFile(path, RotateOptions{BufferSize: 2},
+		func() { <-stuck })
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wrote := make(chan struct{})
+	go func() {
+		for i := 0; i < 10; i++ {
+			f.Write([]byte("line\n"))
+		}
+		close(wrote)
+	}()
+	select {
+	case <-wrote:
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Write blocked on a stuck disk")
+	}
+
+	//One write is stuck in the writer goroutine and two are queued
+	if dropped := f.Dropped(); dropped < 7 {
+		t.Fatalf("Expected at least 7 dropped writes, got %d", dropped)
+	}
+	close(stuck)
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	written := strings.Count(readFile(t, path), "line\n")
+	if int64(written)+f.Dropped() != 10 {
+		t.Fatalf("Expected written + dropped to be 10, got %d + %d", written, f.Dropped())
+	}
+}
+
+func TestRotatingFileKeepsFileWhenReopenFails(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Write([]byte("before\n"))
+
+	//Move the file aside and put a directory in its place, so opening the
+	//path again fails
+	moved := filepath.Join(dir, "access.log.old")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Mkdir(path, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := f.Reopen(); err == nil {
+		t.Fatal("Reopen expected an error opening a directory")
+	}
+
+	f.Write([]byte("after\n"))
+	if err := f.Close(); err != nil {
+		t.Fatalf("Close expected no write errors, got %v", err)
+	}
+	if contents := readFile(t, moved); contents != "before\nafter\n" {
+		t.Fatalf("Old log file expected both lines, got %q", contents)
+	}
+}
+
+func TestRotatingFileClosed(t *testing.T) {
+	f, err := OpenRotatingFile(filepath.Join(t.TempDir(), "access.log"), RotateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	if _, err := f.Write([]byte("too late\n")); err != ErrRotatingFileClosed {
+		t.Fatalf("Write after Close expected ErrRotatingFileClosed, got %v", err)
+	}
+	if err := f.Rotate(); err != ErrRotatingFileClosed {
+		t.Fatalf("Rotate after Close expected ErrRotatingFileClosed, got %v", err)
+	}
+}
@@ -0,0 +1,51 @@
+//go:build unix
+
+package logging
+
+import (
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestRotatingFileReopensOnSIGHUP(t *testing.T) {
+	dir := t.TempDir()
+	path := filepath.Join(dir, "access.log")
+	f, err := OpenRotatingFile(path, RotateOptions{ReopenOnSIGHUP: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	f.Write([]byte("before logrotate\n"))
+	f.Reopen() //waits for the write to land
+
+	//Do what logrotate does: move the file, then send SIGHUP
+	moved := filepath.Join(dir, "access.log.1")
+	if err := os.Rename(path, moved); err != nil {
+		t.Fatal(err)
+	}
+	syscall.Kill(os.Getpid(), syscall.SIGHUP)
+
+	deadline := time.Now().Add(5 * time.Second)
+	for {
+		if _, err := os.Stat(path); err == nil {
+			break
+		}
+		if time.Now().After(deadline) {
+			t.Fatalf("File wasn't reopened after SIGHUP")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+
+	f.Write([]byte("after logrotate\n"))
+	f.Reopen()
+	if contents := readFile(t, moved); contents != "before logrotate\n" {
+		t.Errorf("Moved file expected the line from before, got %q", contents)
+	}
+	if contents := readFile(t, path); contents != "after logrotate\n" {
+		t.Errorf("Reopened file expected the line from after, got %q", contents)
+	}
+}
@@ -0,0 +1,67 @@
+//Package method dispatches requests to a handler for each HTTP method,
+//taking care of the parts of method handling that are easy to forget when
+//writing it by hand: HEAD, OPTIONS and the Allow header.
+package method
+
+import (
+	"net/http"
+	"sort"
+	"strings"
+)
+
+//A Handler maps HTTP methods to the Handler for each of them, like
+//gorilla/handlers' MethodHandler:
+//
+//	mux.Handle("/coffee-shop", method.Handler{
+//		"GET":  orderForm,
+//		"POST": sendOrder,
+//	})
+//
+//A HEAD request is served by the GET handler if there isn't a HEAD one,
+//and an OPTIONS request without an OPTIONS handler gets a 204 No Content
+//listing the allowed methods in its Allow header. Any other method gets a
+//405 Method Not Allowed with the same Allow header.
+type Handler map[string]http.Handler
+
+func (h Handler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	//An empty method means GET to net/http's client
+	m := r.Method
+	if m == "" {
+		m = http.MethodGet
+	}
+
+	if handler, ok := h[m]; ok {
+		handler.ServeHTTP(w, r)
+		return
+	}
+	if get, ok := h[http.MethodGet]; ok && m == http.MethodHead {
+		//The server leaves out the body of a response to a HEAD request
+		get.ServeHTTP(w, r)
+		return
+	}
+
+	w.Header().Set("Allow", h.Allow())
+	if m == http.MethodOptions {
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	http.Error(w, "405 Method Not Allowed", http.StatusMethodNotAllowed)
+}
+
+//Allow returns the value of the Allow header for h: its methods, plus HEAD
+//if it handles GET and OPTIONS, sorted and separated by commas
+func (h Handler) Allow() string {
+	methods := []string{http.MethodOptions}
+	for m := range h {
+		if m != http.MethodOptions && m != http.MethodHead {
+			methods = append(methods, m)
+		}
+	}
+	if _, ok := h[http.MethodGet]; ok {
+		methods = append(methods, http.MethodHead)
+	} else if _, ok := h[http.MethodHead]; ok {
+		methods = append(methods, http.MethodHead)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
@@ -0,0 +1,101 @@
+package method
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func write(body string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(body))
+	})
+}
+
+var coffeeShop = Handler{
+	"GET":  write("order form"),
+	"POST": write("order sent"),
+}
+
+func serve(h http.Handler, method string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/coffee-shop", nil)
+	r.Method = method
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestDispatch(t *testing.T) {
+	tests := map[string]string{
+		"GET":  "order form",
+		"":     "order form",
+		"HEAD": "order form",
+		"POST": "order sent",
+	}
+	for method, body := range tests {
+		w := serve(coffeeShop, method)
+		if w.Code != 200 || w.Body.String() != body {
+			t.Errorf("%q request expected 200 %q, got %d %q", method, body, w.Code, w.Body.String())
+		}
+		if allow := w.Header().Get("Allow"); allow != "" {
+			t.Errorf("%q request expected no Allow header, got %q", method, allow)
+		}
+	}
+}
+
+func TestMethodNotAllowed(t *testing.T) {
+	for _, method := range []string{"PUT", "DELETE", "PATCH"} {
+		w := serve(coffeeShop, method)
+		if w.Code != 405 {
+			t.Errorf("%s request expected 405, got %d", method, w.Code)
+		}
+		if allow := w.Header().Get("Allow"); allow != "GET, HEAD, OPTIONS, POST" {
+			t.Errorf("Allow header expected \"GET, HEAD, OPTIONS, POST\", got %q", allow)
+		}
+	}
+}
+
+func TestOptions(t *testing.T) {
+	w := serve(coffeeShop, "OPTIONS")
+	if w.Code != 204 || w.Header().Get("Allow") != "GET, HEAD, OPTIONS, POST" {
+		t.Fatalf("OPTIONS expected 204 with Allow \"GET, HEAD, OPTIONS, POST\", got %d with %q",
+			w.Code, w.Header().Get("Allow"))
+	}
+
+	custom := Handler{"OPTIONS": write("custom options"), "POST": write("order sent")}
+	if w := serve(custom, "OPTIONS"); w.Body.String() != "custom options" {
+		t.Fatalf("OPTIONS with its own handler expected \"custom options\", got %q", w.Body.String())
+	}
+}
+
+func TestAllow(t *testing.T) {
+	tests := []struct {
+		h     Handler
+		allow string
+	}{
+		{Handler{}, "OPTIONS"},
+		{Handler{"POST": write("")}, "OPTIONS, POST"},
+		{Handler{"HEAD": write("")}, "HEAD, OPTIONS"},
+		{Handler{"GET": write(""), "HEAD": write(""), "DELETE": write("")}, "DELETE, GET, HEAD, OPTIONS"},
+	}
+	for _, test := range tests {
+		if allow := test.h.Allow(); allow != test.allow {
+			t.Errorf("Allow expected %q, got %q", test.allow, allow)
+		}
+	}
+}
+
+func TestHeadThroughServer(t *testing.T) {
+	s := httptest.NewServer(coffeeShop)
+	defer s.Close()
+
+	res, err := http.Head(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.StatusCode != 200 || res.ContentLength != int64(len("order form")) {
+		t.Fatalf("HEAD expected 200 with the GET response's length, got %d with %d",
+			res.StatusCode, res.ContentLength)
+	}
+}
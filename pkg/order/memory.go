@@ -0,0 +1,111 @@
+package order
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+//A MemoryRepository keeps orders in memory, so they're gone when the
+//program exits
+type MemoryRepository struct {
+	mu      sync.Mutex
+	records []Record //sorted by ID
+	nextID  int64
+	now     func() time.Time
+}
+
+//NewMemoryRepository makes an empty MemoryRepository
+func NewMemoryRepository() *MemoryRepository {
+	return &MemoryRepository{nextID: 1, now: time.Now}
+}
+
+func (m *MemoryRepository) Create(ctx context.Context, o Order) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	now := m.now().UTC()
+	rec := Record{ID: m.nextID, Order: o, Status: Received, Version: 1,
+		CreatedAt: now, UpdatedAt: now}
+	m.nextID++
+	m.records = append(m.records, rec)
+	return rec, nil
+}
+
+func (m *MemoryRepository) Get(ctx context.Context, id int64) (Record, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(id, AnyVersion)
+	if err != nil {
+		return Record{}, err
+	}
+	return m.records[i], nil
+}
+
+func (m *MemoryRepository) List(ctx context.Context, offset, limit int) ([]Record, int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	total := len(m.records)
+	start := min(max(offset, 0), total)
+	end := min(start+max(limit, 0), total)
+	return append([]Record(nil), m.records[start:end]...), total, nil
+}
+
+func (m *MemoryRepository) Update(ctx context.Context, id, version int64, status Status) (Record, error) {
+	if !status.Valid() {
+		return Record{}, ErrInvalidStatus
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(id, version)
+	if err != nil {
+		return Record{}, err
+	}
+	rec := &m.records[i]
+	rec.Status = status
+	rec.Version++
+	rec.UpdatedAt = m.now().UTC()
+	return *rec, nil
+}
+
+func (m *MemoryRepository) Delete(ctx context.Context, id, version int64) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	i, err := m.find(id, version)
+	if err != nil {
+		return err
+	}
+	m.records = append(m.records[:i], m.records[i+1:]...)
+	return nil
+}
+
+//Close does nothing; it's there to make a MemoryRepository a Repository
+func (m *MemoryRepository) Close() error {
+	return nil
+}
+
+//find returns the index of the record with the ID id, checking its version
+//unless version is AnyVersion. m.mu must be held.
+func (m *MemoryRepository) find(id, version int64) (int, error) {
+	lo, hi := 0, len(m.records)
+	for lo < hi {
+		mid := (lo + hi) / 2
+		if m.records[mid].ID < id {
+			lo = mid + 1
+		} else {
+			hi = mid
+		}
+	}
+	if lo == len(m.records) || m.records[lo].ID != id {
+		return 0, ErrNotFound
+	}
+	if version != AnyVersion && m.records[lo].Version != version {
+		return 0, ErrVersionConflict
+	}
+	return lo, nil
+}
@@ -0,0 +1,96 @@
+//Package order has the coffee shop Order the http-verbs samples take from
+//their order forms and JSON clients, and the responses they send back.
+package order
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/content"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+)
+
+//Beverages is the menu of beverages an Order can be for
+var Beverages = []string{"coffee", "latte", "cappuccino", "espresso",
+	"mocha", "tea", "chai", "hot chocolate"}
+
+//An Order is one beverage for one customer
+type Order struct {
+	Name     string `form:"name" json:"name" label:"Your name" validate:"required,max=64"`
+	Beverage string `form:"beverage" json:"beverage" label:"Your beverage order" validate:"required,max=32"`
+}
+
+//Validate checks the beverage is on the menu. It's checked here instead of
+//with a oneof rule in its tag so Beverages is the only copy of the menu.
+func (o Order) Validate() form.Errors {
+	if o.Beverage == "" || form.OneOf(o.Beverage, Beverages) {
+		return nil
+	}
+	return form.Errors{"beverage": "Your beverage order must be one of " + strings.Join(Beverages, ", ")}
+}
+
+//Confirmation is the JSON response to a valid order
+type Confirmation struct {
+	Order
+	Message string `json:"message"`
+}
+
+//An ErrorResponse is the JSON response to an order that can't be taken
+type ErrorResponse struct {
+	Error  string      `json:"error"`
+	Fields form.Errors `json:"fields,omitempty"`
+}
+
+//Decode reads an Order from r's body, which can be a urlencoded or
+//multipart form or JSON. If the order can't be read or is invalid, Decode
+//responds to the request itself in the format the client accepts and
+//returns false: an invalid order gets a 422 status, with the order form and
+//its error messages for HTML clients, and a body that can't be parsed gets
+//a 400, 413 or 415.
+func Decode(w http.ResponseWriter, r *http.Request) (Order, bool) {
+	var o Order
+	err := content.Decode(w, r, &o)
+	if err == nil {
+		o.Beverage = strings.ToLower(o.Beverage)
+		return o, true
+	}
+
+	status := content.Status(err)
+	errs, _ := err.(form.Errors)
+	msg := http.StatusText(status)
+	if errs != nil {
+		msg = errs.Error()
+	}
+
+	page := Pages.Offer(r, "error", msg)
+	if errs != nil {
+		//The form posts back to the route it came from, like the static
+		//order forms' relative actions
+		page = Pages.Offer(r, "order-form", FormData{
+			Action:    path.Base(r.URL.Path),
+			Order:     o,
+			Errors:    errs,
+			Beverages: Beverages,
+		})
+	}
+	content.Respond(w, r, status, page,
+		content.JSON(ErrorResponse{Error: http.StatusText(status), Fields: errs}),
+		content.Text("%s", msg))
+	return o, false
+}
+
+//Confirm responds to the valid order o with a message saying it's coming
+//right up, in the format the client accepts
+func Confirm(w http.ResponseWriter, r *http.Request, o Order) {
+	msg := confirmation(o)
+	content.Respond(w, r, http.StatusOK,
+		Pages.Offer(r, "confirmation", ConfirmationData{Order: o}),
+		content.JSON(Confirmation{Order: o, Message: msg}),
+		content.Text("%s", msg))
+}
+
+func confirmation(o Order) string {
+	return fmt.Sprintf("One %s coming right up, %s!", o.Beverage, o.Name)
+}
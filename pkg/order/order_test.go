@@ -0,0 +1,135 @@
+package order
+
+import (
+	"net/http/httptest"
+	"net/url"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/csrf"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+)
+
+func sendOrder(path string, values url.Values) (Order, bool, *httptest.ResponseRecorder) {
+	r := httptest.NewRequest("POST", path, strings.NewReader(values.Encode()))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	o, ok := Decode(w, r)
+	return o, ok, w
+}
+
+func TestDecodeValidOrder(t *testing.T) {
+	o, ok, w := sendOrder("/send-order", url.Values{"name": {"Andy"}, "beverage": {"Hot Chocolate"}})
+	if !ok {
+		t.Fatalf("Valid order expected to decode, got %d %q", w.Code, w.Body.String())
+	}
+	if expected := (Order{"Andy", "hot chocolate"}); o != expected {
+		t.Fatalf("Decoded order expected %+v, got %+v", expected, o)
+	}
+	if w.Body.Len() != 0 {
+		t.Fatalf("Decode for a valid order expected not to respond, got %q", w.Body.String())
+	}
+}
+
+func TestDecodeInvalidOrder(t *testing.T) {
+	_, ok, w := sendOrder("/coffee-shop", url.Values{"name": {""},
+		"beverage": {"<b>duck venom</b>"}})
+	if ok {
+		t.Fatal("Invalid order expected not to decode")
+	}
+	if w.Code != 422 {
+		t.Fatalf("Status for an invalid order expected 422, got %d", w.Code)
+	}
+
+	body := w.Body.String()
+	for _, s := range []string{
+		`action="coffee-shop"`,
+		"Your name is required",
+		"Your beverage order must be one of coffee, latte",
+		`value="&lt;b&gt;duck venom&lt;/b&gt;"`,
+	} {
+		if !strings.Contains(body, s) {
+			t.Errorf("Re-rendered form expected to contain %q, got %q", s, body)
+		}
+	}
+}
+
+func TestDecodeMalformedOrder(t *testing.T) {
+	r := httptest.NewRequest("POST", "/send-order", strings.NewReader("name=%zz"))
+	r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	w := httptest.NewRecorder()
+	if _, ok := Decode(w, r); ok || w.Code != 400 {
+		t.Fatalf("Malformed order expected a 400, got %d", w.Code)
+	}
+}
+
+func TestBeveragesValidation(t *testing.T) {
+	for _, beverage := range Beverages {
+		if errs := form.Validate(Order{"Andy", strings.ToUpper(beverage)}); errs != nil {
+			t.Errorf("%s expected to be on the menu, got %v", beverage, errs)
+		}
+	}
+	expected := form.Errors{"beverage": "Your beverage order must be one of " + strings.Join(Beverages, ", ")}
+	if errs := form.Validate(Order{"Andy", "duck venom"}); !reflect.DeepEqual(errs, expected) {
+		t.Fatalf("Beverage off the menu expected %v, got %v", expected, errs)
+	}
+}
+
+func TestDecodeJSONOrder(t *testing.T) {
+	r := httptest.NewRequest("POST", "/coffee-shop", strings.NewReader(`{"name": "Andy", "beverage": "Latte"}`))
+	r.Header.Set("Content-Type", "application/json")
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	o, ok := Decode(w, r)
+	if !ok {
+		t.Fatalf("Valid JSON order expected to decode, got %d %q", w.Code, w.Body.String())
+	}
+
+	Confirm(w, r, o)
+	expected := `{"name":"Andy","beverage":"latte","message":"One latte coming right up, Andy!"}` + "\n"
+	if w.Body.String() != expected {
+		t.Fatalf("JSON confirmation expected %q, got %q", expected, w.Body.String())
+	}
+}
+
+func TestInvalidOrderAsJSONAndText(t *testing.T) {
+	for accept, expected := range map[string]string{
+		"application/json": `{"error":"Unprocessable Entity","fields":{"name":"Your name is required"}}` + "\n",
+		"text/plain":       "Your name is required\n",
+	} {
+		r := httptest.NewRequest("POST", "/send-order", strings.NewReader("beverage=tea"))
+		r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		r.Header.Set("Accept", accept)
+		w := httptest.NewRecorder()
+		if _, ok := Decode(w, r); ok || w.Code != 422 {
+			t.Fatalf("Invalid order expected a 422, got %d", w.Code)
+		}
+		if w.Body.String() != expected {
+			t.Errorf("%s response for an invalid order expected %q, got %q", accept, expected, w.Body.String())
+		}
+	}
+}
+
+func TestConfirmHTML(t *testing.T) {
+	w := httptest.NewRecorder()
+	Confirm(w, httptest.NewRequest("POST", "/send-order", nil), Order{"<Andy>", "tea"})
+	if expected := "<p>One tea coming right up, &lt;Andy&gt;!</p>"; !strings.Contains(w.Body.String(), expected) {
+		t.Fatalf("HTML confirmation expected to contain %q, got %q", expected, w.Body.String())
+	}
+	if strings.Contains(w.Body.String(), "order number") {
+		t.Fatal("HTML confirmation of an order that wasn't stored expected no order number")
+	}
+}
+
+func TestFormHandlerWithCSRF(t *testing.T) {
+	h := csrf.New([]byte("sloth key")).Middleware(FormHandler("coffee-shop"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, httptest.NewRequest("GET", "/coffee-shop", nil))
+
+	body := w.Body.String()
+	if !strings.Contains(body, `action="coffee-shop"`) ||
+		!strings.Contains(body, `<input type="hidden" name="csrf_token" value="`) {
+		t.Fatalf("Order form expected to post to coffee-shop with a CSRF token, got %q", body)
+	}
+}
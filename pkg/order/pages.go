@@ -0,0 +1,64 @@
+package order
+
+import (
+	"embed"
+	"io/fs"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/render"
+)
+
+//go:embed templates
+var templates embed.FS
+
+//Pages renders the order pages in templates/: order-form with a FormData,
+//confirmation with a ConfirmationData and error with a message. They're
+//embedded in the binary, but with MEAN_GOPHER_DEV set they're read from
+//this package's source directory and parsed on every render instead, so
+//edits show up without restarting the server.
+var Pages = newPages()
+
+func newPages() *render.Renderer {
+	if render.Dev() {
+		if _, file, _, ok := runtime.Caller(0); ok {
+			dir := filepath.Join(filepath.Dir(file), "templates")
+			if _, err := os.Stat(dir); err == nil {
+				return render.Must(render.New(os.DirFS(dir), render.Options{Dev: true}))
+			}
+		}
+	}
+	fsys, err := fs.Sub(templates, "templates")
+	if err != nil {
+		panic(err)
+	}
+	return render.Must(render.New(fsys, render.Options{}))
+}
+
+//FormData is what the order-form page is rendered with
+type FormData struct {
+	Action    string
+	Order     Order
+	Errors    form.Errors
+	Beverages []string
+}
+
+//ConfirmationData is what the confirmation page is rendered with. ID is
+//the order's ID if it was stored.
+type ConfirmationData struct {
+	Order
+	ID int64
+}
+
+//FormHandler serves an empty order form posting to action
+func FormHandler(action string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Pages.HTML(w, r, http.StatusOK, "order-form", FormData{
+			Action:    action,
+			Beverages: Beverages,
+		})
+	})
+}
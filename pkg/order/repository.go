@@ -0,0 +1,93 @@
+package order
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"time"
+)
+
+//A Status is where an order is at in the coffee shop
+type Status string
+
+//The statuses an order goes through. New orders are Received.
+const (
+	Received Status = "received"
+	Brewing  Status = "brewing"
+	Ready    Status = "ready"
+	Served   Status = "served"
+)
+
+//Statuses lists every Status in the order orders go through them
+var Statuses = []Status{Received, Brewing, Ready, Served}
+
+//Valid reports whether s is one of Statuses
+func (s Status) Valid() bool {
+	for _, status := range Statuses {
+		if s == status {
+			return true
+		}
+	}
+	return false
+}
+
+//A Record is an Order that's been placed and stored in a Repository
+type Record struct {
+	ID int64 `json:"id"`
+	Order
+	Status Status `json:"status"`
+	//Version starts at 1 and goes up every time the record is changed
+	Version   int64     `json:"version"`
+	CreatedAt time.Time `json:"created_at"`
+	UpdatedAt time.Time `json:"updated_at"`
+}
+
+//ETag returns the record's entity tag, which changes whenever the record
+//does
+func (rec Record) ETag() string {
+	return fmt.Sprintf(`"%d-%d"`, rec.ID, rec.Version)
+}
+
+var (
+	//ErrNotFound is returned for an order ID that isn't in a Repository
+	ErrNotFound = errors.New("order: not found")
+	//ErrVersionConflict is returned when changing a record whose version
+	//isn't the one the change was meant for
+	ErrVersionConflict = errors.New("order: version conflict")
+	//ErrInvalidStatus is returned when updating a record to an unknown Status
+	ErrInvalidStatus = errors.New("order: invalid status")
+)
+
+//AnyVersion can be passed to Update and Delete to change a record whatever
+//its version is
+const AnyVersion = 0
+
+//A Repository stores placed orders. Its methods are safe to call from
+//multiple goroutines.
+type Repository interface {
+	//Create stores o as a new Received record
+	Create(ctx context.Context, o Order) (Record, error)
+	//Get returns the record with the ID id, or ErrNotFound
+	Get(ctx context.Context, id int64) (Record, error)
+	//List returns up to limit records, oldest first, skipping the first
+	//offset, along with the total number of records
+	List(ctx context.Context, offset, limit int) (records []Record, total int, err error)
+	//Update changes the status of the record with the ID id if its version
+	//is version or version is AnyVersion, returning ErrVersionConflict
+	//otherwise
+	Update(ctx context.Context, id, version int64, status Status) (Record, error)
+	//Delete removes the record with the ID id if its version is version or
+	//version is AnyVersion, returning ErrVersionConflict otherwise
+	Delete(ctx context.Context, id, version int64) error
+	//Close releases the Repository's resources
+	Close() error
+}
+
+//Open opens the SQLite database at path as a Repository, or makes a
+//MemoryRepository if path is ""
+func Open(path string) (Repository, error) {
+	if path == "" {
+		return NewMemoryRepository(), nil
+	}
+	return OpenSQLite(path)
+}
@@ -0,0 +1,165 @@
+package order
+
+import (
+	"context"
+	"path/filepath"
+	"sync"
+	"testing"
+)
+
+//testRepository runs the tests every Repository should pass against the
+//repository open returns
+func testRepository(t *testing.T, open func(t *testing.T) Repository) {
+	ctx := context.Background()
+
+	t.Run("CreateAndGet", func(t *testing.T) {
+		repo := open(t)
+		created, err := repo.Create(ctx, Order{"Andy", "latte"})
+		if err != nil {
+			t.Fatal(err)
+		}
+		if created.ID == 0 || created.Status != Received || created.Version != 1 ||
+			created.CreatedAt.IsZero() {
+			t.Fatalf("New record expected an ID, received status and version 1, got %+v", created)
+		}
+
+		got, err := repo.Get(ctx, created.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !got.CreatedAt.Equal(created.CreatedAt) {
+			t.Fatalf("Record creation time expected %v, got %v", created.CreatedAt, got.CreatedAt)
+		}
+		got.CreatedAt, got.UpdatedAt = created.CreatedAt, created.UpdatedAt
+		if got != created {
+			t.Fatalf("Stored record expected %+v, got %+v", created, got)
+		}
+		if _, err := repo.Get(ctx, created.ID+1); err != ErrNotFound {
+			t.Fatalf("Getting a missing record expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("List", func(t *testing.T) {
+		repo := open(t)
+		for _, name := range []string{"Andy", "Larry", "Lola", "Sid", "Lorenzo"} {
+			if _, err := repo.Create(ctx, Order{name, "tea"}); err != nil {
+				t.Fatal(err)
+			}
+		}
+
+		records, total, err := repo.List(ctx, 2, 2)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if total != 5 || len(records) != 2 || records[0].Name != "Lola" || records[1].Name != "Sid" {
+			t.Fatalf("Second page of 2 expected Lola and Sid of 5, got %+v of %d", records, total)
+		}
+		if records, _, _ := repo.List(ctx, 4, 2); len(records) != 1 {
+			t.Fatalf("Last page of 2 expected 1 record, got %d", len(records))
+		}
+		if records, _, _ := repo.List(ctx, 10, 2); len(records) != 0 {
+			t.Fatalf("Page past the end expected no records, got %d", len(records))
+		}
+	})
+
+	t.Run("Update", func(t *testing.T) {
+		repo := open(t)
+		rec, _ := repo.Create(ctx, Order{"Andy", "mocha"})
+
+		updated, err := repo.Update(ctx, rec.ID, rec.Version, Brewing)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if updated.Status != Brewing || updated.Version != 2 || updated.ETag() == rec.ETag() {
+			t.Fatalf("Updated record expected brewing at version 2 with a new ETag, got %+v", updated)
+		}
+
+		if _, err := repo.Update(ctx, rec.ID, rec.Version, Ready); err != ErrVersionConflict {
+			t.Fatalf("Update with an old version expected ErrVersionConflict, got %v", err)
+		}
+		if _, err := repo.Update(ctx, rec.ID, AnyVersion, Ready); err != nil {
+			t.Fatalf("Update with AnyVersion expected no error, got %v", err)
+		}
+		if _, err := repo.Update(ctx, rec.ID, AnyVersion, "spilled"); err != ErrInvalidStatus {
+			t.Fatalf("Update to an unknown status expected ErrInvalidStatus, got %v", err)
+		}
+		if _, err := repo.Update(ctx, rec.ID+1, AnyVersion, Ready); err != ErrNotFound {
+			t.Fatalf("Updating a missing record expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("Delete", func(t *testing.T) {
+		repo := open(t)
+		rec, _ := repo.Create(ctx, Order{"Andy", "chai"})
+
+		if err := repo.Delete(ctx, rec.ID, rec.Version+1); err != ErrVersionConflict {
+			t.Fatalf("Delete with the wrong version expected ErrVersionConflict, got %v", err)
+		}
+		if err := repo.Delete(ctx, rec.ID, rec.Version); err != nil {
+			t.Fatal(err)
+		}
+		if err := repo.Delete(ctx, rec.ID, AnyVersion); err != ErrNotFound {
+			t.Fatalf("Deleting a deleted record expected ErrNotFound, got %v", err)
+		}
+	})
+
+	t.Run("ConcurrentUpdates", func(t *testing.T) {
+		repo := open(t)
+		rec, _ := repo.Create(ctx, Order{"Andy", "espresso"})
+
+		//Only one of several updates for the same version can win
+		var wg sync.WaitGroup
+		var mu sync.Mutex
+		wins := 0
+		for i := 0; i < 8; i++ {
+			wg.Add(1)
+			go func() {
+				defer wg.Done()
+				if _, err := repo.Update(ctx, rec.ID, rec.Version, Brewing); err == nil {
+					mu.Lock()
+					wins++
+					mu.Unlock()
+				}
+			}()
+		}
+		wg.Wait()
+		if wins != 1 {
+			t.Fatalf("Concurrent updates of one version expected 1 to succeed, got %d", wins)
+		}
+	})
+}
+
+func TestMemoryRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		return NewMemoryRepository()
+	})
+}
+
+func TestSQLiteRepository(t *testing.T) {
+	testRepository(t, func(t *testing.T) Repository {
+		repo, err := OpenSQLite(filepath.Join(t.TempDir(), "orders.db"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { repo.Close() })
+		return repo
+	})
+}
+
+func TestSQLiteRepositoryReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "orders.db")
+	repo, err := OpenSQLite(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec, _ := repo.Create(context.Background(), Order{"Andy", "latte"})
+	repo.Close()
+
+	if repo, err = OpenSQLite(path); err != nil {
+		t.Fatal(err)
+	}
+	defer repo.Close()
+	if got, err := repo.Get(context.Background(), rec.ID); err != nil || got.Name != "Andy" {
+		t.Fatalf("Record after reopening expected Andy's order, got %+v (%v)", got, err)
+	}
+}
@@ -0,0 +1,290 @@
+package order
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/content"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+)
+
+//Page sizes for listing orders, and the last page that can be asked for,
+//which keeps a page's offset from overflowing
+const (
+	DefaultPerPage = 20
+	MaxPerPage     = 100
+	MaxPage        = 1 << 20
+)
+
+//A Resource serves the orders in a Repository over HTTP. Its Get, Patch
+//and Delete methods take the order ID as an argument, so each router can
+//pass in the ID from its own kind of route parameters:
+//
+//	//Gorilla
+//	m.HandleFunc("/orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+//		res.Get(w, r, mux.Vars(r)["id"])
+//	}).Methods("GET")
+//
+//	//Goji
+//	m.Get("/orders/:id", func(c web.C, w http.ResponseWriter, r *http.Request) {
+//		res.Get(w, r, c.URLParams["id"])
+//	})
+type Resource struct {
+	Repo Repository
+}
+
+//NewResource makes a Resource serving the orders in repo
+func NewResource(repo Repository) *Resource {
+	return &Resource{Repo: repo}
+}
+
+//Placed is the JSON response to a stored order
+type Placed struct {
+	Record
+	Message string `json:"message"`
+}
+
+//A StatusUpdate is the body of a PATCH request changing an order's status
+type StatusUpdate struct {
+	Status Status `form:"status" json:"status" validate:"required,oneof=received|brewing|ready|served"`
+}
+
+//Place decodes an order like Decode and stores it, responding with a 201
+//Created pointing to the order's URL under /orders/
+func (res *Resource) Place(w http.ResponseWriter, r *http.Request) {
+	o, ok := Decode(w, r)
+	if !ok {
+		return
+	}
+	rec, err := res.Repo.Create(r.Context(), o)
+	if err != nil {
+		res.serverError(w, r, err)
+		return
+	}
+
+	w.Header().Set("Location", fmt.Sprintf("/orders/%d", rec.ID))
+	w.Header().Set("ETag", rec.ETag())
+	msg := confirmation(o)
+	content.Respond(w, r, http.StatusCreated,
+		Pages.Offer(r, "confirmation", ConfirmationData{Order: o, ID: rec.ID}),
+		content.JSON(Placed{Record: rec, Message: msg}),
+		content.Text("%s", msg))
+}
+
+//A Page is the JSON response to listing orders
+type Page struct {
+	Orders  []Record `json:"orders"`
+	Page    int      `json:"page"`
+	PerPage int      `json:"per_page"`
+	Total   int      `json:"total"`
+}
+
+//List responds with a page of orders, oldest first. The page and per_page
+//query parameters pick the page, and the Link header links to the first,
+//last, previous and next pages.
+func (res *Resource) List(w http.ResponseWriter, r *http.Request) {
+	page, err := queryInt(r, "page", 1, 1, MaxPage)
+	if err != nil {
+		res.fail(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+	perPage, err := queryInt(r, "per_page", DefaultPerPage, 1, MaxPerPage)
+	if err != nil {
+		res.fail(w, r, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	records, total, err := res.Repo.List(r.Context(), (page-1)*perPage, perPage)
+	if err != nil {
+		res.serverError(w, r, err)
+		return
+	}
+	if records == nil {
+		records = []Record{}
+	}
+
+	lastPage := max((total+perPage-1)/perPage, 1)
+	links := []string{pageLink(r.URL, 1, perPage, "first"), pageLink(r.URL, lastPage, perPage, "last")}
+	if page > 1 {
+		links = append(links, pageLink(r.URL, min(page-1, lastPage), perPage, "prev"))
+	}
+	if page < lastPage {
+		links = append(links, pageLink(r.URL, page+1, perPage, "next"))
+	}
+	w.Header().Set("Link", strings.Join(links, ", "))
+	w.Header().Set("X-Total-Count", strconv.Itoa(total))
+
+	content.Respond(w, r, http.StatusOK, content.JSON(Page{
+		Orders:  records,
+		Page:    page,
+		PerPage: perPage,
+		Total:   total,
+	}))
+}
+
+//Get responds with the order with the ID id, or a 304 Not Modified if the
+//request's If-None-Match header has the order's current ETag
+func (res *Resource) Get(w http.ResponseWriter, r *http.Request, id string) {
+	rec, ok := res.get(w, r, id)
+	if !ok {
+		return
+	}
+
+	w.Header().Set("ETag", rec.ETag())
+	if noneMatch := r.Header.Get("If-None-Match"); noneMatch != "" {
+		for _, tag := range strings.Split(noneMatch, ",") {
+			tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+			if tag == "*" || tag == rec.ETag() {
+				w.WriteHeader(http.StatusNotModified)
+				return
+			}
+		}
+	}
+	content.Respond(w, r, http.StatusOK, content.JSON(rec))
+}
+
+//Patch changes the status of the order with the ID id. The request must
+//have an If-Match header with the order's current ETag, or "*" to change
+//it regardless, so two baristas can't unknowingly overwrite each other's
+//changes: without one it gets a 428 Precondition Required, and with an
+//out-of-date one a 412 Precondition Failed.
+func (res *Resource) Patch(w http.ResponseWriter, r *http.Request, id string) {
+	n, version, ok := res.precondition(w, r, id)
+	if !ok {
+		return
+	}
+
+	var update StatusUpdate
+	if err := content.Decode(w, r, &update); err != nil {
+		status := content.Status(err)
+		errs, _ := err.(form.Errors)
+		content.Respond(w, r, status,
+			content.JSON(ErrorResponse{Error: http.StatusText(status), Fields: errs}),
+			content.Text("%s", err))
+		return
+	}
+	//The oneof rule ignores case, but Status.Valid doesn't, so store the
+	//status the way it's spelled in Statuses, like Decode does beverages
+	update.Status = Status(strings.ToLower(string(update.Status)))
+
+	rec, err := res.Repo.Update(r.Context(), n, version, update.Status)
+	if err != nil {
+		res.repoError(w, r, err)
+		return
+	}
+	w.Header().Set("ETag", rec.ETag())
+	content.Respond(w, r, http.StatusOK, content.JSON(rec))
+}
+
+//Delete deletes the order with the ID id, with the same If-Match
+//requirement as Patch
+func (res *Resource) Delete(w http.ResponseWriter, r *http.Request, id string) {
+	n, version, ok := res.precondition(w, r, id)
+	if !ok {
+		return
+	}
+	if err := res.Repo.Delete(r.Context(), n, version); err != nil {
+		res.repoError(w, r, err)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+//get looks up the order with the ID id, responding with a 404 if there
+//isn't one
+func (res *Resource) get(w http.ResponseWriter, r *http.Request, id string) (Record, bool) {
+	n, err := strconv.ParseInt(id, 10, 64)
+	if err != nil {
+		res.repoError(w, r, ErrNotFound)
+		return Record{}, false
+	}
+	rec, err := res.Repo.Get(r.Context(), n)
+	if err != nil {
+		res.repoError(w, r, err)
+		return Record{}, false
+	}
+	return rec, true
+}
+
+//precondition checks the If-Match header of a request to change the order
+//with the ID id, returning the ID and the version the change is for
+func (res *Resource) precondition(w http.ResponseWriter, r *http.Request, id string) (int64, int64, bool) {
+	rec, ok := res.get(w, r, id)
+	if !ok {
+		return 0, 0, false
+	}
+
+	ifMatch := r.Header.Get("If-Match")
+	if ifMatch == "" {
+		res.fail(w, r, http.StatusPreconditionRequired,
+			"changing an order needs an If-Match header with its ETag")
+		return 0, 0, false
+	}
+	for _, tag := range strings.Split(ifMatch, ",") {
+		switch strings.TrimSpace(tag) {
+		case "*":
+			return rec.ID, AnyVersion, true
+		case rec.ETag():
+			//The repository checks the version again when making the change,
+			//in case the order changes in the meantime
+			return rec.ID, rec.Version, true
+		}
+	}
+	w.Header().Set("ETag", rec.ETag())
+	res.fail(w, r, http.StatusPreconditionFailed, "the order has changed since it was fetched")
+	return 0, 0, false
+}
+
+//repoError responds to an error from the Repository
+func (res *Resource) repoError(w http.ResponseWriter, r *http.Request, err error) {
+	switch {
+	case errors.Is(err, ErrNotFound):
+		res.fail(w, r, http.StatusNotFound, "no such order")
+	case errors.Is(err, ErrVersionConflict):
+		res.fail(w, r, http.StatusPreconditionFailed, "the order has changed since it was fetched")
+	case errors.Is(err, ErrInvalidStatus):
+		res.fail(w, r, http.StatusUnprocessableEntity, err.Error())
+	default:
+		res.serverError(w, r, err)
+	}
+}
+
+func (res *Resource) serverError(w http.ResponseWriter, r *http.Request, err error) {
+	log.Printf("order: %s %s: %v", r.Method, r.URL.Path, err)
+	res.fail(w, r, http.StatusInternalServerError, http.StatusText(http.StatusInternalServerError))
+}
+
+//fail responds with status and msg as JSON or plain text
+func (res *Resource) fail(w http.ResponseWriter, r *http.Request, status int, msg string) {
+	content.Respond(w, r, status,
+		content.JSON(ErrorResponse{Error: msg}),
+		content.Text("%s", msg))
+}
+
+//queryInt returns the integer query parameter key, or def if it's not set,
+//checking that it's from lo to hi
+func queryInt(r *http.Request, key string, def, lo, hi int) (int, error) {
+	s := r.URL.Query().Get(key)
+	if s == "" {
+		return def, nil
+	}
+	n, err := strconv.Atoi(s)
+	if err != nil || n < lo || n > hi {
+		return 0, fmt.Errorf("%s must be a whole number from %d to %d", key, lo, hi)
+	}
+	return n, nil
+}
+
+//pageLink makes a Link header entry for page of u
+func pageLink(u *url.URL, page, perPage int, rel string) string {
+	q := u.Query()
+	q.Set("page", strconv.Itoa(page))
+	q.Set("per_page", strconv.Itoa(perPage))
+	link := url.URL{Path: u.Path, RawQuery: q.Encode()}
+	return fmt.Sprintf(`<%s>; rel="%s"`, link.String(), rel)
+}
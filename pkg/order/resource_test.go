@@ -0,0 +1,178 @@
+package order
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//newServer serves res with the same routes the sample servers register
+func newServer(res *Resource) *http.ServeMux {
+	mux := http.NewServeMux()
+	mux.HandleFunc("POST /coffee-shop", res.Place)
+	mux.HandleFunc("GET /orders", res.List)
+	mux.HandleFunc("GET /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		res.Get(w, r, r.PathValue("id"))
+	})
+	mux.HandleFunc("PATCH /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		res.Patch(w, r, r.PathValue("id"))
+	})
+	mux.HandleFunc("DELETE /orders/{id}", func(w http.ResponseWriter, r *http.Request) {
+		res.Delete(w, r, r.PathValue("id"))
+	})
+	return mux
+}
+
+func do(h http.Handler, method, path, body string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest(method, path, strings.NewReader(body))
+	r.Header.Set("Accept", "application/json")
+	if body != "" {
+		r.Header.Set("Content-Type", "application/json")
+	}
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestPlaceAndGet(t *testing.T) {
+	h := newServer(NewResource(NewMemoryRepository()))
+
+	w := do(h, "POST", "/coffee-shop", `{"name": "Andy", "beverage": "latte"}`)
+	if w.Code != 201 || w.Header().Get("Location") != "/orders/1" {
+		t.Fatalf("Placing an order expected 201 at /orders/1, got %d at %q",
+			w.Code, w.Header().Get("Location"))
+	}
+	var placed Placed
+	if err := json.Unmarshal(w.Body.Bytes(), &placed); err != nil {
+		t.Fatal(err)
+	}
+	if placed.ID != 1 || placed.Status != Received || placed.Message != "One latte coming right up, Andy!" {
+		t.Fatalf("Placed order expected order 1 received, got %+v", placed)
+	}
+
+	w = do(h, "GET", "/orders/1", "")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || etag != `"1-1"` {
+		t.Fatalf("Getting order 1 expected 200 with ETag \"1-1\", got %d with %q", w.Code, etag)
+	}
+	if w = do(h, "GET", "/orders/1", "", "If-None-Match", etag); w.Code != 304 {
+		t.Fatalf("Getting an unchanged order expected 304, got %d", w.Code)
+	}
+	for _, path := range []string{"/orders/2", "/orders/sloth"} {
+		if w = do(h, "GET", path, ""); w.Code != 404 {
+			t.Errorf("Getting %s expected 404, got %d", path, w.Code)
+		}
+	}
+}
+
+func TestPlaceHTML(t *testing.T) {
+	h := newServer(NewResource(NewMemoryRepository()))
+	w := do(h, "POST", "/coffee-shop", `{"name": "Andy", "beverage": "latte"}`, "Accept", "text/html")
+	if w.Code != 201 || !strings.Contains(w.Body.String(), "Your order number is 1.") {
+		t.Fatalf("Placing an order from a browser expected 201 with its order number, got %d %q",
+			w.Code, w.Body.String())
+	}
+}
+
+func TestPatchAndDeleteConcurrency(t *testing.T) {
+	h := newServer(NewResource(NewMemoryRepository()))
+	do(h, "POST", "/coffee-shop", `{"name": "Andy", "beverage": "latte"}`)
+
+	if w := do(h, "PATCH", "/orders/1", `{"status": "brewing"}`); w.Code != 428 {
+		t.Fatalf("PATCH without If-Match expected 428, got %d", w.Code)
+	}
+
+	w := do(h, "PATCH", "/orders/1", `{"status": "brewing"}`, "If-Match", `"1-1"`)
+	if w.Code != 200 || w.Header().Get("ETag") != `"1-2"` {
+		t.Fatalf("PATCH with the current ETag expected 200 with ETag \"1-2\", got %d with %q",
+			w.Code, w.Header().Get("ETag"))
+	}
+	var rec Record
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != Brewing {
+		t.Fatalf("Patched status expected brewing, got %s", rec.Status)
+	}
+
+	//A second barista working from the old ETag loses
+	w = do(h, "PATCH", "/orders/1", `{"status": "ready"}`, "If-Match", `"1-1"`)
+	if w.Code != 412 || w.Header().Get("ETag") != `"1-2"` {
+		t.Fatalf("PATCH with an old ETag expected 412 with the current ETag, got %d with %q",
+			w.Code, w.Header().Get("ETag"))
+	}
+	if w = do(h, "PATCH", "/orders/1", `{"status": "spilled"}`, "If-Match", "*"); w.Code != 422 {
+		t.Fatalf("PATCH to an unknown status expected 422, got %d", w.Code)
+	}
+	//Statuses aren't case-sensitive
+	w = do(h, "PATCH", "/orders/1", `{"status": "READY"}`, "If-Match", `"1-2"`)
+	if w.Code != 200 || w.Header().Get("ETag") != `"1-3"` {
+		t.Fatalf("PATCH to an upper-case status expected 200 with ETag \"1-3\", got %d: %s", w.Code, w.Body)
+	}
+	if err := json.Unmarshal(w.Body.Bytes(), &rec); err != nil {
+		t.Fatal(err)
+	}
+	if rec.Status != Ready {
+		t.Fatalf("Patched status expected ready, got %s", rec.Status)
+	}
+
+	if w = do(h, "DELETE", "/orders/1", "", "If-Match", `"1-1"`); w.Code != 412 {
+		t.Fatalf("DELETE with an old ETag expected 412, got %d", w.Code)
+	}
+	if w = do(h, "DELETE", "/orders/1", "", "If-Match", `"1-3"`); w.Code != 204 {
+		t.Fatalf("DELETE with the current ETag expected 204, got %d", w.Code)
+	}
+	if w = do(h, "GET", "/orders/1", ""); w.Code != 404 {
+		t.Fatalf("Getting a deleted order expected 404, got %d", w.Code)
+	}
+}
+
+func TestListPagination(t *testing.T) {
+	h := newServer(NewResource(NewMemoryRepository()))
+	for i := 0; i < 5; i++ {
+		do(h, "POST", "/coffee-shop", `{"name": "Andy", "beverage": "tea"}`)
+	}
+
+	w := do(h, "GET", "/orders?page=2&per_page=2", "")
+	var page Page
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Total != 5 || page.Page != 2 || len(page.Orders) != 2 || page.Orders[0].ID != 3 {
+		t.Fatalf("Page 2 of 2 expected orders 3 and 4 of 5, got %+v", page)
+	}
+	if total := w.Header().Get("X-Total-Count"); total != "5" {
+		t.Fatalf("X-Total-Count expected 5, got %q", total)
+	}
+
+	links := w.Header().Get("Link")
+	for _, link := range []string{
+		`</orders?page=1&per_page=2>; rel="first"`,
+		`</orders?page=3&per_page=2>; rel="last"`,
+		`</orders?page=1&per_page=2>; rel="prev"`,
+		`</orders?page=3&per_page=2>; rel="next"`,
+	} {
+		if !strings.Contains(links, link) {
+			t.Errorf("Link header expected to contain %s, got %s", link, links)
+		}
+	}
+
+	for _, query := range []string{"page=0", "page=two", "page=9223372036854775807", "per_page=1000"} {
+		if w := do(h, "GET", "/orders?"+query, ""); w.Code != 400 {
+			t.Errorf("Listing with %s expected 400, got %d", query, w.Code)
+		}
+	}
+
+	w = do(h, "GET", "/orders?page=9", "")
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	if page.Orders == nil || len(page.Orders) != 0 {
+		t.Fatalf("Page past the end expected an empty list, got %v", page.Orders)
+	}
+}
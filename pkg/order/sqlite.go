@@ -0,0 +1,148 @@
+package order
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"fmt"
+	"time"
+
+	_ "modernc.org/sqlite" //Registers the pure Go "sqlite" database/sql driver
+)
+
+const schema = `CREATE TABLE IF NOT EXISTS orders (
+	id         INTEGER PRIMARY KEY AUTOINCREMENT,
+	name       TEXT    NOT NULL,
+	beverage   TEXT    NOT NULL,
+	status     TEXT    NOT NULL,
+	version    INTEGER NOT NULL,
+	created_at INTEGER NOT NULL,
+	updated_at INTEGER NOT NULL
+)`
+
+const columns = `id, name, beverage, status, version, created_at, updated_at`
+
+//A SQLiteRepository keeps orders in a SQLite database file
+type SQLiteRepository struct {
+	db  *sql.DB
+	now func() time.Time
+}
+
+//OpenSQLite opens the SQLite database at path as a SQLiteRepository,
+//creating the file and its orders table if they don't exist yet
+func OpenSQLite(path string) (*SQLiteRepository, error) {
+	db, err := sql.Open("sqlite", path)
+	if err != nil {
+		return nil, fmt.Errorf("order: opening %s: %w", path, err)
+	}
+	//SQLite only allows one writer at a time, so sharing one connection
+	//saves requests from "database is locked" errors
+	db.SetMaxOpenConns(1)
+
+	if _, err := db.Exec(schema); err != nil {
+		db.Close()
+		return nil, fmt.Errorf("order: creating the orders table in %s: %w", path, err)
+	}
+	return &SQLiteRepository{db: db, now: time.Now}, nil
+}
+
+type scanner interface {
+	Scan(dest ...interface{}) error
+}
+
+func scanRecord(row scanner) (Record, error) {
+	var rec Record
+	var created, updated int64
+	err := row.Scan(&rec.ID, &rec.Name, &rec.Beverage, &rec.Status, &rec.Version,
+		&created, &updated)
+	if errors.Is(err, sql.ErrNoRows) {
+		return Record{}, ErrNotFound
+	} else if err != nil {
+		return Record{}, err
+	}
+	rec.CreatedAt = time.Unix(0, created).UTC()
+	rec.UpdatedAt = time.Unix(0, updated).UTC()
+	return rec, nil
+}
+
+func (s *SQLiteRepository) Create(ctx context.Context, o Order) (Record, error) {
+	now := s.now().UnixNano()
+	row := s.db.QueryRowContext(ctx, `INSERT INTO orders
+		(name, beverage, status, version, created_at, updated_at)
+		VALUES (?, ?, ?, 1, ?, ?) RETURNING `+columns,
+		o.Name, o.Beverage, Received, now, now)
+	return scanRecord(row)
+}
+
+func (s *SQLiteRepository) Get(ctx context.Context, id int64) (Record, error) {
+	row := s.db.QueryRowContext(ctx, `SELECT `+columns+` FROM orders WHERE id = ?`, id)
+	return scanRecord(row)
+}
+
+func (s *SQLiteRepository) List(ctx context.Context, offset, limit int) ([]Record, int, error) {
+	var total int
+	if err := s.db.QueryRowContext(ctx, `SELECT COUNT(*) FROM orders`).Scan(&total); err != nil {
+		return nil, 0, err
+	}
+
+	rows, err := s.db.QueryContext(ctx, `SELECT `+columns+` FROM orders
+		ORDER BY id LIMIT ? OFFSET ?`, max(limit, 0), max(offset, 0))
+	if err != nil {
+		return nil, 0, err
+	}
+	defer rows.Close()
+
+	var records []Record
+	for rows.Next() {
+		rec, err := scanRecord(rows)
+		if err != nil {
+			return nil, 0, err
+		}
+		records = append(records, rec)
+	}
+	return records, total, rows.Err()
+}
+
+func (s *SQLiteRepository) Update(ctx context.Context, id, version int64, status Status) (Record, error) {
+	if !status.Valid() {
+		return Record{}, ErrInvalidStatus
+	}
+	row := s.db.QueryRowContext(ctx, `UPDATE orders
+		SET status = ?, version = version + 1, updated_at = ?
+		WHERE id = ? AND (? = 0 OR version = ?) RETURNING `+columns,
+		status, s.now().UnixNano(), id, version, version)
+	rec, err := scanRecord(row)
+	if err == ErrNotFound {
+		return Record{}, s.missing(ctx, id)
+	}
+	return rec, err
+}
+
+func (s *SQLiteRepository) Delete(ctx context.Context, id, version int64) error {
+	res, err := s.db.ExecContext(ctx, `DELETE FROM orders
+		WHERE id = ? AND (? = 0 OR version = ?)`, id, version, version)
+	if err != nil {
+		return err
+	}
+	if n, err := res.RowsAffected(); err != nil {
+		return err
+	} else if n == 0 {
+		return s.missing(ctx, id)
+	}
+	return nil
+}
+
+//missing explains why a change to the record with the ID id didn't match
+//any rows: ErrNotFound if there isn't one, or ErrVersionConflict if its
+//version didn't match
+func (s *SQLiteRepository) missing(ctx context.Context, id int64) error {
+	if _, err := s.Get(ctx, id); err != nil {
+		return err
+	}
+	return ErrVersionConflict
+}
+
+//Close closes the database
+func (s *SQLiteRepository) Close() error {
+	return s.db.Close()
+}
@@ -0,0 +1,154 @@
+//Package recovery has middleware that turns a panicking handler into a
+//500 response, rendered as HTML or JSON depending on what the client
+//accepts, and logs the panic with its stack trace and request ID.
+package recovery
+
+import (
+	"encoding/json"
+	"fmt"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"runtime/debug"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/content"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/logging"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+//An ErrorPage is what error page templates and JSON bodies are made from
+type ErrorPage struct {
+	Status     int    `json:"status"`
+	StatusText string `json:"error"`
+	RequestID  string `json:"request_id,omitempty"`
+}
+
+//DefaultHTML is the error page browsers get if a Recoverer doesn't have
+//its own HTML template.
+var DefaultHTML = template.Must(template.New("error").Parse(`<!DOCTYPE html>
+<html>
+<head><title>{{.Status}} {{.StatusText}}</title></head>
+<body>
+<h1>{{.Status}} {{.StatusText}}</h1>
+<p>Something went wrong on our end. Please try again later.</p>
+{{if .RequestID}}<p>Request ID: <code>{{.RequestID}}</code></p>{{end}}
+</body>
+</html>
+`))
+
+//A Recoverer recovers from panics in the handlers it wraps
+type Recoverer struct {
+	//Logger logs panics. If it's nil, slog.Default() is used.
+	Logger *slog.Logger
+	//HTML renders the error page for clients that want HTML. If it's nil,
+	//DefaultHTML is used.
+	HTML *template.Template
+	//JSON makes the value encoded as the body for clients that want JSON.
+	//If it's nil, the ErrorPage itself is encoded.
+	JSON func(ErrorPage) interface{}
+}
+
+//New makes a Recoverer with the default error pages logging to logger
+func New(logger *slog.Logger) *Recoverer {
+	return &Recoverer{Logger: logger}
+}
+
+//Middleware recovers from panics in next with the default Recoverer. It's
+//a plain func(http.Handler) http.Handler, so it can also be passed to
+//chain.New, alice.New or Goji's Use.
+func Middleware(next http.Handler) http.Handler {
+	return (&Recoverer{}).Middleware(next)
+}
+
+//Middleware recovers from panics in next
+func (rc *Recoverer) Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rc.ServeHTTP(w, r, next.ServeHTTP)
+	})
+}
+
+//ServeHTTP calls next, recovering from any panic. Its signature makes a
+//Recoverer a negroni.Handler, so it can be added to a stack with Use.
+func (rc *Recoverer) ServeHTTP(w http.ResponseWriter, r *http.Request, next http.HandlerFunc) {
+	rec := logging.NewStatusRecorder(w)
+	defer func() {
+		v := recover()
+		if v == nil {
+			return
+		}
+		//net/http uses ErrAbortHandler to quietly abort a response
+		if v == http.ErrAbortHandler {
+			panic(v)
+		}
+
+		id := requestid.Get(r)
+		if id == "" {
+			id = rec.Header().Get(requestid.Header)
+		}
+		rc.logger().LogAttrs(r.Context(), slog.LevelError, "panic serving request",
+			slog.String("request_id", id),
+			slog.String("method", r.Method),
+			slog.String("path", r.URL.RequestURI()),
+			slog.String("panic", fmt.Sprint(v)),
+			slog.String("stack", string(debug.Stack())),
+		)
+
+		//If the handler already started the response, it's too late for
+		//an error page; abort the connection so the client can tell the
+		//response is incomplete.
+		if rec.Status != 0 {
+			panic(http.ErrAbortHandler)
+		}
+		rc.writeError(w, r, ErrorPage{
+			Status:     http.StatusInternalServerError,
+			StatusText: http.StatusText(http.StatusInternalServerError),
+			RequestID:  id,
+		})
+	}()
+	next(rec, r)
+}
+
+func (rc *Recoverer) writeError(w http.ResponseWriter, r *http.Request, page ErrorPage) {
+	h := w.Header()
+	//Headers the handler set for the response it didn't get to send don't
+	//belong on the error page
+	for _, key := range []string{"Content-Length", "Content-Encoding", "ETag", "Last-Modified"} {
+		h.Del(key)
+	}
+	h.Set("Cache-Control", "no-store")
+	h.Set("X-Content-Type-Options", "nosniff")
+
+	if prefersJSON(r.Header.Get("Accept")) {
+		var body interface{} = page
+		if rc.JSON != nil {
+			body = rc.JSON(page)
+		}
+		h.Set("Content-Type", "application/json")
+		w.WriteHeader(page.Status)
+		json.NewEncoder(w).Encode(body)
+		return
+	}
+
+	tmpl := rc.HTML
+	if tmpl == nil {
+		tmpl = DefaultHTML
+	}
+	h.Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(page.Status)
+	if err := tmpl.Execute(w, page); err != nil {
+		rc.logger().Error("rendering error page", "error", err)
+	}
+}
+
+func (rc *Recoverer) logger() *slog.Logger {
+	if rc.Logger != nil {
+		return rc.Logger
+	}
+	return slog.Default()
+}
+
+//prefersJSON reports whether an Accept header ranks JSON above HTML.
+//Without an Accept header, or with a tie, HTML wins.
+func prefersJSON(accept string) bool {
+	return content.Negotiate(accept, content.HTMLType, content.JSONType) == content.JSONType
+}
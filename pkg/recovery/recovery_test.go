@@ -0,0 +1,186 @@
+package recovery
+
+import (
+	"bytes"
+	"encoding/json"
+	"html/template"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+var panicky = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Length", "11")
+	panic("out of coffee")
+})
+
+//serve serves a GET request with the given Accept header through rc
+//wrapped around h and the request ID middleware.
+func serve(rc *Recoverer, h http.Handler, accept string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", "/coffee-shop", nil)
+	r.Header.Set(requestid.Header, "sloth-7")
+	if accept != "" {
+		r.Header.Set("Accept", accept)
+	}
+	w := httptest.NewRecorder()
+	requestid.Middleware(rc.Middleware(h)).ServeHTTP(w, r)
+	return w
+}
+
+func TestRecoverHTML(t *testing.T) {
+	var logs bytes.Buffer
+	rc := New(slog.New(slog.NewJSONHandler(&logs, nil)))
+
+	w := serve(rc, panicky, "text/html,application/xhtml+xml,*/*;q=0.8")
+	if w.Code != 500 {
+		t.Fatalf("Status expected 500, got %d", w.Code)
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("Content-Type expected text/html; charset=utf-8, got %q", ct)
+	}
+	if cl := w.Header().Get("Content-Length"); cl != "" {
+		t.Fatalf("Content-Length from the handler expected to be removed, got %q", cl)
+	}
+	if !strings.Contains(w.Body.String(), "<code>sloth-7</code>") {
+		t.Fatalf("Error page expected to show the request ID, got %q", w.Body.String())
+	}
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(logs.Bytes(), &entry); err != nil {
+		t.Fatal(err)
+	}
+	if entry["request_id"] != "sloth-7" || entry["panic"] != "out of coffee" {
+		t.Fatalf("Log entry expected the request ID and panic value, got %v", entry)
+	}
+	if stack, _ := entry["stack"].(string); !strings.Contains(stack, "recovery_test.go") {
+		t.Fatalf("Logged stack expected to include the panicking handler, got %q", stack)
+	}
+}
+
+func TestRecoverJSON(t *testing.T) {
+	rc := New(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+
+	w := serve(rc, panicky, "application/json")
+	if ct := w.Header().Get("Content-Type"); ct != "application/json" {
+		t.Fatalf("Content-Type expected application/json, got %q", ct)
+	}
+	var page ErrorPage
+	if err := json.Unmarshal(w.Body.Bytes(), &page); err != nil {
+		t.Fatal(err)
+	}
+	expected := ErrorPage{500, "Internal Server Error", "sloth-7"}
+	if page != expected {
+		t.Fatalf("JSON body expected %+v, got %+v", expected, page)
+	}
+}
+
+func TestPrefersJSON(t *testing.T) {
+	tests := []struct {
+		accept string
+		json   bool
+	}{
+		{"", false},
+		{"*/*", false},
+		{"application/json", true},
+		{"text/html, application/json", false},
+		{"text/html;q=0.5, application/json", true},
+		{"application/json;q=0.1, text/html;q=0.1", false},
+		{"application/json;q=oops", false},
+	}
+	for _, test := range tests {
+		if got := prefersJSON(test.accept); got != test.json {
+			t.Errorf("prefersJSON(%q) expected %v, got %v", test.accept, test.json, got)
+		}
+	}
+}
+
+func TestCustomErrorPages(t *testing.T) {
+	rc := &Recoverer{
+		Logger: slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)),
+		HTML:   template.Must(template.New("oops").Parse("Oops! {{.RequestID}}")),
+		JSON: func(p ErrorPage) interface{} {
+			return map[string]string{"message": "Oops!", "id": p.RequestID}
+		},
+	}
+
+	if w := serve(rc, panicky, ""); w.Body.String() != "Oops! sloth-7" {
+		t.Fatalf("Custom HTML page expected \"Oops! sloth-7\", got %q", w.Body.String())
+	}
+	w := serve(rc, panicky, "application/json")
+	if body := strings.TrimSpace(w.Body.String()); body != `{"id":"sloth-7","message":"Oops!"}` {
+		t.Fatalf("Custom JSON body expected {\"id\":\"sloth-7\",\"message\":\"Oops!\"}, got %s", body)
+	}
+}
+
+func TestNegroniStyle(t *testing.T) {
+	rc := New(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+
+	w := httptest.NewRecorder()
+	rc.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), panicky)
+	if w.Code != 500 {
+		t.Fatalf("Status expected 500, got %d", w.Code)
+	}
+
+	w = httptest.NewRecorder()
+	rc.ServeHTTP(w, httptest.NewRequest("GET", "/", nil), func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("no panic here"))
+	})
+	if w.Code != 200 || w.Body.String() != "no panic here" {
+		t.Fatalf("Response without a panic expected 200 \"no panic here\", got %d %q",
+			w.Code, w.Body.String())
+	}
+}
+
+func TestAbortAfterResponseStarted(t *testing.T) {
+	rc := New(slog.New(slog.NewTextHandler(&bytes.Buffer{}, nil)))
+	partial := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("One latte coming"))
+		panic("spilled it")
+	})
+
+	for _, h := range []http.Handler{partial, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	})} {
+		func() {
+			defer func() {
+				if v := recover(); v != http.ErrAbortHandler {
+					t.Errorf("Panic expected http.ErrAbortHandler, got %v", v)
+				}
+			}()
+			serve(rc, h, "")
+		}()
+	}
+}
+
+func TestAbortThroughServer(t *testing.T) {
+	s := httptest.NewServer(Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/partial" {
+			w.Write([]byte("One latte coming"))
+			w.(http.Flusher).Flush()
+		}
+		panic("spilled it")
+	})))
+	defer s.Close()
+
+	res, err := http.Get(s.URL + "/")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != 500 {
+		t.Fatalf("Status expected 500, got %d", res.StatusCode)
+	}
+
+	res, err = http.Get(s.URL + "/partial")
+	if err == nil {
+		_, err = bytes.NewBuffer(nil).ReadFrom(res.Body)
+		res.Body.Close()
+	}
+	if err == nil {
+		t.Fatal("Reading a response aborted by a panic expected an error, got nil")
+	}
+}
@@ -0,0 +1,240 @@
+//Package render renders HTML pages from html/template files laid out like
+//this:
+//
+//	layouts/base.html    the layout pages are rendered in
+//	partials/*.html      templates any page can use
+//	pages/NAME.html      one file per page
+//
+//A page file defines the templates its layout calls, usually with
+//{{define "title"}} and {{define "content"}}. Parsed pages are cached; in
+//dev mode they're parsed again on every render instead, so edits to the
+//template files show up without restarting the server.
+package render
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"html/template"
+	"io"
+	"io/fs"
+	"log"
+	"net/http"
+	"os"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/content"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/csrf"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+//DevEnv is the environment variable that turns on dev mode for Dev
+const DevEnv = "MEAN_GOPHER_DEV"
+
+//DefaultLayout is the layout file pages are rendered in by default
+const DefaultLayout = "base.html"
+
+//Dev reports whether the MEAN_GOPHER_DEV environment variable turns on
+//dev mode
+func Dev() bool {
+	dev, _ := strconv.ParseBool(os.Getenv(DevEnv))
+	return dev
+}
+
+//Options configure a Renderer
+type Options struct {
+	//Layout is the file in layouts/ pages are rendered in. If it's "",
+	//DefaultLayout is used.
+	Layout string
+	//Funcs are added to the template functions every template can use
+	Funcs template.FuncMap
+	//Dev turns on parsing pages on every render
+	Dev bool
+}
+
+//A Renderer renders the pages in a file system of templates. Its methods
+//are safe to call from multiple goroutines.
+type Renderer struct {
+	fsys fs.FS
+	opts Options
+
+	mu    sync.RWMutex
+	pages map[string]*template.Template
+}
+
+//New makes a Renderer for the templates in fsys. Unless opts.Dev is set,
+//every page is parsed right away, so mistakes in the templates show up as
+//an error from New instead of when a page is rendered.
+func New(fsys fs.FS, opts Options) (*Renderer, error) {
+	if opts.Layout == "" {
+		opts.Layout = DefaultLayout
+	}
+	rd := &Renderer{fsys: fsys, opts: opts, pages: make(map[string]*template.Template)}
+	if opts.Dev {
+		return rd, nil
+	}
+
+	names, err := rd.Pages()
+	if err != nil {
+		return nil, err
+	}
+	for _, name := range names {
+		t, err := rd.parse(name)
+		if err != nil {
+			return nil, err
+		}
+		rd.pages[name] = t
+	}
+	return rd, nil
+}
+
+//Must returns rd, panicking if err isn't nil. It's for initializing
+//package level Renderers.
+func Must(rd *Renderer, err error) *Renderer {
+	if err != nil {
+		panic(err)
+	}
+	return rd
+}
+
+//Pages returns the names of the pages the Renderer can render, sorted
+func (rd *Renderer) Pages() ([]string, error) {
+	files, err := fs.Glob(rd.fsys, "pages/*.html")
+	if err != nil {
+		return nil, err
+	}
+	names := make([]string, len(files))
+	for i, file := range files {
+		names[i] = strings.TrimSuffix(path.Base(file), ".html")
+	}
+	sort.Strings(names)
+	return names, nil
+}
+
+//baseFuncs are the functions every template can use. The request-specific
+//ones are placeholders here, replaced with ones for the request being
+//rendered by requestFuncs.
+func baseFuncs() template.FuncMap {
+	return template.FuncMap{
+		"csrfField": func() template.HTML { return "" },
+		"csrfToken": func() string { return "" },
+		"requestID": func() string { return "" },
+		"dict":      dict,
+	}
+}
+
+func requestFuncs(r *http.Request) template.FuncMap {
+	funcs := csrf.FuncMap(r)
+	funcs["requestID"] = func() string { return requestid.Get(r) }
+	return funcs
+}
+
+//dict makes a map out of key and value pairs, for passing more than one
+//value to a partial: {{template "field" dict "Name" "beverage" "Error" .Err}}
+func dict(pairs ...interface{}) (map[string]interface{}, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("dict needs key and value pairs")
+	}
+	m := make(map[string]interface{}, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		key, ok := pairs[i].(string)
+		if !ok {
+			return nil, fmt.Errorf("dict key %v isn't a string", pairs[i])
+		}
+		m[key] = pairs[i+1]
+	}
+	return m, nil
+}
+
+//parse parses the page name along with the layout and partials
+func (rd *Renderer) parse(name string) (*template.Template, error) {
+	t := template.New(rd.opts.Layout).Funcs(baseFuncs()).Funcs(rd.opts.Funcs)
+
+	patterns := []string{"layouts/" + rd.opts.Layout, "partials/*.html", "pages/" + name + ".html"}
+	for _, pattern := range patterns {
+		files, err := fs.Glob(rd.fsys, pattern)
+		if err != nil {
+			return nil, err
+		}
+		if len(files) == 0 {
+			if strings.HasPrefix(pattern, "partials/") {
+				continue
+			}
+			return nil, fmt.Errorf("render: %s not found for page %q", pattern, name)
+		}
+		if t, err = t.ParseFS(rd.fsys, files...); err != nil {
+			return nil, fmt.Errorf("render: parsing page %q: %w", name, err)
+		}
+	}
+	return t, nil
+}
+
+//page returns the parsed page name, parsing it if it isn't cached or the
+//Renderer is in dev mode
+func (rd *Renderer) page(name string) (*template.Template, error) {
+	if !rd.opts.Dev {
+		rd.mu.RLock()
+		t, ok := rd.pages[name]
+		rd.mu.RUnlock()
+		if ok {
+			return t, nil
+		}
+	}
+
+	t, err := rd.parse(name)
+	if err != nil {
+		return nil, err
+	}
+	if !rd.opts.Dev {
+		rd.mu.Lock()
+		rd.pages[name] = t
+		rd.mu.Unlock()
+	}
+	return t, nil
+}
+
+//Execute renders the page name for r with data to w. The cached page is
+//never executed itself; each render executes a clone with the
+//request-specific template functions, csrfField, csrfToken and requestID.
+func (rd *Renderer) Execute(w io.Writer, r *http.Request, name string, data interface{}) error {
+	t, err := rd.page(name)
+	if err != nil {
+		return err
+	}
+	if t, err = t.Clone(); err != nil {
+		return err
+	}
+	return t.Funcs(requestFuncs(r)).Execute(w, data)
+}
+
+//HTML responds to r with status and the page name rendered with data. The
+//page is rendered to a buffer first, so a template error gets a 500
+//instead of half a page.
+func (rd *Renderer) HTML(w http.ResponseWriter, r *http.Request, status int, name string, data interface{}) {
+	var buf bytes.Buffer
+	if err := rd.Execute(&buf, r, name, data); err != nil {
+		log.Printf("render: %v", err)
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	w.WriteHeader(status)
+	buf.WriteTo(w)
+}
+
+//Offer offers the page name rendered with data as the HTML version of a
+//content.Respond response
+func (rd *Renderer) Offer(r *http.Request, name string, data interface{}) content.Offer {
+	return content.Offer{Type: content.HTMLType, Write: func(w io.Writer) error {
+		var buf bytes.Buffer
+		if err := rd.Execute(&buf, r, name, data); err != nil {
+			return err
+		}
+		_, err := buf.WriteTo(w)
+		return err
+	}}
+}
@@ -0,0 +1,150 @@
+package render
+
+import (
+	"html/template"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/csrf"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/requestid"
+)
+
+func templates() fstest.MapFS {
+	return fstest.MapFS{
+		"layouts/base.html": {Data: []byte(
+			`<title>{{block "title" .}}Coffee Shop{{end}}</title>` +
+				`{{with requestID}}<meta name="request-id" content="{{.}}">{{end}}` +
+				`<body>{{block "content" .}}{{end}}</body>`)},
+		"partials/greeting.html": {Data: []byte(
+			`{{define "greeting"}}<p>One {{.Beverage}} coming right up, {{.Name}}!</p>{{end}}`)},
+		"pages/confirmation.html": {Data: []byte(
+			`{{define "title"}}Order placed{{end}}` +
+				`{{define "content"}}{{template "greeting" dict "Name" .Name "Beverage" .Beverage}}{{end}}`)},
+		"pages/form.html": {Data: []byte(
+			`{{define "content"}}<form>{{csrfField}}</form>{{end}}`)},
+		"pages/broken.html": {Data: []byte(
+			`{{define "content"}}{{.Missing}}{{end}}`)},
+	}
+}
+
+type order struct{ Name, Beverage string }
+
+func TestLayoutAndPartials(t *testing.T) {
+	rd := Must(New(templates(), Options{}))
+	w := httptest.NewRecorder()
+	rd.HTML(w, httptest.NewRequest("POST", "/send-order", nil), 200, "confirmation",
+		order{"<Andy>", "tea"})
+
+	expected := "<title>Order placed</title><body><p>One tea coming right up, &lt;Andy&gt;!</p></body>"
+	if w.Code != 200 || w.Body.String() != expected {
+		t.Fatalf("Confirmation page expected 200 %q, got %d %q", expected, w.Code, w.Body.String())
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+		t.Fatalf("Content-Type expected \"text/html; charset=utf-8\", got %q", ct)
+	}
+}
+
+func TestPages(t *testing.T) {
+	names, err := Must(New(templates(), Options{})).Pages()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if got := strings.Join(names, ","); got != "broken,confirmation,form" {
+		t.Fatalf("Pages expected broken,confirmation,form, got %s", got)
+	}
+}
+
+func TestRequestFuncs(t *testing.T) {
+	rd := Must(New(templates(), Options{}))
+	h := csrf.New([]byte("sloth key")).Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rd.HTML(w, r, 200, "form", nil)
+	}))
+	r := httptest.NewRequest("GET", "/order-form", nil)
+	r = r.WithContext(requestid.NewContext(r.Context(), "sloth-1"))
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	body := w.Body.String()
+	if !strings.Contains(body, `<meta name="request-id" content="sloth-1">`) {
+		t.Errorf("Form page expected the request ID, got %q", body)
+	}
+	if !strings.Contains(body, `<input type="hidden" name="csrf_token" value="`) {
+		t.Errorf("Form page expected a CSRF token field, got %q", body)
+	}
+
+	//Without the middleware, the request functions render nothing
+	w = httptest.NewRecorder()
+	rd.HTML(w, httptest.NewRequest("GET", "/order-form", nil), 200, "form", nil)
+	if expected := "<title>Coffee Shop</title><body><form></form></body>"; w.Body.String() != expected {
+		t.Fatalf("Form page without a Protector or request ID expected %q, got %q", expected, w.Body.String())
+	}
+}
+
+func TestTemplateErrors(t *testing.T) {
+	rd := Must(New(templates(), Options{}))
+	w := httptest.NewRecorder()
+	rd.HTML(w, httptest.NewRequest("GET", "/", nil), 200, "broken", order{})
+	if w.Code != 500 || strings.Contains(w.Body.String(), "<title>") {
+		t.Fatalf("Page with a template error expected a 500 without half a page, got %d %q",
+			w.Code, w.Body.String())
+	}
+
+	w = httptest.NewRecorder()
+	rd.HTML(w, httptest.NewRequest("GET", "/", nil), 200, "menu", nil)
+	if w.Code != 500 {
+		t.Fatalf("Page that doesn't exist expected 500, got %d", w.Code)
+	}
+
+	fsys := templates()
+	fsys["pages/typo.html"] = &fstest.MapFile{Data: []byte(`{{define "content"}}{{.Name}{{end}}`)}
+	if _, err := New(fsys, Options{}); err == nil {
+		t.Fatal("New with a page that doesn't parse expected an error")
+	}
+	if _, err := New(fsys, Options{Dev: true}); err != nil {
+		t.Fatalf("New in dev mode expected not to parse pages yet, got %v", err)
+	}
+}
+
+func TestCachingAndDevReload(t *testing.T) {
+	render := func(rd *Renderer) string {
+		var b strings.Builder
+		if err := rd.Execute(&b, httptest.NewRequest("GET", "/", nil), "confirmation", order{"Andy", "tea"}); err != nil {
+			t.Fatal(err)
+		}
+		return b.String()
+	}
+
+	for _, dev := range []bool{false, true} {
+		fsys := templates()
+		rd := Must(New(fsys, Options{Dev: dev}))
+		render(rd)
+		fsys["pages/confirmation.html"] = &fstest.MapFile{Data: []byte(
+			`{{define "content"}}Brewing {{.Beverage}}{{end}}`)}
+
+		reloaded := strings.Contains(render(rd), "Brewing tea")
+		if reloaded != dev {
+			t.Errorf("Renderer with Dev %v expected reloading edited pages to be %v, got %v",
+				dev, dev, reloaded)
+		}
+	}
+}
+
+func TestLayoutOption(t *testing.T) {
+	fsys := templates()
+	fsys["layouts/plain.html"] = &fstest.MapFile{Data: []byte(`{{template "content" .}}`)}
+	rd := Must(New(fsys, Options{Layout: "plain.html", Funcs: template.FuncMap{
+		"shout": strings.ToUpper,
+	}}))
+	fsys["pages/shout.html"] = &fstest.MapFile{Data: []byte(`{{define "content"}}{{shout .}}{{end}}`)}
+
+	var b strings.Builder
+	if err := rd.Execute(&b, httptest.NewRequest("GET", "/", nil), "shout", "one latte"); err != nil {
+		t.Fatal(err)
+	}
+	if b.String() != "ONE LATTE" {
+		t.Fatalf("Page in the plain layout expected \"ONE LATTE\", got %q", b.String())
+	}
+}
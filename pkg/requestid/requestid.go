@@ -0,0 +1,76 @@
+//Package requestid gives every request an ID so log lines from the same
+//request can be matched up, reusing the client's X-Request-ID if it sent a
+//valid one.
+package requestid
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/hex"
+	"net/http"
+)
+
+//Header is the header request IDs are read from and echoed back in
+const Header = "X-Request-ID"
+
+//MaxLength is the longest incoming request ID that's accepted
+const MaxLength = 128
+
+type contextKey struct{}
+
+//NewContext returns a copy of ctx carrying the request ID id
+func NewContext(ctx context.Context, id string) context.Context {
+	return context.WithValue(ctx, contextKey{}, id)
+}
+
+//FromContext returns the request ID in ctx, or "" if there isn't one
+func FromContext(ctx context.Context) string {
+	id, _ := ctx.Value(contextKey{}).(string)
+	return id
+}
+
+//Get returns r's request ID from its context, or "" if it doesn't have one
+func Get(r *http.Request) string {
+	return FromContext(r.Context())
+}
+
+//Valid reports whether id is acceptable as a request ID: between 1 and
+//MaxLength characters, all letters, digits or one of -_.:+/=, so it can't
+//be used to smuggle anything odd into logs.
+func Valid(id string) bool {
+	if len(id) == 0 || len(id) > MaxLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		switch {
+		case 'a' <= c && c <= 'z', 'A' <= c && c <= 'Z', '0' <= c && c <= '9':
+		case c == '-', c == '_', c == '.', c == ':', c == '+', c == '/', c == '=':
+		default:
+			return false
+		}
+	}
+	return true
+}
+
+//Generate makes a new random request ID
+func Generate() string {
+	var b [16]byte
+	rand.Read(b[:])
+	return hex.EncodeToString(b[:])
+}
+
+//Middleware gives each request an ID, using the X-Request-ID header if
+//it's valid and generating one otherwise. The ID is stored in the request's
+//context and echoed in the response's X-Request-ID header.
+func Middleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(Header)
+		if !Valid(id) {
+			id = Generate()
+		}
+
+		w.Header().Set(Header, id)
+		next.ServeHTTP(w, r.WithContext(NewContext(r.Context(), id)))
+	})
+}
@@ -0,0 +1,65 @@
+package requestid
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+//serveWithID serves a request with the given X-Request-ID through the
+//middleware and returns the ID the handler saw and the response.
+func serveWithID(incoming string) (string, *httptest.ResponseRecorder) {
+	var seen string
+	handler := Middleware(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		seen = Get(r)
+	}))
+
+	r := httptest.NewRequest("GET", "/", nil)
+	if incoming != "" {
+		r.Header.Set(Header, incoming)
+	}
+	w := httptest.NewRecorder()
+	handler.ServeHTTP(w, r)
+	return seen, w
+}
+
+func TestMiddlewareKeepsValidID(t *testing.T) {
+	seen, w := serveWithID("abc-123_XYZ.4:5")
+	if seen != "abc-123_XYZ.4:5" {
+		t.Fatalf("Request ID in context expected abc-123_XYZ.4:5, got %q", seen)
+	}
+	if echoed := w.Header().Get(Header); echoed != seen {
+		t.Fatalf("Echoed request ID expected %q, got %q", seen, echoed)
+	}
+}
+
+func TestMiddlewareGeneratesID(t *testing.T) {
+	for _, incoming := range []string{"", "has spaces", "new\nline",
+		"<script>", strings.Repeat("a", MaxLength+1)} {
+		seen, w := serveWithID(incoming)
+		if !Valid(seen) || seen == incoming {
+			t.Errorf("Request ID for %q expected a generated ID, got %q", incoming, seen)
+		}
+		if echoed := w.Header().Get(Header); echoed != seen {
+			t.Errorf("Echoed request ID expected %q, got %q", seen, echoed)
+		}
+	}
+}
+
+func TestGenerateIsUnique(t *testing.T) {
+	ids := make(map[string]bool)
+	for i := 0; i < 1000; i++ {
+		id := Generate()
+		if ids[id] {
+			t.Fatalf("Generate() repeated the ID %s", id)
+		}
+		ids[id] = true
+	}
+}
+
+func TestFromContextWithoutID(t *testing.T) {
+	if id := Get(httptest.NewRequest("GET", "/", nil)); id != "" {
+		t.Fatalf("Request ID without the middleware expected \"\", got %q", id)
+	}
+}
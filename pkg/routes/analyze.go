@@ -0,0 +1,685 @@
+package routes
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"regexp"
+	"regexp/syntax"
+	"strings"
+)
+
+//Severity is how bad a Problem is
+type Severity int
+
+//Severities of Problems
+const (
+	//A Warning is a route that doesn't get some of the requests it matches,
+	//which may be what was meant
+	Warning Severity = iota
+	//A Fatal problem is a route that never gets a request, or that a
+	//ServeMux panics on
+	Fatal
+)
+
+func (s Severity) String() string {
+	if s == Fatal {
+		return "fatal"
+	}
+	return "warning"
+}
+
+//Kind is the kind of a Problem
+type Kind string
+
+//Kinds of Problems
+const (
+	//Duplicate is a route registered again with the same pattern and some
+	//of the same methods
+	Duplicate Kind = "duplicate"
+	//Unreachable is a route whose requests all go to another route
+	Unreachable Kind = "unreachable"
+	//Shadowed is a route some of whose requests go to another route
+	Shadowed Kind = "shadowed"
+	//Conflict is two ServeMux patterns that match some of the same
+	//requests without either being more specific, which ServeMux panics on
+	Conflict Kind = "conflict"
+)
+
+//A Problem is a route that doesn't get requests it matches because of
+//another route
+type Problem struct {
+	Severity Severity
+	Kind     Kind
+	//Route is the route with the problem
+	Route Route
+	//By is the route that gets Route's requests
+	By Route
+	//Path is an example of a path both routes match
+	Path string
+}
+
+func (p Problem) String() string {
+	route := fmt.Sprintf("%s route %s %s", p.Route.Router, p.Route.MethodString(), patternString(p.Route))
+	by := fmt.Sprintf("%s %s", p.By.MethodString(), patternString(p.By))
+	switch p.Kind {
+	case Duplicate:
+		return fmt.Sprintf("%s: %s is registered again after %s", p.Severity, route, by)
+	case Unreachable:
+		return fmt.Sprintf("%s: %s can't be reached; all its requests, like %s, go to %s, registered before it",
+			p.Severity, route, p.Path, by)
+	case Conflict:
+		return fmt.Sprintf("%s: %s conflicts with %s; both match requests like %s and neither is more specific",
+			p.Severity, route, by, p.Path)
+	}
+	if p.Route.Router == ServeMuxRouter {
+		return fmt.Sprintf("%s: %s doesn't get requests like %s, which go to the more specific %s",
+			p.Severity, route, p.Path, by)
+	}
+	return fmt.Sprintf("%s: %s doesn't get requests like %s, which go to %s, registered before it",
+		p.Severity, route, p.Path, by)
+}
+
+//Analyze looks for routes that don't get requests they match because of
+//other routes on the same router: routes registered twice, routes that
+//can't be reached, and routes that are shadowed by others for some paths.
+//Goji and Gorilla send a request to the first route it matches, so a route
+//is checked against the ones registered before it; a ServeMux sends it to
+//the most specific one, so the order doesn't matter. Overlapping with a
+//ServeMux's catch-all "/" route or coming before a Goji or Gorilla
+//catch-all route isn't a problem, since that's what catch-all routes are
+//for.
+//
+//Routes are compared by their patterns, treating route parameters as
+//matching any path segment their regular expression matches. Whole-path
+//regular expressions are compared by checking example paths, so some
+//overlaps with them can be missed.
+func Analyze(routes []Route) []Problem {
+	var problems []Problem
+	byRouter := make(map[string][]Route)
+	var routers []string
+	for _, route := range routes {
+		if _, ok := byRouter[route.Router]; !ok {
+			routers = append(routers, route.Router)
+		}
+		byRouter[route.Router] = append(byRouter[route.Router], route)
+	}
+	for _, router := range routers {
+		if router == ServeMuxRouter {
+			problems = append(problems, analyzeServeMux(byRouter[router])...)
+		} else {
+			problems = append(problems, analyzeOrdered(byRouter[router])...)
+		}
+	}
+	return problems
+}
+
+//Check analyzes the registry's routes, logging each problem to logger, or
+//the standard logger if it's nil, and returns an error if any of them are
+//Fatal
+func (reg *Registry) Check(logger *log.Logger) error {
+	if logger == nil {
+		logger = log.Default()
+	}
+	fatal := 0
+	for _, p := range Analyze(reg.Routes()) {
+		logger.Print(p)
+		if p.Severity == Fatal {
+			fatal++
+		}
+	}
+	if fatal > 0 {
+		return fmt.Errorf("routes: %d fatal route problems", fatal)
+	}
+	return nil
+}
+
+//analyzeOrdered checks routes on a router where the first route a request
+//matches gets it
+func analyzeOrdered(routes []Route) []Problem {
+	var problems []Problem
+	shapes := make([]*shape, len(routes))
+	for i, route := range routes {
+		shapes[i] = parseShape(route)
+	}
+	for j, later := range routes {
+		for i := 0; i < j; i++ {
+			earlier := routes[i]
+			if shapes[i] == nil || shapes[j] == nil || !methodsOverlap(earlier, later) {
+				continue
+			}
+			path, ok := overlap(shapes[i], shapes[j])
+			if !ok {
+				continue
+			}
+			kind := Shadowed
+			if earlier.Pattern == later.Pattern && earlier.Regexp == later.Regexp &&
+				earlier.Prefix == later.Prefix {
+				kind = Duplicate
+			}
+			if methodsCover(earlier, later) && covers(shapes[i], shapes[j]) {
+				if kind != Duplicate {
+					kind = Unreachable
+				}
+				problems = append(problems, Problem{Fatal, kind, later, earlier, shapes[j].example()})
+				break
+			}
+			//A more general route after a more specific one, like a
+			//catch-all route, or a route for all methods after one for GET,
+			//is how routes are meant to be ordered
+			if methodsCover(later, earlier) && covers(shapes[j], shapes[i]) {
+				continue
+			}
+			problems = append(problems, Problem{Warning, kind, later, earlier, path})
+		}
+	}
+	return problems
+}
+
+//analyzeServeMux checks routes on a ServeMux, where the most specific
+//route a request matches gets it
+func analyzeServeMux(routes []Route) []Problem {
+	var problems []Problem
+	shapes := make([]*shape, len(routes))
+	for i, route := range routes {
+		shapes[i] = parseShape(route)
+	}
+	for j, b := range routes {
+		for i := 0; i < j; i++ {
+			a := routes[i]
+			if shapes[i] == nil || shapes[j] == nil || !methodsOverlap(a, b) {
+				continue
+			}
+			if shapes[i].host != "" && shapes[j].host != "" && shapes[i].host != shapes[j].host {
+				continue
+			}
+			if a.Pattern == b.Pattern && a.MethodString() == b.MethodString() {
+				problems = append(problems, Problem{Fatal, Duplicate, b, a, shapes[j].example()})
+				continue
+			}
+			if shapes[i].catchAll() || shapes[j].catchAll() {
+				continue
+			}
+			path, ok := overlap(shapes[i], shapes[j])
+			if !ok {
+				continue
+			}
+			aCoversB := methodsCover(a, b) && covers(shapes[i], shapes[j])
+			bCoversA := methodsCover(b, a) && covers(shapes[j], shapes[i])
+			switch {
+			case aCoversB && bCoversA:
+				problems = append(problems, Problem{Fatal, Conflict, b, a, path})
+			case aCoversB:
+				problems = append(problems, Problem{Warning, Shadowed, a, b, path})
+			case bCoversA:
+				problems = append(problems, Problem{Warning, Shadowed, b, a, path})
+			//Patterns that would conflict don't if only one has a host;
+			//that one gets the requests they both match
+			case shapes[i].host == "" && shapes[j].host != "":
+				problems = append(problems, Problem{Warning, Shadowed, a, b, path})
+			case shapes[i].host != "" && shapes[j].host == "":
+				problems = append(problems, Problem{Warning, Shadowed, b, a, path})
+			default:
+				problems = append(problems, Problem{Fatal, Conflict, b, a, path})
+			}
+		}
+	}
+	return problems
+}
+
+//methods is the set of methods a route handles, or nil for all of them. A
+//ServeMux GET route handles HEAD requests too, like a Goji one, which
+//records both.
+func methods(route Route) map[string]bool {
+	if len(route.Methods) == 0 {
+		return nil
+	}
+	set := make(map[string]bool)
+	for _, m := range route.Methods {
+		set[m] = true
+	}
+	if route.Router == ServeMuxRouter && set["GET"] {
+		set["HEAD"] = true
+	}
+	return set
+}
+
+func methodsOverlap(a, b Route) bool {
+	am, bm := methods(a), methods(b)
+	if am == nil || bm == nil {
+		return true
+	}
+	for m := range bm {
+		if am[m] {
+			return true
+		}
+	}
+	return false
+}
+
+//methodsCover is whether a handles every method b does
+func methodsCover(a, b Route) bool {
+	am, bm := methods(a), methods(b)
+	if am == nil {
+		return true
+	}
+	if bm == nil {
+		return false
+	}
+	for m := range bm {
+		if !am[m] {
+			return false
+		}
+	}
+	return true
+}
+
+//A shape is the set of paths a route's pattern matches: the path's
+//segments between slashes, or a regular expression for the whole path
+type shape struct {
+	host string
+	segs []segment
+	//prefix is whether the last segment only has to start with the
+	//pattern's, followed by anything
+	prefix bool
+	re     *regexp.Regexp
+}
+
+//A segment is a literal path segment or a route parameter
+type segment struct {
+	literal string
+	param   bool
+	//re is the regular expression a parameter has to match, if any
+	re *regexp.Regexp
+}
+
+//parseShape parses a route's pattern according to its router, or returns
+//nil for a pattern it doesn't understand, like a Goji web.Pattern
+func parseShape(route Route) *shape {
+	if route.Regexp {
+		re, err := regexp.Compile(route.Pattern)
+		if err != nil {
+			return nil
+		}
+		return &shape{re: re}
+	}
+
+	s := &shape{prefix: route.Prefix}
+	path := route.Pattern
+	switch route.Router {
+	case ServeMuxRouter:
+		if i := strings.Index(path, "/"); i > 0 {
+			s.host, path = path[:i], path[i:]
+		}
+		if strings.HasSuffix(path, "/{$}") {
+			path = strings.TrimSuffix(path, "{$}")
+		} else if i := strings.LastIndex(path, "/{"); i >= 0 && strings.HasSuffix(path, "...}") {
+			path = path[:i+1]
+		}
+	case GojiRouter:
+		path = strings.TrimSuffix(path, "*")
+	case GorillaRouter:
+		if path == "" {
+			path, s.prefix = "/", true
+		}
+	default:
+		return nil
+	}
+	if !strings.HasPrefix(path, "/") {
+		return nil
+	}
+
+	for _, seg := range splitPath(path) {
+		parsed, err := parseSegment(route.Router, seg)
+		if err != nil {
+			return nil
+		}
+		s.segs = append(s.segs, parsed)
+	}
+	return s
+}
+
+//splitPath splits a path into its segments, leaving alone the slashes in
+//a Gorilla parameter's regular expression
+func splitPath(path string) []string {
+	var segs []string
+	depth, start := 0, 1
+	for i := 1; i < len(path); i++ {
+		switch path[i] {
+		case '{':
+			depth++
+		case '}':
+			depth--
+		case '/':
+			if depth == 0 {
+				segs = append(segs, path[start:i])
+				start = i + 1
+			}
+		}
+	}
+	return append(segs, path[start:])
+}
+
+func parseSegment(router, seg string) (segment, error) {
+	switch router {
+	case GojiRouter:
+		if strings.HasPrefix(seg, ":") {
+			return segment{param: true}, nil
+		}
+	case ServeMuxRouter:
+		if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+			return segment{param: true}, nil
+		}
+	case GorillaRouter:
+		if !strings.Contains(seg, "{") {
+			break
+		}
+		//A segment that's more than one parameter, like {name}.{ext},
+		//is treated like a parameter matching anything
+		if !strings.HasPrefix(seg, "{") || !strings.HasSuffix(seg, "}") || strings.Count(seg, "{") > 1 {
+			return segment{param: true}, nil
+		}
+		_, expr, ok := strings.Cut(seg[1:len(seg)-1], ":")
+		if !ok {
+			return segment{param: true}, nil
+		}
+		re, err := regexp.Compile("^(?:" + expr + ")$")
+		if err != nil {
+			return segment{}, err
+		}
+		return segment{param: true, re: re}, nil
+	}
+	return segment{literal: seg}, nil
+}
+
+//catchAll is whether the shape matches every path
+func (s *shape) catchAll() bool {
+	return s.re == nil && s.host == "" && s.prefix && len(s.segs) == 1 && s.segs[0].literal == ""
+}
+
+//accepts is whether a parameter segment can be str
+func (seg segment) accepts(str string) bool {
+	return str != "" && (seg.re == nil || seg.re.MatchString(str))
+}
+
+func (seg segment) example() string {
+	if !seg.param {
+		return seg.literal
+	}
+	if seg.re != nil {
+		if ex, ok := regexpExample(seg.re); ok && seg.accepts(ex) {
+			return ex
+		}
+	}
+	return "x"
+}
+
+//example is a path the shape matches
+func (s *shape) example() string {
+	if s.re != nil {
+		ex, _ := regexpExample(s.re)
+		return ex
+	}
+	parts := make([]string, len(s.segs))
+	for i, seg := range s.segs {
+		parts[i] = seg.example()
+	}
+	return "/" + strings.Join(parts, "/")
+}
+
+//match is whether the shape matches path
+func (s *shape) match(path string) bool {
+	if s.re != nil {
+		return s.re.MatchString(path)
+	}
+	if !strings.HasPrefix(path, "/") {
+		return false
+	}
+	parts := strings.Split(path[1:], "/")
+	n := len(s.segs)
+	if len(parts) < n || !s.prefix && len(parts) != n {
+		return false
+	}
+	for i, seg := range s.segs {
+		last := s.prefix && i == n-1
+		switch {
+		case seg.param:
+			if !seg.accepts(parts[i]) {
+				return false
+			}
+		case last:
+			if !strings.HasPrefix(parts[i], seg.literal) {
+				return false
+			}
+		case parts[i] != seg.literal:
+			return false
+		}
+	}
+	return true
+}
+
+//overlap finds a path both shapes match
+func overlap(a, b *shape) (string, bool) {
+	if a.re != nil || b.re != nil {
+		for _, path := range []string{a.example(), b.example()} {
+			if path != "" && a.match(path) && b.match(path) {
+				return path, true
+			}
+		}
+		return "", false
+	}
+	if len(a.segs) > len(b.segs) {
+		a, b = b, a
+	}
+	n := len(a.segs)
+	if n < len(b.segs) && !a.prefix {
+		return "", false
+	}
+	parts := make([]string, 0, len(b.segs))
+	for i := 0; i < n; i++ {
+		part, ok := unify(a.segs[i], a.prefix && i == n-1, b.segs[i], b.prefix && i == len(b.segs)-1)
+		if !ok {
+			return "", false
+		}
+		parts = append(parts, part)
+	}
+	for _, seg := range b.segs[n:] {
+		parts = append(parts, seg.example())
+	}
+	return "/" + strings.Join(parts, "/"), true
+}
+
+//unify finds a path segment two segments both match. A prefix segment
+//matches anything starting with it.
+func unify(a segment, aPrefix bool, b segment, bPrefix bool) (string, bool) {
+	if a.param && !b.param {
+		a, aPrefix, b, bPrefix = b, bPrefix, a, aPrefix
+	}
+	switch {
+	case !a.param && !b.param:
+		switch {
+		case a.literal == b.literal:
+			return a.literal, true
+		case aPrefix && strings.HasPrefix(b.literal, a.literal):
+			return b.literal, true
+		case bPrefix && strings.HasPrefix(a.literal, b.literal):
+			return a.literal, true
+		}
+		return "", false
+	case !a.param:
+		if b.accepts(a.literal) {
+			return a.literal, true
+		}
+		if aPrefix {
+			if ex := b.example(); strings.HasPrefix(ex, a.literal) && b.accepts(ex) {
+				return ex, true
+			}
+			if b.accepts(a.literal + "x") {
+				return a.literal + "x", true
+			}
+		}
+		return "", false
+	default:
+		for _, ex := range []string{a.example(), b.example()} {
+			if a.accepts(ex) && b.accepts(ex) {
+				return ex, true
+			}
+		}
+		return "", false
+	}
+}
+
+//covers is whether a matches every path b does
+func covers(a, b *shape) bool {
+	if a.host != "" && a.host != b.host {
+		return false
+	}
+	switch {
+	case a.re != nil && b.re != nil:
+		return a.re.String() == b.re.String()
+	case a.re != nil:
+		//Only a single path can be checked against a regular expression
+		if b.prefix {
+			return false
+		}
+		for _, seg := range b.segs {
+			if seg.param {
+				return false
+			}
+		}
+		return a.match(b.example())
+	case b.re != nil:
+		//A prefix with no parameters covers a regular expression that
+		//only matches paths starting with it
+		if !a.prefix {
+			return false
+		}
+		var lit strings.Builder
+		for _, seg := range a.segs {
+			if seg.param {
+				return false
+			}
+			lit.WriteString("/" + seg.literal)
+		}
+		return strings.HasPrefix(regexpPrefix(b.re), lit.String())
+	}
+
+	n := len(a.segs)
+	if !a.prefix {
+		if b.prefix || len(b.segs) != n {
+			return false
+		}
+		for i := range a.segs {
+			if !segmentCovers(a.segs[i], b.segs[i]) {
+				return false
+			}
+		}
+		return true
+	}
+	if len(b.segs) < n {
+		return false
+	}
+	for i := 0; i < n-1; i++ {
+		if !segmentCovers(a.segs[i], b.segs[i]) {
+			return false
+		}
+	}
+	last, bLast := a.segs[n-1], b.segs[n-1]
+	switch {
+	case last.param:
+		return segmentCovers(last, bLast)
+	case bLast.param:
+		return last.literal == ""
+	default:
+		return strings.HasPrefix(bLast.literal, last.literal)
+	}
+}
+
+//segmentCovers is whether a matches every path segment b does
+func segmentCovers(a, b segment) bool {
+	switch {
+	case !a.param:
+		return !b.param && a.literal == b.literal
+	case !b.param:
+		return a.accepts(b.literal)
+	case a.re == nil:
+		return true
+	}
+	return b.re != nil && a.re.String() == b.re.String()
+}
+
+//regexpPrefix is the literal text every match of a path regular expression
+//anchored with ^ starts with
+func regexpPrefix(re *regexp.Regexp) string {
+	expr := re.String()
+	if !strings.HasPrefix(expr, "^") {
+		return ""
+	}
+	unanchored, err := regexp.Compile(expr[1:])
+	if err != nil {
+		return ""
+	}
+	prefix, _ := unanchored.LiteralPrefix()
+	return prefix
+}
+
+var errNoExample = errors.New("routes: no example for the regular expression")
+
+//regexpExample makes up a short string re matches
+func regexpExample(re *regexp.Regexp) (string, bool) {
+	parsed, err := syntax.Parse(re.String(), syntax.Perl)
+	if err != nil {
+		return "", false
+	}
+	var b strings.Builder
+	if err := writeExample(&b, parsed.Simplify()); err != nil {
+		return "", false
+	}
+	ex := b.String()
+	return ex, re.MatchString(ex)
+}
+
+func writeExample(b *strings.Builder, re *syntax.Regexp) error {
+	switch re.Op {
+	case syntax.OpLiteral:
+		b.WriteString(string(re.Rune))
+	case syntax.OpCharClass:
+		b.WriteRune(classExample(re.Rune))
+	case syntax.OpAnyChar, syntax.OpAnyCharNotNL:
+		b.WriteByte('x')
+	case syntax.OpCapture, syntax.OpPlus:
+		return writeExample(b, re.Sub[0])
+	case syntax.OpRepeat:
+		for i := 0; i < re.Min; i++ {
+			if err := writeExample(b, re.Sub[0]); err != nil {
+				return err
+			}
+		}
+	case syntax.OpConcat:
+		for _, sub := range re.Sub {
+			if err := writeExample(b, sub); err != nil {
+				return err
+			}
+		}
+	case syntax.OpAlternate:
+		return writeExample(b, re.Sub[0])
+	case syntax.OpStar, syntax.OpQuest, syntax.OpEmptyMatch,
+		syntax.OpBeginLine, syntax.OpEndLine, syntax.OpBeginText, syntax.OpEndText,
+		syntax.OpWordBoundary, syntax.OpNoWordBoundary:
+	default:
+		return errNoExample
+	}
+	return nil
+}
+
+//classExample picks a readable rune from a character class's ranges
+func classExample(ranges []rune) rune {
+	for _, r := range []rune{'x', 'a', '0'} {
+		for i := 0; i+1 < len(ranges); i += 2 {
+			if ranges[i] <= r && r <= ranges[i+1] {
+				return r
+			}
+		}
+	}
+	return ranges[0]
+}
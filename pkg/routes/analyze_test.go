@@ -0,0 +1,285 @@
+package routes
+
+import (
+	"bytes"
+	"fmt"
+	"log"
+	"net/http"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/zenazn/goji/web"
+)
+
+//The tests' routers register the routes the servemux, goji-routing-basics
+//and gorilla-mux-basics samples do, in the same order
+
+func serveMuxSample() *Registry {
+	reg := New()
+	m := reg.ServeMux(http.NewServeMux())
+	m.HandleFunc("/sloths", serveSloths)
+	m.HandleFunc("/kangaroos/", serveSloths)
+	m.HandleFunc("/", serveSloths)
+	m.HandleFunc("/tea/", serveTea)
+	m.HandleFunc("/tea/hibiscus", serveTea)
+	m.Handle("/debug/routes", reg.Handler())
+	return reg
+}
+
+func gojiSample(reg *Registry, beforeCatchAll func(m *GojiMux)) *GojiMux {
+	m := reg.Goji(web.New())
+	m.Handle("/sloths", serveSloths)
+	m.Handle("/:flavor/tea", serveTea)
+	m.Handle("/img/*", http.StripPrefix("/img/", http.FileServer(http.Dir("public/images"))))
+	m.Get("/get-route", serveSloths)
+	m.Get(regexp.MustCompile(`^/(coffee)+$`), serveTea)
+	m.Get("/debug/routes", reg.Handler())
+	m.Handle("/", serveSloths)
+	if beforeCatchAll != nil {
+		beforeCatchAll(m)
+	}
+	m.Handle("/*", serveSloths)
+	return m
+}
+
+func gorillaSample(beforeCatchAll func(m *mux.Router)) *mux.Router {
+	m := mux.NewRouter()
+	m.HandleFunc("/sloths", serveSloths)
+	m.PathPrefix("/img/").Handler(http.StripPrefix("/img/", http.FileServer(http.Dir("public/images"))))
+	m.HandleFunc("/{flavor}/tea", serveTea)
+	m.HandleFunc(`/{drink:(?:coffee)+}`, serveTea)
+	m.Handle("/debug/routes", http.NotFoundHandler()).Methods("GET")
+	if beforeCatchAll != nil {
+		beforeCatchAll(m)
+	}
+	m.PathPrefix("/").HandlerFunc(serveSloths)
+	return m
+}
+
+func gorillaRoutes(t *testing.T, m *mux.Router) []Route {
+	reg := New()
+	if err := reg.Gorilla(m); err != nil {
+		t.Fatal(err)
+	}
+	return reg.Routes()
+}
+
+//checkProblems checks the problems' severities, kinds, routes' patterns
+//and example paths, written like "warning shadowed /tea/ by /tea/hibiscus
+//at /tea/hibiscus"
+func checkProblems(t *testing.T, problems []Problem, expected ...string) {
+	t.Helper()
+	got := make([]string, len(problems))
+	for i, p := range problems {
+		got[i] = strings.Join([]string{p.Severity.String(), string(p.Kind),
+			p.Route.Pattern, "by", p.By.Pattern, "at", p.Path}, " ")
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("Problems expected\n%s\ngot\n%s", strings.Join(expected, "\n"), strings.Join(got, "\n"))
+	}
+}
+
+func TestAnalyzeServeMuxSample(t *testing.T) {
+	//The catch-all route overlaps every other route, but that's what it's
+	//for; /tea/hibiscus taking requests from /tea/ is worth knowing
+	checkProblems(t, Analyze(serveMuxSample().Routes()),
+		"warning shadowed /tea/ by /tea/hibiscus at /tea/hibiscus")
+}
+
+func TestAnalyzeServeMux(t *testing.T) {
+	route := func(pattern string) Route {
+		return serveMuxRoute(pattern, serveTea)
+	}
+	tests := []struct {
+		a, b     string
+		expected []string
+	}{
+		//Different methods and different hosts don't overlap
+		{"GET /tea/", "POST /tea/", nil},
+		{"sloths.example/tea/", "lemurs.example/tea/", nil},
+		//Only the slash differs
+		{"/tea", "/tea/", nil},
+		//{$} matches only the slash
+		{"/tea/{$}", "/tea/hibiscus", nil},
+		{"/tea/", "/tea/{$}", []string{"warning shadowed /tea/ by /tea/{$} at /tea/"}},
+		//A method or a host is more specific too
+		{"/tea/", "GET /tea/", []string{"warning shadowed /tea/ by /tea/ at /tea/"}},
+		{"/tea/", "sloths.example/tea/", []string{"warning shadowed /tea/ by sloths.example/tea/ at /tea/"}},
+		{"/files/{path...}", "/files/{name}", []string{"warning shadowed /files/{path...} by /files/{name} at /files/x"}},
+		{"/{flavor}/tea", "/green/tea", []string{"warning shadowed /{flavor}/tea by /green/tea at /green/tea"}},
+		//A host breaks what would be a conflict
+		{"sloths.example/{flavor}/tea", "/green/{drink}", []string{"warning shadowed /green/{drink} by sloths.example/{flavor}/tea at /green/tea"}},
+		//Neither is more specific, which ServeMux panics on
+		{"/{flavor}/tea", "/green/{drink}", []string{"fatal conflict /green/{drink} by /{flavor}/tea at /green/tea"}},
+		{"GET /tea/", "/tea/hibiscus", []string{"fatal conflict /tea/hibiscus by /tea/ at /tea/hibiscus"}},
+		{"/{flavor}/tea", "/{drink}/tea", []string{"fatal conflict /{drink}/tea by /{flavor}/tea at /x/tea"}},
+		{"/tea/", "/tea/", []string{"fatal duplicate /tea/ by /tea/ at /tea/"}},
+	}
+	for _, test := range tests {
+		t.Run(test.a+" and "+test.b, func(t *testing.T) {
+			checkProblems(t, Analyze([]Route{route(test.a), route(test.b)}), test.expected...)
+
+			//Registering the routes panics with the fatal problem, and a
+			//ServeMux would panic on them too
+			var fatal string
+			for _, p := range Analyze([]Route{route(test.a), route(test.b)}) {
+				if p.Severity == Fatal {
+					fatal = "routes: " + p.String()
+				}
+			}
+			m := New().ServeMux(http.NewServeMux())
+			m.HandleFunc(test.a, serveTea)
+			if got := registerPanic(func() { m.HandleFunc(test.b, serveTea) }); got != fatal {
+				t.Errorf("Panic expected %q, got %q", fatal, got)
+			}
+			stdMux := http.NewServeMux()
+			stdMux.HandleFunc(test.a, serveTea)
+			if got := registerPanic(func() { stdMux.HandleFunc(test.b, serveTea) }); (got != "") != (fatal != "") {
+				t.Errorf("ServeMux panic expected %v, got %q", fatal != "", got)
+			}
+		})
+	}
+}
+
+//registerPanic is what register panics with, or "" if it doesn't
+func registerPanic(register func()) (msg string) {
+	defer func() {
+		if v := recover(); v != nil {
+			msg = fmt.Sprint(v)
+		}
+	}()
+	register()
+	return ""
+}
+
+func TestAnalyzeGojiSample(t *testing.T) {
+	//A request for an image called tea goes to the tea route
+	reg := New()
+	gojiSample(reg, nil)
+	checkProblems(t, Analyze(reg.Routes()),
+		"warning shadowed /img/* by /:flavor/tea at /img/tea")
+}
+
+func TestAnalyzeGoji(t *testing.T) {
+	tests := []struct {
+		name     string
+		routes   func(m *GojiMux)
+		expected []string
+	}{{
+		"more specific route after a parameter",
+		func(m *GojiMux) { m.Handle("/green/tea", serveTea) },
+		[]string{"fatal unreachable /green/tea by /:flavor/tea at /green/tea"},
+	}, {
+		"route for an image after the image route",
+		func(m *GojiMux) { m.Get("/img/sloth.jpg", serveTea) },
+		[]string{"fatal unreachable /img/sloth.jpg by /img/* at /img/sloth.jpg"},
+	}, {
+		"path the regular expression matches",
+		func(m *GojiMux) { m.Get("/coffeecoffee", serveTea) },
+		[]string{"fatal unreachable /coffeecoffee by ^/(coffee)+$ at /coffeecoffee"},
+	}, {
+		"HEAD route after the GET route",
+		func(m *GojiMux) { m.Head("/get-route", serveTea) },
+		[]string{"fatal duplicate /get-route by /get-route at /get-route"},
+	}, {
+		"route for more methods after a GET route",
+		func(m *GojiMux) { m.Handle("/get-route", serveTea) },
+		nil,
+	}, {
+		"POST route after a route for all methods",
+		func(m *GojiMux) { m.Post("/sloths", serveTea) },
+		[]string{"fatal duplicate /sloths by /sloths at /sloths"},
+	}, {
+		"POST route with a parameter after a route for all methods",
+		func(m *GojiMux) { m.Post("/:animal", serveTea) },
+		[]string{"warning shadowed /:animal by /sloths at /sloths"},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			reg := New()
+			gojiSample(reg, test.routes)
+			//The image route is shadowed by the tea route in all of them
+			expected := append([]string{"warning shadowed /img/* by /:flavor/tea at /img/tea"}, test.expected...)
+			checkProblems(t, Analyze(reg.Routes()), expected...)
+		})
+	}
+
+	//With the catch-all route first, nothing else can be reached
+	reg := New()
+	m := reg.Goji(web.New())
+	m.Handle("/*", serveSloths)
+	m.Handle("/sloths", serveSloths)
+	m.Get(regexp.MustCompile(`^/(coffee)+$`), serveTea)
+	checkProblems(t, Analyze(reg.Routes()),
+		"fatal unreachable /sloths by /* at /sloths",
+		"fatal unreachable ^/(coffee)+$ by /* at /coffee")
+}
+
+func TestAnalyzeGorillaSample(t *testing.T) {
+	checkProblems(t, Analyze(gorillaRoutes(t, gorillaSample(nil))),
+		"warning shadowed /{flavor}/tea by /img/ at /img/tea")
+}
+
+func TestAnalyzeGorilla(t *testing.T) {
+	tests := []struct {
+		name     string
+		routes   func(m *mux.Router)
+		expected []string
+	}{{
+		"path the regular expression parameter matches",
+		func(m *mux.Router) { m.HandleFunc("/coffeecoffee", serveTea) },
+		[]string{"fatal unreachable /coffeecoffee by /{drink:(?:coffee)+} at /coffeecoffee"},
+	}, {
+		"path the regular expression parameter doesn't match",
+		func(m *mux.Router) { m.HandleFunc("/tea", serveTea) },
+		nil,
+	}, {
+		"prefix without a slash",
+		func(m *mux.Router) { m.PathPrefix("/sloth").Handler(http.NotFoundHandler()) },
+		//It comes after /sloths, which it covers, but /{flavor}/tea takes
+		//some of its requests
+		[]string{"warning shadowed /sloth by /{flavor}/tea at /sloth/tea"},
+	}, {
+		"POST route after a route for all methods",
+		func(m *mux.Router) { m.HandleFunc("/{flavor}/tea", serveTea).Methods("POST") },
+		[]string{
+			"warning shadowed /{flavor}/tea by /img/ at /img/tea",
+			"fatal duplicate /{flavor}/tea by /{flavor}/tea at /x/tea",
+		},
+	}, {
+		"subrouter under the image prefix",
+		func(m *mux.Router) { m.PathPrefix("/img").Subrouter().HandleFunc("/{name}", serveTea) },
+		[]string{"fatal unreachable /img/{name} by /img/ at /img/x"},
+	}}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			expected := append([]string{"warning shadowed /{flavor}/tea by /img/ at /img/tea"}, test.expected...)
+			checkProblems(t, Analyze(gorillaRoutes(t, gorillaSample(test.routes))), expected...)
+		})
+	}
+}
+
+func TestCheck(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+	if err := serveMuxSample().Check(logger); err != nil {
+		t.Fatalf("Check expected no error for warnings, got %v", err)
+	}
+	expected := "warning: net/http route ANY /tea/ doesn't get requests like /tea/hibiscus, " +
+		"which go to the more specific ANY /tea/hibiscus\n"
+	if buf.String() != expected {
+		t.Fatalf("Log expected %q, got %q", expected, buf.String())
+	}
+
+	buf.Reset()
+	reg := New()
+	gojiSample(reg, func(m *GojiMux) { m.Head("/get-route", serveTea) })
+	if err := reg.Check(logger); err == nil {
+		t.Fatal("Check expected an error for a fatal problem")
+	}
+	if !strings.Contains(buf.String(), "fatal: goji route HEAD /get-route is registered again after GET,HEAD /get-route") {
+		t.Fatalf("Log expected the duplicate route, got %q", buf.String())
+	}
+}
@@ -0,0 +1,100 @@
+package routes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/zenazn/goji/web"
+)
+
+//A GojiMux is a Goji web.Mux that records the routes registered on it.
+//Middleware is added to it with Use like with the web.Mux.
+type GojiMux struct {
+	*web.Mux
+	reg *Registry
+}
+
+//Goji wraps m so the routes registered on it are recorded in reg
+func (reg *Registry) Goji(m *web.Mux) *GojiMux {
+	return &GojiMux{Mux: m, reg: reg}
+}
+
+func (m *GojiMux) add(pattern web.PatternType, handler web.HandlerType, methods ...string) {
+	route := Route{Router: GojiRouter, Methods: methods, Handler: handlerName(handler)}
+	switch p := pattern.(type) {
+	case string:
+		route.Pattern = p
+		route.Prefix = strings.HasSuffix(p, "*")
+	case *regexp.Regexp:
+		route.Pattern = p.String()
+		route.Regexp = true
+		//A regular expression that isn't anchored to the end of the path
+		//matches paths that only start with a match
+		route.Prefix = !strings.HasSuffix(route.Pattern, "$")
+	default:
+		route.Pattern = fmt.Sprint(p)
+	}
+	m.reg.Add(route)
+}
+
+//Handle records the route and registers it for all methods
+func (m *GojiMux) Handle(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Handle(pattern, handler)
+	m.add(pattern, handler)
+}
+
+//Connect records the route and registers it for CONNECT requests
+func (m *GojiMux) Connect(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Connect(pattern, handler)
+	m.add(pattern, handler, "CONNECT")
+}
+
+//Delete records the route and registers it for DELETE requests
+func (m *GojiMux) Delete(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Delete(pattern, handler)
+	m.add(pattern, handler, "DELETE")
+}
+
+//Get records the route and registers it for GET requests, which in Goji
+//also handles HEAD requests
+func (m *GojiMux) Get(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Get(pattern, handler)
+	m.add(pattern, handler, "GET", "HEAD")
+}
+
+//Head records the route and registers it for HEAD requests
+func (m *GojiMux) Head(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Head(pattern, handler)
+	m.add(pattern, handler, "HEAD")
+}
+
+//Options records the route and registers it for OPTIONS requests
+func (m *GojiMux) Options(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Options(pattern, handler)
+	m.add(pattern, handler, "OPTIONS")
+}
+
+//Patch records the route and registers it for PATCH requests
+func (m *GojiMux) Patch(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Patch(pattern, handler)
+	m.add(pattern, handler, "PATCH")
+}
+
+//Post records the route and registers it for POST requests
+func (m *GojiMux) Post(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Post(pattern, handler)
+	m.add(pattern, handler, "POST")
+}
+
+//Put records the route and registers it for PUT requests
+func (m *GojiMux) Put(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Put(pattern, handler)
+	m.add(pattern, handler, "PUT")
+}
+
+//Trace records the route and registers it for TRACE requests
+func (m *GojiMux) Trace(pattern web.PatternType, handler web.HandlerType) {
+	m.Mux.Trace(pattern, handler)
+	m.add(pattern, handler, "TRACE")
+}
@@ -0,0 +1,40 @@
+package routes
+
+import (
+	"strings"
+
+	"github.com/gorilla/mux"
+)
+
+//Gorilla records the routes registered on r, including its subrouters'.
+//Call it once all the routes are registered: a Gorilla route's methods and
+//other matchers are added to it after it's registered, like in
+//r.HandleFunc("/sloths", h).Methods("GET"), so they're read back from the
+//finished router instead of recorded as the routes are registered.
+func (reg *Registry) Gorilla(r *mux.Router) error {
+	return r.Walk(func(route *mux.Route, router *mux.Router, ancestors []*mux.Route) error {
+		//A subrouter's route has no handler of its own; the routes on the
+		//subrouter are walked next
+		handler := route.GetHandler()
+		if handler == nil {
+			return nil
+		}
+		template, err := route.GetPathTemplate()
+		if err != nil {
+			//A route without a path, matching only a host or headers
+			template = ""
+		}
+		methods, _ := route.GetMethods()
+		//A route made with PathPrefix has a path regexp that isn't anchored
+		//to the end of the path
+		re, _ := route.GetPathRegexp()
+		reg.Add(Route{
+			Router:  GorillaRouter,
+			Methods: methods,
+			Pattern: template,
+			Prefix:  re != "" && !strings.HasSuffix(re, "$"),
+			Handler: handlerName(handler),
+		})
+		return nil
+	})
+}
@@ -0,0 +1,164 @@
+//Package routes records the routes a server registers on its routers, for
+//seeing which patterns are registered, in which order and with which
+//handlers, when a request isn't going where it's expected to. The routes
+//can be printed as a table with the -routes flag, or looked at in a running
+//server on a /debug/routes page.
+package routes
+
+import (
+	"flag"
+	"fmt"
+	"html/template"
+	"io"
+	"net/http"
+	"reflect"
+	"runtime"
+	"strings"
+	"sync"
+	"text/tabwriter"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/content"
+)
+
+//Names of the routers routes are registered on
+const (
+	ServeMuxRouter = "net/http"
+	GorillaRouter  = "gorilla/mux"
+	GojiRouter     = "goji"
+)
+
+//FlagName is the name of the flag RegisterFlag registers
+const FlagName = "routes"
+
+//A Route is one route registered on a router
+type Route struct {
+	//Router is the router the route was registered on, like ServeMuxRouter
+	Router string `json:"router"`
+	//Methods are the HTTP methods the route handles, or none for a route
+	//that handles all of them
+	Methods []string `json:"methods,omitempty"`
+	//Pattern is the route's pattern, written the way its router takes it
+	Pattern string `json:"pattern"`
+	//Regexp is whether Pattern is a regular expression, like a Goji
+	//pattern made with regexp.MustCompile
+	Regexp bool `json:"regexp,omitempty"`
+	//Prefix is whether the route matches every path starting with its
+	//pattern instead of only the pattern, like a ServeMux pattern ending in
+	//a slash or a Goji pattern ending in *
+	Prefix bool `json:"prefix,omitempty"`
+	//Handler is the name of the route's handler: the function's name for a
+	//handler function, or the type's for any other handler
+	Handler string `json:"handler"`
+}
+
+//MethodString is the route's methods separated by commas, or "ANY" for a
+//route that handles all of them
+func (route Route) MethodString() string {
+	if len(route.Methods) == 0 {
+		return "ANY"
+	}
+	return strings.Join(route.Methods, ",")
+}
+
+//A Registry records routes in the order they're registered. It's safe to
+//use from more than one goroutine.
+type Registry struct {
+	mu     sync.Mutex
+	routes []Route
+}
+
+//New makes an empty Registry
+func New() *Registry {
+	return &Registry{}
+}
+
+//Add records a route
+func (reg *Registry) Add(route Route) {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	reg.routes = append(reg.routes, route)
+}
+
+//Routes returns the routes recorded so far, in the order they were
+//registered
+func (reg *Registry) Routes() []Route {
+	reg.mu.Lock()
+	defer reg.mu.Unlock()
+	return append([]Route(nil), reg.routes...)
+}
+
+//WriteTable writes the routes as a table with a column for each of their
+//router, methods, pattern and handler
+func (reg *Registry) WriteTable(w io.Writer) error {
+	tw := tabwriter.NewWriter(w, 0, 8, 2, ' ', 0)
+	fmt.Fprintln(tw, "ROUTER\tMETHODS\tPATTERN\tHANDLER")
+	for _, route := range reg.Routes() {
+		fmt.Fprintf(tw, "%s\t%s\t%s\t%s\n",
+			route.Router, route.MethodString(), patternString(route), route.Handler)
+	}
+	return tw.Flush()
+}
+
+//patternString is the pattern for the table, marked if it's a regular
+//expression since those don't look like one in every router
+func patternString(route Route) string {
+	if route.Regexp {
+		return "regexp " + route.Pattern
+	}
+	return route.Pattern
+}
+
+var page = template.Must(template.New("routes").Funcs(template.FuncMap{
+	"pattern": patternString,
+}).Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Routes</title></head>
+<body>
+<h1>Routes</h1>
+<p>In the order they were registered</p>
+<table>
+<tr><th>Router</th><th>Methods</th><th>Pattern</th><th>Handler</th></tr>
+{{range .}}<tr><td>{{.Router}}</td><td>{{.MethodString}}</td><td><code>{{pattern .}}</code></td><td><code>{{.Handler}}</code></td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+//Handler serves the routes as a page for a /debug/routes route, as an HTML
+//table, JSON or the same plain text table as WriteTable depending on the
+//request's Accept header. The page lists the routes registered when it's
+//requested.
+func (reg *Registry) Handler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		routes := reg.Routes()
+		var table strings.Builder
+		reg.WriteTable(&table)
+		content.Respond(w, r, http.StatusOK,
+			content.HTML(page, routes),
+			content.JSON(routes),
+			content.Text("%s", strings.TrimSuffix(table.String(), "\n")))
+	})
+}
+
+//RegisterFlag registers the -routes flag on fs. If it's set once the flags
+//are parsed, a server should print its routes with WriteTable and exit
+//instead of serving.
+func RegisterFlag(fs *flag.FlagSet) *bool {
+	return fs.Bool(FlagName, false, "print the registered routes and exit")
+}
+
+//handlerName names a handler: a function by its name, like
+//main.serveHitNumber or main.main.func1 for a function literal, and any
+//other handler by its type
+func handlerName(h interface{}) string {
+	if h == nil {
+		return "<nil>"
+	}
+	v := reflect.ValueOf(h)
+	if v.Kind() == reflect.Func {
+		if fn := runtime.FuncForPC(v.Pointer()); fn != nil {
+			return fn.Name()
+		}
+	}
+	return fmt.Sprintf("%T", h)
+}
@@ -0,0 +1,183 @@
+package routes
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/gorilla/mux"
+	"github.com/zenazn/goji/web"
+)
+
+func serveSloths(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "Sloths rule!")
+}
+
+func serveTea(w http.ResponseWriter, r *http.Request) {
+	fmt.Fprintf(w, "One tea coming right up!")
+}
+
+func TestServeMux(t *testing.T) {
+	reg := New()
+	mux := reg.ServeMux(http.NewServeMux())
+	mux.HandleFunc("/sloths", serveSloths)
+	mux.HandleFunc("/tea/", serveTea)
+	mux.Handle("DELETE /img/{name}", http.NotFoundHandler())
+
+	expected := []Route{
+		{Router: ServeMuxRouter, Pattern: "/sloths", Handler: "github.com/AndyHaskell/MEAN-Gopher/pkg/routes.serveSloths"},
+		{Router: ServeMuxRouter, Pattern: "/tea/", Prefix: true, Handler: "github.com/AndyHaskell/MEAN-Gopher/pkg/routes.serveTea"},
+		{Router: ServeMuxRouter, Methods: []string{"DELETE"}, Pattern: "/img/{name}", Handler: "net/http.NotFound"},
+	}
+	routes := reg.Routes()
+	if len(routes) != len(expected) {
+		t.Fatalf("Routes expected %d, got %d: %+v", len(expected), len(routes), routes)
+	}
+	for i := range expected {
+		if !reflect.DeepEqual(routes[i], expected[i]) {
+			t.Errorf("Route %d expected %+v, got %+v", i, expected[i], routes[i])
+		}
+	}
+
+	//The routes are still served by the ServeMux
+	w := httptest.NewRecorder()
+	mux.ServeHTTP(w, httptest.NewRequest("GET", "/tea/hibiscus", nil))
+	if w.Body.String() != "One tea coming right up!" {
+		t.Errorf("Response expected the tea route, got %q", w.Body.String())
+	}
+}
+
+func TestGoji(t *testing.T) {
+	reg := New()
+	m := reg.Goji(web.New())
+	m.Handle("/sloths", serveSloths)
+	m.Get(regexp.MustCompile(`^/(coffee)+$`), serveTea)
+	m.Post("/img/*", serveTea)
+	m.Handle("/*", http.NotFoundHandler())
+
+	routes := reg.Routes()
+	expected := []struct {
+		methods string
+		pattern string
+		regexp  bool
+		prefix  bool
+	}{
+		{"ANY", "/sloths", false, false},
+		{"GET,HEAD", "^/(coffee)+$", true, false},
+		{"POST", "/img/*", false, true},
+		{"ANY", "/*", false, true},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("Routes expected %d, got %d: %+v", len(expected), len(routes), routes)
+	}
+	for i, e := range expected {
+		route := routes[i]
+		if route.Router != GojiRouter || route.MethodString() != e.methods ||
+			route.Pattern != e.pattern || route.Regexp != e.regexp || route.Prefix != e.prefix {
+			t.Errorf("Route %d expected %+v, got %+v", i, e, route)
+		}
+	}
+	if !strings.HasSuffix(routes[0].Handler, ".serveSloths") {
+		t.Errorf("Handler expected serveSloths, got %s", routes[0].Handler)
+	}
+
+	w := httptest.NewRecorder()
+	m.ServeHTTP(w, httptest.NewRequest("GET", "/coffeecoffee", nil))
+	if w.Body.String() != "One tea coming right up!" {
+		t.Errorf("Response expected the coffee route, got %q", w.Body.String())
+	}
+}
+
+func TestGorilla(t *testing.T) {
+	r := mux.NewRouter()
+	r.HandleFunc("/sloths", serveSloths).Methods("GET", "POST")
+	api := r.PathPrefix("/api").Subrouter()
+	api.HandleFunc("/{flavor}/tea", serveTea)
+	r.PathPrefix("/").Handler(http.NotFoundHandler())
+
+	reg := New()
+	if err := reg.Gorilla(r); err != nil {
+		t.Fatal(err)
+	}
+	routes := reg.Routes()
+	expected := []struct {
+		methods string
+		pattern string
+		prefix  bool
+	}{
+		{"GET,POST", "/sloths", false},
+		{"ANY", "/api/{flavor}/tea", false},
+		{"ANY", "/", true},
+	}
+	if len(routes) != len(expected) {
+		t.Fatalf("Routes expected %d, got %d: %+v", len(expected), len(routes), routes)
+	}
+	for i, e := range expected {
+		route := routes[i]
+		if route.Router != GorillaRouter || route.MethodString() != e.methods ||
+			route.Pattern != e.pattern || route.Prefix != e.prefix {
+			t.Errorf("Route %d expected %+v, got %+v", i, e, route)
+		}
+	}
+	if !strings.HasSuffix(routes[1].Handler, ".serveTea") {
+		t.Errorf("Handler expected serveTea, got %s", routes[1].Handler)
+	}
+}
+
+func TestWriteTable(t *testing.T) {
+	reg := New()
+	reg.Add(Route{Router: ServeMuxRouter, Pattern: "/sloths", Handler: "main.sloths"})
+	reg.Add(Route{Router: GojiRouter, Methods: []string{"GET", "HEAD"},
+		Pattern: "^/(coffee)+$", Regexp: true, Handler: "main.coffee"})
+
+	var b strings.Builder
+	if err := reg.WriteTable(&b); err != nil {
+		t.Fatal(err)
+	}
+	expected := "ROUTER    METHODS   PATTERN              HANDLER\n" +
+		"net/http  ANY       /sloths              main.sloths\n" +
+		"goji      GET,HEAD  regexp ^/(coffee)+$  main.coffee\n"
+	if b.String() != expected {
+		t.Fatalf("Table expected\n%s\ngot\n%s", expected, b.String())
+	}
+}
+
+func TestHandler(t *testing.T) {
+	reg := New()
+	mux := reg.ServeMux(http.NewServeMux())
+	mux.HandleFunc("/tea/", serveTea)
+	mux.Handle("/debug/routes", reg.Handler())
+
+	w := httptest.NewRecorder()
+	r := httptest.NewRequest("GET", "/debug/routes", nil)
+	r.Header.Set("Accept", "application/json")
+	mux.ServeHTTP(w, r)
+	var routes []Route
+	if err := json.NewDecoder(w.Body).Decode(&routes); err != nil {
+		t.Fatal(err)
+	}
+	if len(routes) != 2 || routes[0].Pattern != "/tea/" || routes[1].Pattern != "/debug/routes" {
+		t.Fatalf("JSON routes expected /tea/ and /debug/routes, got %+v", routes)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/debug/routes", nil)
+	r.Header.Set("Accept", "text/html")
+	mux.ServeHTTP(w, r)
+	if body := w.Body.String(); !strings.Contains(body, "<code>/tea/</code>") {
+		t.Fatalf("HTML page expected the /tea/ route, got %s", body)
+	}
+
+	w = httptest.NewRecorder()
+	r = httptest.NewRequest("GET", "/debug/routes", nil)
+	r.Header.Set("Accept", "text/plain")
+	mux.ServeHTTP(w, r)
+	if body := w.Body.String(); !strings.HasPrefix(body, "ROUTER") || !strings.Contains(body, "/debug/routes") {
+		t.Fatalf("Text table expected the routes, got %s", body)
+	}
+}
@@ -0,0 +1,67 @@
+package routes
+
+import (
+	"net/http"
+	"strings"
+	"sync"
+)
+
+//A ServeMux is an http.ServeMux that records the routes registered on it
+type ServeMux struct {
+	*http.ServeMux
+	reg *Registry
+
+	mu     sync.Mutex
+	routes []Route
+}
+
+//ServeMux wraps mux so the routes registered on it are recorded in reg
+func (reg *Registry) ServeMux(mux *http.ServeMux) *ServeMux {
+	return &ServeMux{ServeMux: mux, reg: reg}
+}
+
+//Handle records the route and registers it on the ServeMux. Like
+//http.ServeMux.Handle, it panics if the pattern is already registered or
+//conflicts with one that is, but with a message from Analyze saying which
+//route it conflicts with and for which requests.
+func (mux *ServeMux) Handle(pattern string, handler http.Handler) {
+	mux.add(serveMuxRoute(pattern, handler), func() { mux.ServeMux.Handle(pattern, handler) })
+}
+
+//HandleFunc records the route and registers it on the ServeMux, panicking
+//like Handle if the pattern is already registered or conflicts with one
+//that is
+func (mux *ServeMux) HandleFunc(pattern string, handler func(http.ResponseWriter, *http.Request)) {
+	mux.add(serveMuxRoute(pattern, handler), func() { mux.ServeMux.HandleFunc(pattern, handler) })
+}
+
+//add checks route against the routes registered on the ServeMux before
+//calling register, since the ServeMux's own panic only says which patterns
+//conflict
+func (mux *ServeMux) add(route Route, register func()) {
+	mux.mu.Lock()
+	defer mux.mu.Unlock()
+	routes := append(mux.routes[:len(mux.routes):len(mux.routes)], route)
+	for _, p := range analyzeServeMux(routes) {
+		if p.Severity == Fatal {
+			panic("routes: " + p.String())
+		}
+	}
+	register()
+	mux.routes = routes
+	mux.reg.Add(route)
+}
+
+//serveMuxRoute splits a pattern like "DELETE /img/{name}" into its method
+//and path
+func serveMuxRoute(pattern string, handler interface{}) Route {
+	route := Route{Router: ServeMuxRouter, Pattern: pattern, Handler: handlerName(handler)}
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		route.Methods = []string{pattern[:i]}
+		route.Pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+	//{$} matches only the path before it, and {name...} the rest of the
+	//path
+	route.Prefix = strings.HasSuffix(route.Pattern, "/") || strings.HasSuffix(route.Pattern, "...}")
+	return route
+}
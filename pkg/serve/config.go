@@ -0,0 +1,326 @@
+package serve
+
+import (
+	"crypto/tls"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"net"
+	"net/http"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+//EnvPrefix starts the name of every environment variable a Config is read
+//from, like MEAN_GOPHER_ADDR for the addr setting.
+const EnvPrefix = "MEAN_GOPHER_"
+
+//A Config describes how to build and run a sample's http.Server
+type Config struct {
+	//Addr is the TCP address to listen on, like ":1123"
+	Addr string
+	//UnixSocket is the path of a Unix socket to listen on. If it's set,
+	//it's used instead of Addr.
+	UnixSocket string
+
+	ReadTimeout       time.Duration
+	ReadHeaderTimeout time.Duration
+	WriteTimeout      time.Duration
+	IdleTimeout       time.Duration
+	MaxHeaderBytes    int
+
+	//TLSCertFile and TLSKeyFile are the paths of the certificate and key
+	//to serve HTTPS with. They're either both set or both empty.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	//DrainTimeout is how long to let in-flight requests finish on shutdown
+	DrainTimeout time.Duration
+}
+
+//DefaultConfig is the Config every sample starts from before flags,
+//environment variables and config files are applied.
+func DefaultConfig() Config {
+	return Config{
+		Addr:              ":1123",
+		ReadTimeout:       15 * time.Second,
+		ReadHeaderTimeout: 5 * time.Second,
+		WriteTimeout:      15 * time.Second,
+		IdleTimeout:       60 * time.Second,
+		MaxHeaderBytes:    http.DefaultMaxHeaderBytes,
+		DrainTimeout:      DefaultDrainTimeout,
+	}
+}
+
+//A setting is one Config field, named the same way as a flag, a config
+//file key and (upper-cased with EnvPrefix) an environment variable.
+type setting struct {
+	name  string
+	usage string
+	get   func(c *Config) string
+	set   func(c *Config, v string) error
+}
+
+func stringSetting(name, usage string, field func(c *Config) *string) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		get:   func(c *Config) string { return *field(c) },
+		set: func(c *Config, v string) error {
+			*field(c) = v
+			return nil
+		},
+	}
+}
+
+func durationSetting(name, usage string, field func(c *Config) *time.Duration) setting {
+	return setting{
+		name:  name,
+		usage: usage,
+		get:   func(c *Config) string { return field(c).String() },
+		set: func(c *Config, v string) error {
+			d, err := time.ParseDuration(v)
+			if err != nil {
+				return fmt.Errorf("%s: %q isn't a duration like 10s", name, v)
+			}
+			*field(c) = d
+			return nil
+		},
+	}
+}
+
+var settings = []setting{
+	stringSetting("addr", "TCP address to listen on",
+		func(c *Config) *string { return &c.Addr }),
+	stringSetting("unix-socket", "Unix socket to listen on instead of addr",
+		func(c *Config) *string { return &c.UnixSocket }),
+	durationSetting("read-timeout", "maximum time to read a whole request",
+		func(c *Config) *time.Duration { return &c.ReadTimeout }),
+	durationSetting("read-header-timeout", "maximum time to read request headers",
+		func(c *Config) *time.Duration { return &c.ReadHeaderTimeout }),
+	durationSetting("write-timeout", "maximum time to write a response",
+		func(c *Config) *time.Duration { return &c.WriteTimeout }),
+	durationSetting("idle-timeout", "how long to keep idle keep-alive connections open",
+		func(c *Config) *time.Duration { return &c.IdleTimeout }),
+	{
+		name:  "max-header-bytes",
+		usage: "maximum size of request headers in bytes",
+		get:   func(c *Config) string { return strconv.Itoa(c.MaxHeaderBytes) },
+		set: func(c *Config, v string) error {
+			n, err := strconv.Atoi(v)
+			if err != nil {
+				return fmt.Errorf("max-header-bytes: %q isn't a whole number", v)
+			}
+			c.MaxHeaderBytes = n
+			return nil
+		},
+	},
+	stringSetting("tls-cert", "TLS certificate file; serves HTTPS when set with tls-key",
+		func(c *Config) *string { return &c.TLSCertFile }),
+	stringSetting("tls-key", "TLS private key file",
+		func(c *Config) *string { return &c.TLSKeyFile }),
+	durationSetting("drain-timeout", "how long to let in-flight requests finish on shutdown",
+		func(c *Config) *time.Duration { return &c.DrainTimeout }),
+}
+
+func envName(name string) string {
+	return EnvPrefix + strings.ToUpper(strings.ReplaceAll(name, "-", "_"))
+}
+
+//ConfigFlags are the configuration flags registered on a FlagSet
+type ConfigFlags struct {
+	fs         *flag.FlagSet
+	values     map[string]*string
+	configFile *string
+}
+
+//RegisterFlags registers a flag for every Config setting on fs, plus a
+//-config flag for the path of a JSON config file. Call Load after fs has
+//been parsed.
+func RegisterFlags(fs *flag.FlagSet) *ConfigFlags {
+	defaults := DefaultConfig()
+	f := &ConfigFlags{fs: fs, values: make(map[string]*string)}
+	for _, s := range settings {
+		f.values[s.name] = fs.String(s.name, s.get(&defaults),
+			s.usage+" (env "+envName(s.name)+")")
+	}
+	f.configFile = fs.String("config", "",
+		"JSON file with settings keyed by flag name (env "+envName("config")+")")
+	return f
+}
+
+//Load builds a Config starting from DefaultConfig, then applying the
+//config file, then environment variables, then flags, so flags win. The
+//Config is validated before it's returned.
+func (f *ConfigFlags) Load() (Config, error) {
+	c := DefaultConfig()
+
+	path := os.Getenv(envName("config"))
+	if f.isSet("config") {
+		path = *f.configFile
+	}
+	if path != "" {
+		if err := c.applyFile(path); err != nil {
+			return c, err
+		}
+	}
+
+	for _, s := range settings {
+		if v, ok := os.LookupEnv(envName(s.name)); ok {
+			if err := s.set(&c, v); err != nil {
+				return c, fmt.Errorf("serve: %s: %w", envName(s.name), err)
+			}
+		}
+	}
+
+	for _, s := range settings {
+		if f.isSet(s.name) {
+			if err := s.set(&c, *f.values[s.name]); err != nil {
+				return c, fmt.Errorf("serve: flag -%w", err)
+			}
+		}
+	}
+
+	return c, c.Validate()
+}
+
+func (f *ConfigFlags) isSet(name string) bool {
+	set := false
+	f.fs.Visit(func(fl *flag.Flag) {
+		if fl.Name == name {
+			set = true
+		}
+	})
+	return set
+}
+
+//applyFile applies the settings in a JSON config file to c. Values can be
+//strings or numbers; keys that aren't settings are an error so typos
+//don't go unnoticed.
+func (c *Config) applyFile(path string) error {
+	file, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("serve: config file: %w", err)
+	}
+	defer file.Close()
+
+	var values map[string]interface{}
+	dec := json.NewDecoder(file)
+	dec.UseNumber()
+	if err := dec.Decode(&values); err != nil {
+		return fmt.Errorf("serve: config file %s: %w", path, err)
+	}
+
+	for key, value := range values {
+		s, ok := findSetting(key)
+		if !ok {
+			return fmt.Errorf("serve: config file %s: unknown setting %q", path, key)
+		}
+		var v string
+		switch value := value.(type) {
+		case string:
+			v = value
+		case json.Number:
+			v = value.String()
+		default:
+			return fmt.Errorf("serve: config file %s: %s must be a string or number", path, key)
+		}
+		if err := s.set(c, v); err != nil {
+			return fmt.Errorf("serve: config file %s: %w", path, err)
+		}
+	}
+	return nil
+}
+
+func findSetting(name string) (setting, bool) {
+	for _, s := range settings {
+		if s.name == name {
+			return s, true
+		}
+	}
+	return setting{}, false
+}
+
+//Validate reports everything wrong with c at once, so a bad config is
+//caught before the server starts rather than when it's first used.
+func (c Config) Validate() error {
+	var errs []error
+	if c.UnixSocket == "" {
+		if _, port, err := net.SplitHostPort(c.Addr); err != nil {
+			errs = append(errs, fmt.Errorf("addr %q: %w", c.Addr, err))
+		} else if n, err := strconv.Atoi(port); port != "" && err == nil && (n < 0 || n > 65535) {
+			errs = append(errs, fmt.Errorf("addr %q: port out of range", c.Addr))
+		}
+	}
+
+	for _, d := range []struct {
+		name  string
+		value time.Duration
+	}{
+		{"read-timeout", c.ReadTimeout},
+		{"read-header-timeout", c.ReadHeaderTimeout},
+		{"write-timeout", c.WriteTimeout},
+		{"idle-timeout", c.IdleTimeout},
+		{"drain-timeout", c.DrainTimeout},
+	} {
+		if d.value < 0 {
+			errs = append(errs, fmt.Errorf("%s can't be negative", d.name))
+		}
+	}
+	if c.MaxHeaderBytes < 0 {
+		errs = append(errs, errors.New("max-header-bytes can't be negative"))
+	}
+
+	if (c.TLSCertFile == "") != (c.TLSKeyFile == "") {
+		errs = append(errs, errors.New("tls-cert and tls-key have to be set together"))
+	} else if c.TLSCertFile != "" {
+		if _, err := tls.LoadX509KeyPair(c.TLSCertFile, c.TLSKeyFile); err != nil {
+			errs = append(errs, fmt.Errorf("tls-cert/tls-key: %w", err))
+		}
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("serve: invalid config: %w", errors.Join(errs...))
+	}
+	return nil
+}
+
+//NewServer builds an http.Server from c that serves handler
+func (c Config) NewServer(handler http.Handler) *http.Server {
+	return &http.Server{
+		Addr:              c.Addr,
+		Handler:           handler,
+		ReadTimeout:       c.ReadTimeout,
+		ReadHeaderTimeout: c.ReadHeaderTimeout,
+		WriteTimeout:      c.WriteTimeout,
+		IdleTimeout:       c.IdleTimeout,
+		MaxHeaderBytes:    c.MaxHeaderBytes,
+	}
+}
+
+//Runner builds a Runner from c that serves handler
+func (c Config) Runner(handler http.Handler) *Runner {
+	return &Runner{
+		Server:       c.NewServer(handler),
+		UnixSocket:   c.UnixSocket,
+		TLSCertFile:  c.TLSCertFile,
+		TLSKeyFile:   c.TLSKeyFile,
+		DrainTimeout: c.DrainTimeout,
+	}
+}
+
+//ListenAndServe registers the config flags on the command line, parses
+//it, loads the Config and runs handler with it. Samples with flags of
+//their own should use RegisterFlags and Config.Runner instead.
+func ListenAndServe(handler http.Handler) error {
+	f := RegisterFlags(flag.CommandLine)
+	flag.Parse()
+	c, err := f.Load()
+	if err != nil {
+		return err
+	}
+	return c.Runner(handler).Run()
+}
@@ -0,0 +1,261 @@
+package serve
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"encoding/pem"
+	"flag"
+	"io"
+	"math/big"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+//loadConfig parses args into a fresh FlagSet and loads a Config from it
+func loadConfig(t *testing.T, args ...string) (Config, error) {
+	fs := flag.NewFlagSet("test", flag.ContinueOnError)
+	fs.SetOutput(io.Discard)
+	f := RegisterFlags(fs)
+	if err := fs.Parse(args); err != nil {
+		t.Fatal(err)
+	}
+	return f.Load()
+}
+
+func writeFile(t *testing.T, name, contents string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadDefaults(t *testing.T) {
+	c, err := loadConfig(t)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c != DefaultConfig() {
+		t.Fatalf("Load() with no settings expected %+v, got %+v", DefaultConfig(), c)
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	path := writeFile(t, "config.json", `{
+		"addr": ":2000",
+		"read-timeout": "3s",
+		"write-timeout": "4s",
+		"max-header-bytes": 4096
+	}`)
+	t.Setenv("MEAN_GOPHER_CONFIG", path)
+	t.Setenv("MEAN_GOPHER_ADDR", ":3000")
+	t.Setenv("MEAN_GOPHER_READ_TIMEOUT", "5s")
+
+	c, err := loadConfig(t, "-addr", ":4000")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if c.Addr != ":4000" {
+		t.Errorf("Addr from a flag expected :4000, got %s", c.Addr)
+	}
+	if c.ReadTimeout != 5*time.Second {
+		t.Errorf("ReadTimeout from the environment expected 5s, got %s", c.ReadTimeout)
+	}
+	if c.WriteTimeout != 4*time.Second {
+		t.Errorf("WriteTimeout from the config file expected 4s, got %s", c.WriteTimeout)
+	}
+	if c.MaxHeaderBytes != 4096 {
+		t.Errorf("MaxHeaderBytes from the config file expected 4096, got %d", c.MaxHeaderBytes)
+	}
+	if c.IdleTimeout != DefaultConfig().IdleTimeout {
+		t.Errorf("IdleTimeout expected the default %s, got %s",
+			DefaultConfig().IdleTimeout, c.IdleTimeout)
+	}
+}
+
+func TestLoadErrors(t *testing.T) {
+	badFile := writeFile(t, "config.json", `{"adr": ":2000"}`)
+	tests := []struct {
+		args     []string
+		contains string
+	}{
+		{[]string{"-addr", "1123"}, "addr"},
+		{[]string{"-addr", ":70000"}, "port out of range"},
+		{[]string{"-read-timeout", "soon"}, "read-timeout"},
+		{[]string{"-idle-timeout", "-1s"}, "idle-timeout can't be negative"},
+		{[]string{"-max-header-bytes", "lots"}, "max-header-bytes"},
+		{[]string{"-tls-cert", "cert.pem"}, "set together"},
+		{[]string{"-tls-cert", "missing.pem", "-tls-key", "missing.key"}, "tls-cert/tls-key"},
+		{[]string{"-config", badFile}, `unknown setting "adr"`},
+		{[]string{"-config", "missing.json"}, "config file"},
+	}
+	for _, test := range tests {
+		_, err := loadConfig(t, test.args...)
+		if err == nil || !strings.Contains(err.Error(), test.contains) {
+			t.Errorf("Load() with %v expected an error containing %q, got %v",
+				test.args, test.contains, err)
+		}
+	}
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	c := DefaultConfig()
+	c.Addr = "nope"
+	c.WriteTimeout = -time.Second
+	c.MaxHeaderBytes = -1
+
+	err := c.Validate()
+	if err == nil {
+		t.Fatalf("Validate() expected an error, got nil")
+	}
+	for _, s := range []string{"addr", "write-timeout", "max-header-bytes"} {
+		if !strings.Contains(err.Error(), s) {
+			t.Errorf("Validate() error expected to mention %s, got %v", s, err)
+		}
+	}
+}
+
+func TestNewServer(t *testing.T) {
+	c := DefaultConfig()
+	c.ReadHeaderTimeout = 2 * time.Second
+	c.MaxHeaderBytes = 2048
+	server := c.NewServer(http.NotFoundHandler())
+
+	if server.Addr != c.Addr || server.ReadHeaderTimeout != 2*time.Second ||
+		server.MaxHeaderBytes != 2048 || server.Handler == nil {
+		t.Fatalf("NewServer() didn't copy the Config, got %+v", server)
+	}
+}
+
+func TestRunnerUnixSocket(t *testing.T) {
+	c := DefaultConfig()
+	c.UnixSocket = filepath.Join(t.TempDir(), "server.sock")
+	runner := c.Runner(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, world!"))
+	}))
+	runner.Logger = quietLogger
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- runner.RunContext(ctx) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		DialContext: func(ctx context.Context, _, _ string) (net.Conn, error) {
+			return (&net.Dialer{}).DialContext(ctx, "unix", c.UnixSocket)
+		},
+	}}
+	body := getWithRetry(t, client, "http://unix/")
+	if body != "Hello, world!" {
+		t.Fatalf("Response body expected %v, got %v", "Hello, world!", body)
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Fatalf("RunContext() expected nil, got %v", err)
+	}
+	if _, err := os.Stat(c.UnixSocket); !os.IsNotExist(err) {
+		t.Fatalf("Socket file expected to be removed on shutdown, got %v", err)
+	}
+}
+
+func TestRunnerTLS(t *testing.T) {
+	certFile, keyFile, pool := writeTestCert(t)
+	c := DefaultConfig()
+	c.Addr = "127.0.0.1:0"
+	c.TLSCertFile, c.TLSKeyFile = certFile, keyFile
+	if err := c.Validate(); err != nil {
+		t.Fatal(err)
+	}
+
+	runner := c.Runner(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("Hello, world!"))
+	}))
+	runner.Logger = quietLogger
+	ln, err := runner.listen()
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	runErr := make(chan error, 1)
+	go func() { runErr <- runner.Serve(ctx, ln) }()
+
+	client := &http.Client{Transport: &http.Transport{
+		TLSClientConfig: &tls.Config{RootCAs: pool},
+	}}
+	body := getWithRetry(t, client, "https://"+ln.Addr().String()+"/")
+	if body != "Hello, world!" {
+		t.Fatalf("Response body expected %v, got %v", "Hello, world!", body)
+	}
+
+	cancel()
+	if err := <-runErr; err != nil {
+		t.Fatalf("Serve() expected nil, got %v", err)
+	}
+}
+
+//getWithRetry GETs url, retrying briefly while the server starts up
+func getWithRetry(t *testing.T, client *http.Client, url string) string {
+	var err error
+	for i := 0; i < 50; i++ {
+		var res *http.Response
+		if res, err = client.Get(url); err == nil {
+			defer res.Body.Close()
+			body, err := io.ReadAll(res.Body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			return string(body)
+		}
+		time.Sleep(20 * time.Millisecond)
+	}
+	t.Fatalf("GET %s failed: %v", url, err)
+	return ""
+}
+
+//writeTestCert writes a self-signed certificate for 127.0.0.1 and returns
+//the file paths and a pool that trusts it.
+func writeTestCert(t *testing.T) (certFile, keyFile string, pool *x509.CertPool) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(1),
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+		KeyUsage:     x509.KeyUsageDigitalSignature,
+		ExtKeyUsage:  []x509.ExtKeyUsage{x509.ExtKeyUsageServerAuth},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	keyDER, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	certFile = writeFile(t, "cert.pem",
+		string(pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der})))
+	keyFile = writeFile(t, "key.pem",
+		string(pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: keyDER})))
+
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pool = x509.NewCertPool()
+	pool.AddCert(cert)
+	return certFile, keyFile, pool
+}
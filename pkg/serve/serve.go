@@ -0,0 +1,168 @@
+//Package serve runs the samples' http.Servers, reporting listen errors and
+//shutting down gracefully on SIGINT or SIGTERM so in-flight requests get to
+//finish.
+package serve
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"log"
+	"net"
+	"net/http"
+	"os"
+	"os/signal"
+	"syscall"
+	"time"
+)
+
+//DefaultDrainTimeout is how long a Runner waits for in-flight requests to
+//finish when shutting down if it isn't given a DrainTimeout.
+const DefaultDrainTimeout = 10 * time.Second
+
+//ErrDrainTimeout is returned when in-flight requests were still running
+//when the drain timeout ran out and had to be cut off.
+var ErrDrainTimeout = errors.New("serve: drain timeout exceeded, closed remaining connections")
+
+//A Runner runs an http.Server until it fails or is told to stop
+type Runner struct {
+	//Server is the server to run; its Addr is where it listens
+	Server *http.Server
+
+	//UnixSocket is the path of a Unix socket to listen on instead of the
+	//Server's Addr, if it's set.
+	UnixSocket string
+
+	//TLSCertFile and TLSKeyFile are the certificate and key to serve
+	//HTTPS with. If they're empty, plain HTTP is served.
+	TLSCertFile string
+	TLSKeyFile  string
+
+	//DrainTimeout is how long to let in-flight requests finish during
+	//shutdown. If it's 0, DefaultDrainTimeout is used.
+	DrainTimeout time.Duration
+
+	//Signals are the signals that start a graceful shutdown. If it's
+	//empty, SIGINT and SIGTERM are used.
+	Signals []os.Signal
+
+	//Logger logs when the server starts and stops. If it's nil, the
+	//standard logger is used.
+	Logger *log.Logger
+}
+
+//Run runs server with the default drain timeout and signals. It returns
+//nil after a graceful shutdown.
+func Run(server *http.Server) error {
+	r := &Runner{Server: server}
+	return r.Run()
+}
+
+//Run listens on the Server's Addr, or the UnixSocket if there is one, and
+//serves until a shutdown signal arrives or the server fails.
+func (r *Runner) Run() error {
+	return r.RunContext(context.Background())
+}
+
+//RunContext is like Run, but also shuts down gracefully when ctx is done.
+//A UnixSocket's file is removed once the server has stopped, so the next
+//run can listen on the same path.
+func (r *Runner) RunContext(ctx context.Context) error {
+	ln, err := r.listen()
+	if err != nil {
+		return err
+	}
+	if r.UnixSocket != "" {
+		defer removeSocket(r.UnixSocket)
+	}
+	return r.Serve(ctx, ln)
+}
+
+//removeSocket removes the socket file at path, leaving anything that
+//isn't a socket alone
+func removeSocket(path string) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		os.Remove(path)
+	}
+}
+
+func (r *Runner) listen() (net.Listener, error) {
+	network, addr := "tcp", r.Server.Addr
+	if r.UnixSocket != "" {
+		network, addr = "unix", r.UnixSocket
+		//Clear out a socket file left behind by a server that crashed
+		removeSocket(addr)
+	} else if addr == "" {
+		if r.TLSCertFile != "" {
+			addr = ":https"
+		} else {
+			addr = ":http"
+		}
+	}
+
+	ln, err := net.Listen(network, addr)
+	if err != nil {
+		return nil, fmt.Errorf("serve: listening on %s: %w", addr, err)
+	}
+	return ln, nil
+}
+
+//Serve serves on ln until ctx is done, a shutdown signal arrives, or the
+//server fails. ln is closed when Serve returns.
+func (r *Runner) Serve(ctx context.Context, ln net.Listener) error {
+	signals := r.Signals
+	if len(signals) == 0 {
+		signals = []os.Signal{os.Interrupt, syscall.SIGTERM}
+	}
+	ctx, stop := signal.NotifyContext(ctx, signals...)
+	defer stop()
+
+	serveErr := make(chan error, 1)
+	go func() {
+		if r.TLSCertFile != "" {
+			serveErr <- r.Server.ServeTLS(ln, r.TLSCertFile, r.TLSKeyFile)
+		} else {
+			serveErr <- r.Server.Serve(ln)
+		}
+	}()
+	r.logger().Printf("Listening on %s", ln.Addr())
+
+	select {
+	case err := <-serveErr:
+		//The server stopped on its own, so something went wrong
+		return fmt.Errorf("serve: %w", err)
+	case <-ctx.Done():
+	}
+	stop() //a second signal kills the process the usual way
+	return r.shutdown(serveErr)
+}
+
+//shutdown stops accepting connections and waits up to the drain timeout
+//for in-flight requests before closing whatever is left.
+func (r *Runner) shutdown(serveErr <-chan error) error {
+	timeout := r.DrainTimeout
+	if timeout <= 0 {
+		timeout = DefaultDrainTimeout
+	}
+	r.logger().Printf("Shutting down, waiting up to %s for requests to finish", timeout)
+
+	ctx, cancel := context.WithTimeout(context.Background(), timeout)
+	defer cancel()
+
+	err := r.Server.Shutdown(ctx)
+	if errors.Is(err, context.DeadlineExceeded) {
+		r.Server.Close()
+		err = ErrDrainTimeout
+	}
+	if serr := <-serveErr; err == nil && !errors.Is(serr, http.ErrServerClosed) {
+		err = serr
+	}
+	return err
+}
+
+func (r *Runner) logger() *log.Logger {
+	if r.Logger != nil {
+		return r.Logger
+	}
+	return log.Default()
+}
@@ -0,0 +1,154 @@
+package serve
+
+import (
+	"context"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+var quietLogger = log.New(io.Discard, "", 0)
+
+//slowServer makes an unstarted httptest server whose handler blocks until
+//release is closed, signaling started when a request comes in.
+func slowServer() (ts *httptest.Server, started, release chan struct{}) {
+	started = make(chan struct{})
+	release = make(chan struct{})
+	ts = httptest.NewUnstartedServer(http.HandlerFunc(
+		func(w http.ResponseWriter, r *http.Request) {
+			close(started)
+			<-release
+			w.Write([]byte("Hello, world!"))
+		}))
+	return ts, started, release
+}
+
+//runInBackground serves ts's listener with runner until ctx is canceled
+func runInBackground(ctx context.Context, runner *Runner, ts *httptest.Server) <-chan error {
+	runErr := make(chan error, 1)
+	go func() {
+		runErr <- runner.Serve(ctx, ts.Listener)
+	}()
+	return runErr
+}
+
+func TestRunReportsListenError(t *testing.T) {
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer ln.Close()
+
+	runner := &Runner{
+		Server: &http.Server{Addr: ln.Addr().String()},
+		Logger: quietLogger,
+	}
+	err = runner.Run()
+	if err == nil || !strings.Contains(err.Error(), "listening on") {
+		t.Fatalf("Run() on a taken address expected a listen error, got %v", err)
+	}
+}
+
+func TestRunRemovesUnixSocket(t *testing.T) {
+	socket := filepath.Join(t.TempDir(), "server.sock")
+	//Run twice on the same path; the second run only gets to listen if the
+	//first one's socket file is gone
+	for i := 0; i < 2; i++ {
+		runner := &Runner{Server: &http.Server{}, UnixSocket: socket, Logger: quietLogger}
+		ctx, cancel := context.WithCancel(context.Background())
+		runErr := make(chan error, 1)
+		go func() { runErr <- runner.RunContext(ctx) }()
+
+		for start := time.Now(); ; time.Sleep(10 * time.Millisecond) {
+			if fi, err := os.Stat(socket); err == nil && fi.Mode()&os.ModeSocket != 0 {
+				break
+			}
+			if time.Since(start) > 5*time.Second {
+				t.Fatalf("Run %d expected to listen on %s", i+1, socket)
+			}
+		}
+		cancel()
+		if err := <-runErr; err != nil {
+			t.Fatalf("Run %d expected nil, got %v", i+1, err)
+		}
+		if _, err := os.Stat(socket); !os.IsNotExist(err) {
+			t.Fatalf("Socket file expected to be removed after run %d, got %v", i+1, err)
+		}
+	}
+}
+
+func TestShutdownDrainsInFlightRequests(t *testing.T) {
+	ts, started, release := slowServer()
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+
+	runner := &Runner{Server: ts.Config, DrainTimeout: 5 * time.Second, Logger: quietLogger}
+	runErr := runInBackground(ctx, runner, ts)
+
+	resErr := make(chan error, 1)
+	var body []byte
+	go func() {
+		res, err := http.Get("http://" + ts.Listener.Addr().String())
+		if err == nil {
+			body, err = io.ReadAll(res.Body)
+			res.Body.Close()
+		}
+		resErr <- err
+	}()
+
+	<-started
+	cancel()
+	//Give Shutdown a moment to start before letting the request finish
+	time.Sleep(50 * time.Millisecond)
+	close(release)
+
+	if err := <-resErr; err != nil {
+		t.Fatalf("In-flight request failed during shutdown: %v", err)
+	}
+	if string(body) != "Hello, world!" {
+		t.Fatalf("Response body expected %v, got %v", "Hello, world!", string(body))
+	}
+	if err := <-runErr; err != nil {
+		t.Fatalf("Serve() after a graceful shutdown expected nil, got %v", err)
+	}
+}
+
+func TestShutdownDrainTimeout(t *testing.T) {
+	ts, started, release := slowServer()
+	defer close(release)
+	ctx, cancel := context.WithCancel(context.Background())
+
+	runner := &Runner{Server: ts.Config, DrainTimeout: 50 * time.Millisecond, Logger: quietLogger}
+	runErr := runInBackground(ctx, runner, ts)
+
+	go http.Get("http://" + ts.Listener.Addr().String())
+	<-started
+	cancel()
+
+	select {
+	case err := <-runErr:
+		if err != ErrDrainTimeout {
+			t.Fatalf("Serve() expected ErrDrainTimeout, got %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatalf("Serve() didn't return after the drain timeout")
+	}
+}
+
+func TestServeReportsServerError(t *testing.T) {
+	ts := httptest.NewUnstartedServer(http.NotFoundHandler())
+	ts.Listener.Close()
+
+	runner := &Runner{Server: ts.Config, Logger: quietLogger}
+	err := runner.Serve(context.Background(), ts.Listener)
+	if err == nil {
+		t.Fatalf("Serve() on a closed listener expected an error, got nil")
+	}
+}
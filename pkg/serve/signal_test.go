@@ -0,0 +1,48 @@
+//go:build unix
+
+package serve
+
+import (
+	"context"
+	"os"
+	"os/signal"
+	"syscall"
+	"testing"
+	"time"
+)
+
+func TestShutdownOnSignal(t *testing.T) {
+	ts, _, release := slowServer()
+	close(release)
+
+	runner := &Runner{
+		Server:  ts.Config,
+		Signals: []os.Signal{syscall.SIGUSR1},
+		Logger:  quietLogger,
+	}
+	runErr := runInBackground(context.Background(), runner, ts)
+
+	//Catch SIGUSR1 ourselves too so a signal sent before the Runner is
+	//listening for it doesn't kill the test binary
+	sink := make(chan os.Signal, 1)
+	signal.Notify(sink, syscall.SIGUSR1)
+	defer signal.Stop(sink)
+
+	//Keep sending the signal until the Runner is listening for it
+	ticker := time.NewTicker(10 * time.Millisecond)
+	defer ticker.Stop()
+	timeout := time.After(5 * time.Second)
+	for {
+		select {
+		case err := <-runErr:
+			if err != nil {
+				t.Fatalf("Serve() after SIGUSR1 expected nil, got %v", err)
+			}
+			return
+		case <-ticker.C:
+			syscall.Kill(os.Getpid(), syscall.SIGUSR1)
+		case <-timeout:
+			t.Fatalf("Serve() didn't shut down on SIGUSR1")
+		}
+	}
+}
@@ -0,0 +1,400 @@
+package static
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+//Immutable is the Cache-Control header fingerprinted URLs are served with.
+//A fingerprinted URL's file never changes, since a new version of the file
+//gets a new URL, so it can be cached for as long as browsers allow.
+const Immutable = "public, max-age=31536000, immutable"
+
+//fingerprintLength is how many hex digits of a file's hash go in its
+//fingerprinted name
+const fingerprintLength = 10
+
+//Options configure a Server
+type Options struct {
+	//CacheControl maps file extensions, like ".jpg", to the Cache-Control
+	//header files with that extension are served with. The "" key is used
+	//for every other extension. Without either, no Cache-Control header is
+	//sent.
+	CacheControl map[string]string
+	//ETags turns on strong ETags made from a hash of each file's contents,
+	//so clients can revalidate a file even when its modification time isn't
+	//known, like in an embed.FS
+	ETags bool
+	//Precompressed turns on serving NAME.br or NAME.gz in place of NAME to
+	//clients that accept that encoding, if the file is there
+	Precompressed bool
+	//Fingerprint turns on serving a file's fingerprinted URL from URL, which
+	//has a hash of the file's contents in its name, with the Immutable
+	//Cache-Control header
+	Fingerprint bool
+	//Hardened turns off directory listings, so a directory without an
+	//index.html is a 404, and refuses to serve hidden files and files in
+	//hidden directories, whose names start with ".", with a 404. To refuse
+	//symlinks leading out of a directory on disk, serve it with DirFS
+	//instead of os.DirFS or http.Dir.
+	Hardened bool
+	//Throttle limits how many bytes per second files are sent at to each
+	//connection, shared between the requests being served on it at the
+	//same time. If it's 0, they're sent as fast as the connection goes.
+	Throttle int64
+	//Fallback is the file, like "index.html", served for requests for
+	//files that don't exist, for a single-page application that routes
+	//URLs itself in the browser. It's only served for browser navigations:
+	//GET requests that accept text/html for paths without an extension.
+	//Requests for anything else that doesn't exist, like a mistyped image,
+	//still get a 404.
+	Fallback string
+}
+
+//A Server is an http.Handler serving the files in an fs.FS, like
+//http.FileServerFS with the extras in its Options. Like http.FileServer,
+//it serves the file at the request's URL path, so use http.StripPrefix to
+//serve it on a route other than "/". Files are served with
+//http.ServeContent, so downloads can be resumed with Range requests,
+//including ones for more than one range and ones with an If-Range.
+type Server struct {
+	fsys  fs.FS
+	opts  Options
+	files http.Handler
+
+	mu     sync.Mutex
+	hashes map[string]fileHash
+	conns  map[string]*limiter
+}
+
+//fileHash is a file's SHA-256, with the modification time and size it had
+//when it was hashed, to tell whether it's changed since
+type fileHash struct {
+	modTime time.Time
+	size    int64
+	sum     []byte
+}
+
+//New makes a Server for the files in fsys
+func New(fsys fs.FS, opts Options) *Server {
+	return &Server{
+		fsys:   fsys,
+		opts:   opts,
+		files:  http.FileServerFS(fsys),
+		hashes: make(map[string]fileHash),
+		conns:  make(map[string]*limiter),
+	}
+}
+
+//Route serves the files in fsys on mux under the route path, like
+//"/img/", and returns the Server serving them
+func Route(mux *http.ServeMux, path string, fsys fs.FS, opts Options) *Server {
+	s := New(fsys, opts)
+	mux.Handle(path, http.StripPrefix(path, s))
+	return s
+}
+
+func (s *Server) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	upath := r.URL.Path
+	name := strings.TrimPrefix(path.Clean("/"+upath), "/")
+	if s.opts.Hardened && Hidden(name) {
+		http.NotFound(w, r)
+		return
+	}
+
+	if s.opts.Fallback != "" && path.Ext(name) == "" {
+		//Whether a path like this gets the fallback page depends on the
+		//request's Accept header
+		w.Header().Add("Vary", "Accept")
+		if navigation(r) {
+			if _, err := fs.Stat(s.fsys, name); errors.Is(err, fs.ErrNotExist) {
+				s.serveFile(w, r, s.opts.Fallback, false)
+				return
+			}
+		}
+	}
+
+	//Directories, index.html redirects and trailing slashes are left to
+	//http.FileServer
+	if name == "" || strings.HasSuffix(upath, "/") || path.Base(upath) == "index.html" {
+		s.serveDir(w, r, name)
+		return
+	}
+
+	immutable := false
+	if s.opts.Fingerprint {
+		if original, ok := s.unfingerprint(name); ok {
+			name, immutable = original, true
+		}
+	}
+	s.serveFile(w, r, name, immutable)
+}
+
+//serveFile serves the file name, with the Immutable Cache-Control header if
+//it was asked for by its fingerprinted name
+func (s *Server) serveFile(w http.ResponseWriter, r *http.Request, name string, immutable bool) {
+	f, info, err := s.open(name)
+	if err != nil {
+		//Leave 404s and permission errors to http.FileServer too
+		s.files.ServeHTTP(w, r)
+		return
+	}
+	if info.IsDir() {
+		f.Close()
+		s.serveDir(w, r, name)
+		return
+	}
+	defer func() { f.Close() }()
+
+	h := w.Header()
+	if cc := s.cacheControl(name, immutable); cc != "" {
+		h.Set("Cache-Control", cc)
+	}
+
+	served := name
+	if s.opts.Precompressed {
+		h.Add("Vary", "Accept-Encoding")
+		if ctype := mime.TypeByExtension(path.Ext(name)); ctype != "" {
+			if encoding, cf, cinfo, ok := s.precompressed(r, name); ok {
+				f.Close()
+				f, info, served = cf, cinfo, name+encodingExt[encoding]
+				h.Set("Content-Type", ctype)
+				h.Set("Content-Encoding", encoding)
+			}
+		}
+	}
+
+	if s.opts.ETags {
+		if sum, err := s.hash(served, info); err == nil {
+			h.Set("ETag", `"`+hex.EncodeToString(sum[:16])+`"`)
+		}
+	}
+
+	content, err := readSeeker(f)
+	if err != nil {
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	if s.opts.Throttle > 0 {
+		l := s.limiter(r.RemoteAddr)
+		defer s.release(r.RemoteAddr)
+		w = &throttledWriter{ResponseWriter: w, limiter: l, r: r}
+	}
+	http.ServeContent(w, r, name, info.ModTime(), content)
+}
+
+//serveDir serves the directory dir, or a URL http.FileServer redirects,
+//with http.FileServer. Hardened, a directory without an index.html is a
+//404 instead of a listing.
+func (s *Server) serveDir(w http.ResponseWriter, r *http.Request, dir string) {
+	if s.opts.Hardened {
+		index := path.Join(dir, "index.html")
+		if path.Base(r.URL.Path) == "index.html" {
+			index = dir
+		}
+		if info, err := fs.Stat(s.fsys, index); err != nil || info.IsDir() {
+			http.NotFound(w, r)
+			return
+		}
+	}
+	s.files.ServeHTTP(w, r)
+}
+
+//Hidden reports whether name, a slash-separated path in a file system, is
+//a hidden file or in a hidden directory
+func Hidden(name string) bool {
+	for _, part := range strings.Split(name, "/") {
+		if strings.HasPrefix(part, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+//URL returns the URL name, a path in the Server's file system, should be
+//linked to with, relative to the route the Server is on. With
+//Options.Fingerprint set, that's its fingerprinted name, like
+//sloth.3f2a9c1b7e.jpg for sloth.jpg, which changes whenever the file does.
+func (s *Server) URL(name string) (string, error) {
+	if !s.opts.Fingerprint {
+		return name, nil
+	}
+	f, info, err := s.open(name)
+	if err != nil {
+		return "", err
+	}
+	f.Close()
+	sum, err := s.hash(name, info)
+	if err != nil {
+		return "", err
+	}
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum)[:fingerprintLength] + ext, nil
+}
+
+//unfingerprint returns the name of the file a fingerprinted name is for,
+//if it's the fingerprint of that file as it is now
+func (s *Server) unfingerprint(name string) (string, bool) {
+	ext := path.Ext(name)
+	stem := strings.TrimSuffix(name, ext)
+	fingerprint := strings.TrimPrefix(path.Ext(stem), ".")
+	if len(fingerprint) != fingerprintLength {
+		return "", false
+	}
+	if _, err := hex.DecodeString(fingerprint); err != nil {
+		return "", false
+	}
+
+	original := strings.TrimSuffix(stem, "."+fingerprint) + ext
+	current, err := s.URL(original)
+	if err != nil || current != name {
+		return "", false
+	}
+	return original, true
+}
+
+func (s *Server) cacheControl(name string, immutable bool) string {
+	if immutable {
+		return Immutable
+	}
+	if cc, ok := s.opts.CacheControl[strings.ToLower(path.Ext(name))]; ok {
+		return cc
+	}
+	return s.opts.CacheControl[""]
+}
+
+//encodingExt maps the content codings Precompressed serves to the
+//extensions of the files they're in, in order of preference
+var encodingExt = map[string]string{"br": ".br", "gzip": ".gz"}
+
+//precompressed opens the precompressed copy of name the client accepts,
+//if there is one
+func (s *Server) precompressed(r *http.Request, name string) (string, fs.File, fs.FileInfo, bool) {
+	accept := r.Header.Get("Accept-Encoding")
+	for _, encoding := range []string{"br", "gzip"} {
+		if !acceptsEncoding(accept, encoding) {
+			continue
+		}
+		f, info, err := s.open(name + encodingExt[encoding])
+		if err != nil {
+			continue
+		}
+		if info.IsDir() {
+			f.Close()
+			continue
+		}
+		return encoding, f, info, true
+	}
+	return "", nil, nil, false
+}
+
+//acceptsEncoding reports whether an Accept-Encoding header accepts
+//encoding, either by name or with *, without q=0
+func acceptsEncoding(header, encoding string) bool {
+	if q, ok := quality(header, encoding); ok {
+		return q > 0
+	}
+	q, ok := quality(header, "*")
+	return ok && q > 0
+}
+
+//navigation reports whether r is a browser navigating to a page: a GET
+//request that accepts HTML by name. Scripts fetching data or images
+//usually send Accept: */* or the types they want instead.
+func navigation(r *http.Request) bool {
+	if r.Method != "GET" && r.Method != "HEAD" && r.Method != "" {
+		return false
+	}
+	accept := r.Header.Get("Accept")
+	for _, html := range []string{"text/html", "application/xhtml+xml"} {
+		if q, ok := quality(accept, html); ok && q > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+//quality returns the q value token is given in header, a comma separated
+//list like an Accept or Accept-Encoding header, and whether it's in it
+func quality(header, token string) (float64, bool) {
+	for _, part := range strings.Split(header, ",") {
+		value, params, _ := strings.Cut(part, ";")
+		if !strings.EqualFold(strings.TrimSpace(value), token) {
+			continue
+		}
+		q := 1.0
+		for _, param := range strings.Split(params, ";") {
+			if k, v, ok := strings.Cut(strings.TrimSpace(param), "="); ok && strings.EqualFold(k, "q") {
+				if parsed, err := strconv.ParseFloat(v, 64); err == nil {
+					q = parsed
+				}
+			}
+		}
+		return q, true
+	}
+	return 0, false
+}
+
+func (s *Server) open(name string) (fs.File, fs.FileInfo, error) {
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, nil, err
+	}
+	info, err := f.Stat()
+	if err != nil {
+		f.Close()
+		return nil, nil, err
+	}
+	return f, info, nil
+}
+
+//hash returns the SHA-256 of the file name, whose FileInfo is info. Hashes
+//are cached until the file's modification time or size changes.
+func (s *Server) hash(name string, info fs.FileInfo) ([]byte, error) {
+	s.mu.Lock()
+	cached, ok := s.hashes[name]
+	s.mu.Unlock()
+	if ok && cached.modTime.Equal(info.ModTime()) && cached.size == info.Size() {
+		return cached.sum, nil
+	}
+
+	f, err := s.fsys.Open(name)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return nil, err
+	}
+	sum := h.Sum(nil)
+
+	s.mu.Lock()
+	s.hashes[name] = fileHash{modTime: info.ModTime(), size: info.Size(), sum: sum}
+	s.mu.Unlock()
+	return sum, nil
+}
+
+//readSeeker returns f as an io.ReadSeeker for http.ServeContent, reading
+//it into memory if it can't seek
+func readSeeker(f fs.File) (io.ReadSeeker, error) {
+	if rs, ok := f.(io.ReadSeeker); ok {
+		return rs, nil
+	}
+	b, err := io.ReadAll(f)
+	if err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(b), nil
+}
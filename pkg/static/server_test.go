@@ -0,0 +1,440 @@
+package static
+
+import (
+	"bytes"
+	"fmt"
+	"io"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func images() fstest.MapFS {
+	return fstest.MapFS{
+		"sloth.jpg":         {Data: []byte("sloth pixels")},
+		"duck.jpg":          {Data: []byte("duck pixels")},
+		"ducks.html":        {Data: []byte("<p>Beware of ducks!</p>")},
+		"ducks.html.br":     {Data: []byte("brotli ducks")},
+		"ducks.html.gz":     {Data: []byte("gzipped ducks")},
+		"notes.txt":         {Data: []byte("sloths are slow")},
+		"photos/index.html": {Data: []byte("<p>Photos</p>")},
+	}
+}
+
+func get(h http.Handler, target string, header ...string) *httptest.ResponseRecorder {
+	r := httptest.NewRequest("GET", target, nil)
+	for i := 0; i+1 < len(header); i += 2 {
+		r.Header.Set(header[i], header[i+1])
+	}
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+	return w
+}
+
+func TestCacheControl(t *testing.T) {
+	s := New(images(), Options{CacheControl: map[string]string{
+		".jpg": "public, max-age=86400",
+		"":     "no-cache",
+	}})
+	tests := map[string]string{
+		"/sloth.jpg":  "public, max-age=86400",
+		"/ducks.html": "no-cache",
+	}
+	for target, expected := range tests {
+		w := get(s, target)
+		if w.Code != 200 || w.Header().Get("Cache-Control") != expected {
+			t.Errorf("%s expected 200 with Cache-Control %q, got %d with %q",
+				target, expected, w.Code, w.Header().Get("Cache-Control"))
+		}
+	}
+
+	if cc := get(New(images(), Options{}), "/sloth.jpg").Header().Get("Cache-Control"); cc != "" {
+		t.Errorf("Server without a cache policy expected no Cache-Control, got %q", cc)
+	}
+}
+
+func TestETags(t *testing.T) {
+	s := New(images(), Options{ETags: true})
+	w := get(s, "/sloth.jpg")
+	etag := w.Header().Get("ETag")
+	if w.Code != 200 || !strings.HasPrefix(etag, `"`) || strings.HasPrefix(etag, "W/") {
+		t.Fatalf("sloth.jpg expected 200 with a strong ETag, got %d with %q", w.Code, etag)
+	}
+	if other := get(s, "/duck.jpg").Header().Get("ETag"); other == etag {
+		t.Fatal("Different files expected different ETags")
+	}
+	if w = get(s, "/sloth.jpg", "If-None-Match", etag); w.Code != 304 {
+		t.Fatalf("sloth.jpg with its ETag in If-None-Match expected 304, got %d", w.Code)
+	}
+
+	fsys := images()
+	s = New(fsys, Options{ETags: true})
+	get(s, "/sloth.jpg")
+	fsys["sloth.jpg"] = &fstest.MapFile{Data: []byte("a sloth that moved")}
+	if w = get(s, "/sloth.jpg", "If-None-Match", etag); w.Code != 200 || w.Header().Get("ETag") == etag {
+		t.Fatalf("Edited sloth.jpg expected 200 with a new ETag, got %d with %q",
+			w.Code, w.Header().Get("ETag"))
+	}
+}
+
+func TestPrecompressed(t *testing.T) {
+	s := New(images(), Options{Precompressed: true, ETags: true})
+	tests := []struct {
+		accept, encoding, body string
+	}{
+		{"gzip, deflate, br", "br", "brotli ducks"},
+		{"gzip", "gzip", "gzipped ducks"},
+		{"br;q=0, gzip;q=0.5", "gzip", "gzipped ducks"},
+		{"*", "br", "brotli ducks"},
+		{"", "", "<p>Beware of ducks!</p>"},
+		{"gzip;q=0", "", "<p>Beware of ducks!</p>"},
+	}
+	etags := make(map[string]string)
+	for _, test := range tests {
+		w := get(s, "/ducks.html", "Accept-Encoding", test.accept)
+		if w.Header().Get("Content-Encoding") != test.encoding || w.Body.String() != test.body {
+			t.Errorf("Accept-Encoding %q expected encoding %q with %q, got %q with %q", test.accept,
+				test.encoding, test.body, w.Header().Get("Content-Encoding"), w.Body.String())
+		}
+		if ct := w.Header().Get("Content-Type"); ct != "text/html; charset=utf-8" {
+			t.Errorf("Accept-Encoding %q expected the HTML Content-Type, got %q", test.accept, ct)
+		}
+		if vary := w.Header().Get("Vary"); vary != "Accept-Encoding" {
+			t.Errorf("Accept-Encoding %q expected Vary: Accept-Encoding, got %q", test.accept, vary)
+		}
+		etags[test.encoding] = w.Header().Get("ETag")
+	}
+	if etags["br"] == etags["gzip"] || etags["gzip"] == etags[""] {
+		t.Errorf("Each encoding expected its own ETag, got %v", etags)
+	}
+
+	if w := get(s, "/notes.txt", "Accept-Encoding", "br"); w.Header().Get("Content-Encoding") != "" {
+		t.Error("File without a precompressed copy expected to be served uncompressed")
+	}
+}
+
+func TestFingerprint(t *testing.T) {
+	fsys := images()
+	s := New(fsys, Options{Fingerprint: true, CacheControl: map[string]string{"": "no-cache"}})
+	url, err := s.URL("sloth.jpg")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if url == "sloth.jpg" || !strings.HasPrefix(url, "sloth.") || !strings.HasSuffix(url, ".jpg") {
+		t.Fatalf("URL for sloth.jpg expected a fingerprinted sloth.HASH.jpg, got %q", url)
+	}
+
+	w := get(s, "/"+url)
+	if w.Code != 200 || w.Body.String() != "sloth pixels" || w.Header().Get("Cache-Control") != Immutable {
+		t.Fatalf("%s expected 200 with sloth.jpg and Cache-Control %q, got %d %q with %q", url,
+			Immutable, w.Code, w.Body.String(), w.Header().Get("Cache-Control"))
+	}
+	if ct := w.Header().Get("Content-Type"); ct != "image/jpeg" {
+		t.Fatalf("%s expected Content-Type image/jpeg, got %q", url, ct)
+	}
+	if w = get(s, "/sloth.jpg"); w.Header().Get("Cache-Control") != "no-cache" {
+		t.Fatalf("sloth.jpg expected its extension's Cache-Control, got %q", w.Header().Get("Cache-Control"))
+	}
+
+	//An old fingerprint is for a version of the file that's gone
+	fsys["sloth.jpg"] = &fstest.MapFile{Data: []byte("a sloth that moved")}
+	if w = get(s, "/"+url); w.Code != 404 {
+		t.Fatalf("Outdated fingerprinted URL expected 404, got %d", w.Code)
+	}
+	if w = get(s, "/sloth.0123456789.jpg"); w.Code != 404 {
+		t.Fatalf("Made up fingerprinted URL expected 404, got %d", w.Code)
+	}
+
+	if url, _ := New(fsys, Options{}).URL("sloth.jpg"); url != "sloth.jpg" {
+		t.Fatalf("URL without Fingerprint expected sloth.jpg, got %q", url)
+	}
+}
+
+func TestRoute(t *testing.T) {
+	mux := http.NewServeMux()
+	Route(mux, "/img/", images(), Options{})
+	tests := map[string]int{
+		"/img/sloth.jpg":         200,
+		"/img/photos/":           200,
+		"/img/photos":            301,
+		"/img/photos/index.html": 301,
+		"/img/hippo.jpg":         404,
+		"/img/sloth.jpg/":        301,
+		"/sloth.jpg":             404,
+	}
+	for target, code := range tests {
+		if w := get(mux, target); w.Code != code {
+			t.Errorf("%s expected %d, got %d", target, code, w.Code)
+		}
+	}
+}
+
+//publicDir makes a public/images directory like the samples' with a secret
+//next to it, hidden files and symlinks in it, and returns public/images
+func publicDir(t *testing.T) string {
+	dir := t.TempDir()
+	images := filepath.Join(dir, "public", "images")
+	files := map[string]string{
+		"secret.txt":                        "the duck venom antidote recipe",
+		"public/images/sloth.jpg":           "sloth pixels",
+		"public/images/.env":                "MEAN_GOPHER_CSRF_KEY=sloth",
+		"public/images/.git/config":         "[core]",
+		"public/images/ducks/duck.jpg":      "duck pixels",
+		"public/images/photos/index.html":   "<p>Photos</p>",
+		"public/images/photos/.hidden.html": "<p>Hidden</p>",
+	}
+	for name, contents := range files {
+		path := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(contents), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		"escape.txt": filepath.Join(dir, "secret.txt"),
+		"relative":   filepath.Join("..", ".."),
+		"sloth.png":  "sloth.jpg",
+	}
+	for name, target := range links {
+		if err := os.Symlink(target, filepath.Join(images, name)); err != nil {
+			t.Skipf("Can't make symlinks here: %v", err)
+		}
+	}
+	return images
+}
+
+func TestHardened(t *testing.T) {
+	mux := http.NewServeMux()
+	Route(mux, "/img/", DirFS(publicDir(t)), Options{Hardened: true})
+	tests := map[string]int{
+		"/img/sloth.jpg":                200,
+		"/img/sloth.png":                200,
+		"/img/photos/":                  200,
+		"/img/photos":                   301,
+		"/img/ducks/duck.jpg":           200,
+		"/img/":                         404,
+		"/img/ducks/":                   404,
+		"/img/ducks":                    404,
+		"/img/.env":                     404,
+		"/img/.git/config":              404,
+		"/img/.git/":                    404,
+		"/img/photos/.hidden.html":      404,
+		"/img/escape.txt":               404,
+		"/img/relative/secret.txt":      404,
+		"/img/relative/":                404,
+		"/img/ducks/../.env":            404,
+		"/img/%2e%2e/%2e%2e/secret.txt": 404,
+	}
+	for target, code := range tests {
+		w := get(mux, target)
+		//The ServeMux redirects paths with .. in them to the cleaned path;
+		//follow the redirect like a browser would
+		if (w.Code == 301 || w.Code == 307) && code != 301 {
+			w = get(mux, w.Header().Get("Location"))
+		}
+		if w.Code != code {
+			t.Errorf("%s expected %d, got %d", target, code, w.Code)
+		}
+		if strings.Contains(w.Body.String(), "antidote") || strings.Contains(w.Body.String(), "CSRF") {
+			t.Errorf("%s expected not to leak a secret, got %q", target, w.Body.String())
+		}
+	}
+}
+
+func TestTraversal(t *testing.T) {
+	//Without a ServeMux in front to clean the path, the Server gets the
+	//request's path as it was sent
+	s := New(DirFS(publicDir(t)), Options{Hardened: true})
+	targets := []string{
+		"/../secret.txt",
+		"/../../secret.txt",
+		"/ducks/../../secret.txt",
+		"/%2e%2e/secret.txt",
+		"/%2e%2e%2fsecret.txt",
+		"/..%2f..%2fsecret.txt",
+		"/..%5csecret.txt",
+		"/....//secret.txt",
+		"/escape.txt",
+		"/relative/secret.txt",
+		"/relative/public/images/.env",
+		"/sloth.jpg%00.txt",
+		"//etc/passwd",
+	}
+	for _, target := range targets {
+		u, err := url.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		r := httptest.NewRequest("GET", "/", nil)
+		r.URL = u
+		w := httptest.NewRecorder()
+		s.ServeHTTP(w, r)
+		if w.Code != 404 {
+			t.Errorf("%s expected 404, got %d %q", target, w.Code, w.Body.String())
+		}
+	}
+}
+
+//sampleImages is the serve-files sample's public/images directory
+var sampleImages = filepath.Join("..", "..", "go-web-basics", "code-samples", "serve-files", "public", "images")
+
+func TestRanges(t *testing.T) {
+	sloth, err := os.ReadFile(filepath.Join(sampleImages, "sloth.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	size := len(sloth)
+	s := New(DirFS(sampleImages), Options{ETags: true})
+	etag := get(s, "/sloth.jpg").Header().Get("ETag")
+
+	tests := []struct {
+		rangeHeader string
+		first, last int
+	}{
+		{"bytes=0-99", 0, 99},
+		{"bytes=100-", 100, size - 1},
+		{"bytes=-500", size - 500, size - 1},
+		{fmt.Sprintf("bytes=%d-%d", size-10, size+1000), size - 10, size - 1},
+	}
+	for _, test := range tests {
+		w := get(s, "/sloth.jpg", "Range", test.rangeHeader, "If-Range", etag)
+		contentRange := fmt.Sprintf("bytes %d-%d/%d", test.first, test.last, size)
+		if w.Code != 206 || w.Header().Get("Content-Range") != contentRange {
+			t.Errorf("Range %s expected 206 with Content-Range %q, got %d with %q", test.rangeHeader,
+				contentRange, w.Code, w.Header().Get("Content-Range"))
+			continue
+		}
+		if !bytes.Equal(w.Body.Bytes(), sloth[test.first:test.last+1]) {
+			t.Errorf("Range %s expected bytes %d to %d of sloth.jpg", test.rangeHeader, test.first, test.last)
+		}
+	}
+
+	if w := get(s, "/sloth.jpg", "Range", fmt.Sprintf("bytes=%d-", size)); w.Code != 416 {
+		t.Errorf("Range past the end expected 416, got %d", w.Code)
+	}
+	if w := get(s, "/sloth.jpg"); w.Header().Get("Accept-Ranges") != "bytes" {
+		t.Errorf("Response expected Accept-Ranges: bytes, got %q", w.Header().Get("Accept-Ranges"))
+	}
+}
+
+func TestMultipleRanges(t *testing.T) {
+	sloth, err := os.ReadFile(filepath.Join(sampleImages, "sloth.jpg"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := New(DirFS(sampleImages), Options{})
+	w := get(s, "/sloth.jpg", "Range", "bytes=0-9,1000-1999,-20")
+	mediaType, params, err := mime.ParseMediaType(w.Header().Get("Content-Type"))
+	if w.Code != 206 || err != nil || mediaType != "multipart/byteranges" {
+		t.Fatalf("Multiple ranges expected 206 multipart/byteranges, got %d %q",
+			w.Code, w.Header().Get("Content-Type"))
+	}
+
+	expected := [][2]int{{0, 9}, {1000, 1999}, {len(sloth) - 20, len(sloth) - 1}}
+	mr := multipart.NewReader(w.Body, params["boundary"])
+	for i := 0; ; i++ {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			if i != len(expected) {
+				t.Fatalf("Multiple ranges expected %d parts, got %d", len(expected), i)
+			}
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		if i >= len(expected) {
+			t.Fatalf("Multiple ranges expected %d parts, got more", len(expected))
+		}
+		first, last := expected[i][0], expected[i][1]
+		contentRange := fmt.Sprintf("bytes %d-%d/%d", first, last, len(sloth))
+		if part.Header.Get("Content-Range") != contentRange || part.Header.Get("Content-Type") != "image/jpeg" {
+			t.Errorf("Part %d expected image/jpeg with Content-Range %q, got %q with %q", i, contentRange,
+				part.Header.Get("Content-Type"), part.Header.Get("Content-Range"))
+		}
+		b, err := io.ReadAll(part)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(b, sloth[first:last+1]) {
+			t.Errorf("Part %d expected bytes %d to %d of sloth.jpg", i, first, last)
+		}
+	}
+}
+
+func TestIfRange(t *testing.T) {
+	fsys := images()
+	s := New(fsys, Options{ETags: true})
+	etag := get(s, "/sloth.jpg").Header().Get("ETag")
+
+	//Resuming a download of the same version of the file gets the rest
+	if w := get(s, "/sloth.jpg", "Range", "bytes=6-", "If-Range", etag); w.Code != 206 || w.Body.String() != "pixels" {
+		t.Fatalf("If-Range with the current ETag expected 206 \"pixels\", got %d %q", w.Code, w.Body.String())
+	}
+
+	//Resuming after the file changed starts over with the whole new file,
+	//instead of gluing the end of the new one onto the old one
+	fsys["sloth.jpg"] = &fstest.MapFile{Data: []byte("a sloth that moved")}
+	w := get(s, "/sloth.jpg", "Range", "bytes=6-", "If-Range", etag)
+	if w.Code != 200 || w.Body.String() != "a sloth that moved" {
+		t.Fatalf("If-Range with an old ETag expected 200 with the whole file, got %d %q", w.Code, w.Body.String())
+	}
+}
+
+func TestFallback(t *testing.T) {
+	fsys := images()
+	fsys["index.html"] = &fstest.MapFile{Data: []byte("<p>Sloth app</p>")}
+	s := New(fsys, Options{Fallback: "index.html", Hardened: true})
+	browser := "text/html,application/xhtml+xml,application/xml;q=0.9,*/*;q=0.8"
+
+	tests := []struct {
+		target, accept string
+		code           int
+		body           string
+	}{
+		//Browser navigations to the app's routes get the app
+		{"/sloths", browser, 200, "<p>Sloth app</p>"},
+		{"/sloths/3/edit", browser, 200, "<p>Sloth app</p>"},
+		{"/sloths/", browser, 200, "<p>Sloth app</p>"},
+		{"/", browser, 200, "<p>Sloth app</p>"},
+		//Files that exist are still served
+		{"/sloth.jpg", browser, 200, "sloth pixels"},
+		{"/ducks.html", browser, 200, "<p>Beware of ducks!</p>"},
+		{"/photos/", browser, 200, "<p>Photos</p>"},
+		//Missing assets, and requests that aren't navigations, get a 404
+		{"/sloht.jpg", browser, 404, ""},
+		{"/app.js", browser, 404, ""},
+		{"/sloths", "*/*", 404, ""},
+		{"/sloths", "application/json", 404, ""},
+		{"/sloths", "text/html;q=0", 404, ""},
+		{"/sloths", "", 404, ""},
+		{"/.env", browser, 404, ""},
+	}
+	for _, test := range tests {
+		w := get(s, test.target, "Accept", test.accept)
+		if w.Code != test.code || test.body != "" && w.Body.String() != test.body {
+			t.Errorf("%s with Accept %q expected %d %q, got %d %q", test.target, test.accept,
+				test.code, test.body, w.Code, w.Body.String())
+		}
+	}
+
+	if vary := get(s, "/sloths", "Accept", browser).Header().Get("Vary"); vary != "Accept" {
+		t.Errorf("Fallback page expected Vary: Accept, got %q", vary)
+	}
+	r := httptest.NewRequest("POST", "/sloths", nil)
+	r.Header.Set("Accept", browser)
+	w := httptest.NewRecorder()
+	s.ServeHTTP(w, r)
+	if w.Code != 404 {
+		t.Errorf("POST to a missing path expected 404, got %d", w.Code)
+	}
+}
@@ -0,0 +1,74 @@
+//Package static serves static files out of an fs.FS, so a sample's pages
+//and images can be compiled into its binary with embed and still be
+//served from the live directory while they're being edited.
+package static
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"runtime"
+	"strings"
+)
+
+//Dir returns the directory dir in embedded, or with dev set, the directory
+//dir on disk, relative to the working directory. Edits to files on disk
+//show up right away; the embedded ones are the files as they were when the
+//binary was built, but are served the same wherever it's run from.
+func Dir(embedded fs.FS, dir string, dev bool) (fs.FS, error) {
+	if dev {
+		if _, err := os.Stat(dir); err != nil {
+			return nil, err
+		}
+		return DirFS(dir), nil
+	}
+	return fs.Sub(embedded, dir)
+}
+
+//DirFS is a directory on disk as an fs.FS, like os.DirFS, except that it
+//won't open a file through a symlink that leads out of the directory. A
+//symlink to somewhere else in the directory is followed like normal.
+type DirFS string
+
+func (dir DirFS) Open(name string) (fs.File, error) {
+	if !fs.ValidPath(name) || runtime.GOOS == "windows" && strings.ContainsAny(name, `\:`) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrInvalid}
+	}
+	root, err := filepath.EvalSymlinks(string(dir))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: err}
+	}
+	resolved, err := filepath.EvalSymlinks(filepath.Join(root, filepath.FromSlash(name)))
+	if err != nil {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	//A file outside the directory is reported as not existing, so
+	//responses don't tell clients anything about what's out there
+	if rel, err := filepath.Rel(root, resolved); err != nil || rel == ".." ||
+		strings.HasPrefix(rel, ".."+string(filepath.Separator)) {
+		return nil, &fs.PathError{Op: "open", Path: name, Err: fs.ErrNotExist}
+	}
+	return os.Open(resolved)
+}
+
+//Overlay returns a file system with the files in upper on top of the ones
+//in lower: a name is opened in upper, or in lower if it isn't there. It's
+//for serving files uploaded to a directory on disk along with embedded
+//ones. A directory is opened in just one of them, so its listing only has
+//the files in that one.
+func Overlay(upper, lower fs.FS) fs.FS {
+	return overlay{upper, lower}
+}
+
+type overlay struct {
+	upper, lower fs.FS
+}
+
+func (o overlay) Open(name string) (fs.File, error) {
+	f, err := o.upper.Open(name)
+	if err == nil || !errors.Is(err, fs.ErrNotExist) {
+		return f, err
+	}
+	return o.lower.Open(name)
+}
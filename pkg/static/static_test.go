@@ -0,0 +1,76 @@
+package static
+
+import (
+	"errors"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"testing"
+	"testing/fstest"
+)
+
+func TestDir(t *testing.T) {
+	embedded := fstest.MapFS{"public/images/sloth.jpg": {Data: []byte("embedded sloth")}}
+
+	dir := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(dir, "public/images"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "public/images/sloth.jpg"), []byte("live sloth"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	defer os.Chdir(wd)
+
+	for dev, expected := range map[bool]string{false: "embedded sloth", true: "live sloth"} {
+		fsys, err := Dir(embedded, "public/images", dev)
+		if err != nil {
+			t.Fatal(err)
+		}
+		b, err := fs.ReadFile(fsys, "sloth.jpg")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(b) != expected {
+			t.Errorf("Dir with dev %v expected %q, got %q", dev, expected, b)
+		}
+	}
+
+	if _, err := Dir(embedded, "public/sounds", true); err == nil {
+		t.Error("Dir in dev mode expected an error for a directory that isn't on disk")
+	}
+}
+
+func TestDirFS(t *testing.T) {
+	fsys := DirFS(publicDir(t))
+	if b, err := fs.ReadFile(fsys, "sloth.png"); err != nil || string(b) != "sloth pixels" {
+		t.Fatalf("Symlink inside the directory expected to be followed, got %q, %v", b, err)
+	}
+	for _, name := range []string{"escape.txt", "relative/secret.txt", "../secret.txt", "/etc/passwd"} {
+		if _, err := fsys.Open(name); err == nil {
+			t.Errorf("Opening %s expected an error", name)
+		}
+	}
+}
+
+func TestOverlay(t *testing.T) {
+	upper := fstest.MapFS{"sloth.jpg": {Data: []byte("uploaded sloth")}, "new.png": {Data: []byte("new")}}
+	lower := fstest.MapFS{"sloth.jpg": {Data: []byte("embedded sloth")}, "duck.jpg": {Data: []byte("duck")}}
+	fsys := Overlay(upper, lower)
+
+	tests := map[string]string{"sloth.jpg": "uploaded sloth", "new.png": "new", "duck.jpg": "duck"}
+	for name, expected := range tests {
+		if b, err := fs.ReadFile(fsys, name); err != nil || string(b) != expected {
+			t.Errorf("%s expected %q, got %q, %v", name, expected, b, err)
+		}
+	}
+	if _, err := fsys.Open("hippo.jpg"); !errors.Is(err, fs.ErrNotExist) {
+		t.Errorf("File in neither expected fs.ErrNotExist, got %v", err)
+	}
+}
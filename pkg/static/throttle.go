@@ -0,0 +1,104 @@
+package static
+
+import (
+	"net/http"
+	"sync"
+	"time"
+)
+
+//A limiter paces the bytes sent to one connection to Options.Throttle
+//bytes per second
+type limiter struct {
+	rate int64
+
+	mu   sync.Mutex
+	next time.Time
+	refs int
+}
+
+//chunk is how many bytes are written at a time, a tenth of a second's
+//worth so the pace is smooth, between 512 bytes and 32KB
+func (l *limiter) chunk() int {
+	return int(min(max(l.rate/10, 512), 32<<10))
+}
+
+//wait waits until n more bytes can be sent. The first bytes a connection
+//sends go right away; after that, sending n bytes pushes back when the
+//next ones can go by n/rate seconds.
+func (l *limiter) wait(r *http.Request, n int) error {
+	l.mu.Lock()
+	now := time.Now()
+	if l.next.Before(now) {
+		l.next = now
+	}
+	delay := l.next.Sub(now)
+	l.next = l.next.Add(time.Duration(int64(n) * int64(time.Second) / l.rate))
+	l.mu.Unlock()
+
+	if delay <= 0 {
+		return nil
+	}
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+		return nil
+	case <-r.Context().Done():
+		return r.Context().Err()
+	}
+}
+
+//limiter returns the limiter for the connection from addr, a request's
+//RemoteAddr. The client's port is part of it, so each connection gets its
+//own limiter, shared by the requests on that connection.
+func (s *Server) limiter(addr string) *limiter {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	l, ok := s.conns[addr]
+	if !ok {
+		l = &limiter{rate: s.opts.Throttle}
+		s.conns[addr] = l
+	}
+	l.refs++
+	return l
+}
+
+//release forgets the limiter for addr once no request is using it
+func (s *Server) release(addr string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if l := s.conns[addr]; l != nil {
+		if l.refs--; l.refs == 0 {
+			delete(s.conns, addr)
+		}
+	}
+}
+
+//A throttledWriter writes a response's body at its limiter's pace
+type throttledWriter struct {
+	http.ResponseWriter
+	limiter *limiter
+	r       *http.Request
+}
+
+func (w *throttledWriter) Write(p []byte) (int, error) {
+	written := 0
+	for len(p) > 0 {
+		n := min(len(p), w.limiter.chunk())
+		if err := w.limiter.wait(w.r, n); err != nil {
+			return written, err
+		}
+		n, err := w.ResponseWriter.Write(p[:n])
+		written += n
+		if err != nil {
+			return written, err
+		}
+		p = p[n:]
+	}
+	return written, nil
+}
+
+//Unwrap returns the ResponseWriter w wraps, for http.ResponseController
+func (w *throttledWriter) Unwrap() http.ResponseWriter {
+	return w.ResponseWriter
+}
@@ -0,0 +1,72 @@
+package static
+
+import (
+	"context"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+//throttled serves a 50KB file at 100KB per second
+func throttled() *Server {
+	return New(fstest.MapFS{"sloth.mp4": {Data: make([]byte, 50<<10)}}, Options{Throttle: 100 << 10})
+}
+
+func TestThrottle(t *testing.T) {
+	s := throttled()
+	start := time.Now()
+	w := get(s, "/sloth.mp4")
+	elapsed := time.Since(start)
+
+	//The first tenth of a second's worth goes right away, and the other
+	//40KB take 0.4 seconds
+	if w.Code != 200 || w.Body.Len() != 50<<10 {
+		t.Fatalf("Throttled file expected 200 with all 50KB, got %d with %d bytes", w.Code, w.Body.Len())
+	}
+	if elapsed < 350*time.Millisecond {
+		t.Fatalf("50KB at 100KB/s expected to take about 0.4s, took %v", elapsed)
+	}
+	if len(s.conns) != 0 {
+		t.Fatalf("Throttled Server expected to forget finished connections, has %d", len(s.conns))
+	}
+}
+
+func TestThrottleSharedByConnection(t *testing.T) {
+	s := throttled()
+	start := time.Now()
+	var wg sync.WaitGroup
+	for i := 0; i < 2; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			r := httptest.NewRequest("GET", "/sloth.mp4", nil)
+			r.Header.Set("Range", "bytes=0-25599")
+			s.ServeHTTP(httptest.NewRecorder(), r)
+		}()
+	}
+	wg.Wait()
+
+	//Both requests come from httptest's RemoteAddr, so they share 100KB/s
+	//for their 50KB
+	if elapsed := time.Since(start); elapsed < 350*time.Millisecond {
+		t.Fatalf("Two 25KB requests on one connection expected to take about 0.4s, took %v", elapsed)
+	}
+}
+
+func TestThrottleStopsWhenClientLeaves(t *testing.T) {
+	s := throttled()
+	r := httptest.NewRequest("GET", "/sloth.mp4", nil)
+	ctx, cancel := context.WithTimeout(r.Context(), 50*time.Millisecond)
+	defer cancel()
+	w := httptest.NewRecorder()
+	start := time.Now()
+	s.ServeHTTP(w, r.WithContext(ctx))
+	if elapsed := time.Since(start); elapsed > 300*time.Millisecond {
+		t.Fatalf("Throttled response expected to stop soon after the client left, took %v", elapsed)
+	}
+	if w.Body.Len() >= 50<<10 {
+		t.Fatal("Throttled response expected to stop before the whole file was sent")
+	}
+}
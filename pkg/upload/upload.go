@@ -0,0 +1,325 @@
+//Package upload stores files uploaded in multipart forms in a directory,
+//like the serve-files sample's public/images, so its file server serves
+//them as soon as they're uploaded.
+package upload
+
+import (
+	"bytes"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/content"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/form"
+)
+
+//Defaults for the Options
+const (
+	DefaultMaxFileBytes = 10 << 20
+	DefaultMaxFiles     = 10
+	DefaultField        = "file"
+)
+
+//ImageTypes are the content types an Uploader takes by default, mapped to
+//the extensions files of each type are saved with. They're the formats
+//the standard library can decode, so pkg/imgproc can resize every image
+//that's uploaded.
+var ImageTypes = map[string]string{
+	"image/jpeg": ".jpg",
+	"image/png":  ".png",
+	"image/gif":  ".gif",
+}
+
+//Options configure an Uploader
+type Options struct {
+	//MaxFileBytes limits the size of each file. It defaults to
+	//DefaultMaxFileBytes.
+	MaxFileBytes int64
+	//MaxFiles limits how many files one request can upload. It defaults to
+	//DefaultMaxFiles.
+	MaxFiles int
+	//Types maps the content types files can be to the extensions they're
+	//saved with. A file's type is sniffed from its contents with
+	//http.DetectContentType; the type and name the client sent aren't
+	//trusted. It defaults to ImageTypes.
+	Types map[string]string
+	//Field is the name of the form field files are uploaded in. It defaults
+	//to DefaultField.
+	Field string
+}
+
+//An Uploader stores uploaded files in a directory
+type Uploader struct {
+	dir  string
+	opts Options
+}
+
+//New makes an Uploader storing files in dir
+func New(dir string, opts Options) *Uploader {
+	if opts.MaxFileBytes <= 0 {
+		opts.MaxFileBytes = DefaultMaxFileBytes
+	}
+	if opts.MaxFiles <= 0 {
+		opts.MaxFiles = DefaultMaxFiles
+	}
+	if opts.Types == nil {
+		opts.Types = ImageTypes
+	}
+	if opts.Field == "" {
+		opts.Field = DefaultField
+	}
+	return &Uploader{dir: dir, opts: opts}
+}
+
+//A File is a stored upload, listed in the JSON response to an upload
+type File struct {
+	//Name is the name the file is stored with in the Uploader's directory
+	Name string `json:"name"`
+	//URL is Name relative to the route the upload was posted to
+	URL  string `json:"url"`
+	Type string `json:"type"`
+	Size int64  `json:"size"`
+}
+
+//Uploaded is the JSON response to an upload
+type Uploaded struct {
+	Files []File `json:"files"`
+}
+
+//An ErrorResponse is the JSON response to an upload that can't be stored
+type ErrorResponse struct {
+	Error string `json:"error"`
+}
+
+//errors the upload is turned away with, with the status they get
+var (
+	errNotMultipart = statusError{http.StatusBadRequest, "the upload has to be a multipart/form-data form"}
+	errNoFiles      = statusError{http.StatusBadRequest, "the form has no files in it"}
+	errTooMany      = statusError{http.StatusBadRequest, "the form has too many files in it"}
+	errTooLarge     = statusError{http.StatusRequestEntityTooLarge, "the upload is too large"}
+)
+
+type statusError struct {
+	status int
+	msg    string
+}
+
+func (err statusError) Error() string {
+	return err.msg
+}
+
+//Upload stores the files in r's multipart form and responds with a 201
+//Created listing them. The files are streamed straight to disk. If any of
+//them can't be stored, none of them are, and the response says why: a 413
+//for a file that's too large, a 415 for a type that isn't allowed, or a
+//400 for a form without files.
+func (u *Uploader) Upload(w http.ResponseWriter, r *http.Request) {
+	//Limit the whole body too, so a form can't go on forever with fields
+	//that aren't files
+	r.Body = http.MaxBytesReader(w, r.Body, u.opts.MaxFileBytes*int64(u.opts.MaxFiles)+form.MaxBodyBytes)
+
+	files, err := u.store(r)
+	if err != nil {
+		status := http.StatusInternalServerError
+		msg := http.StatusText(status)
+		var serr statusError
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &serr) {
+			status, msg = serr.status, serr.msg
+		} else if errors.As(err, &maxErr) {
+			status, msg = errTooLarge.status, errTooLarge.msg
+		}
+		content.Respond(w, r, status,
+			content.JSON(ErrorResponse{Error: msg}),
+			content.Text("%d %s: %s", status, http.StatusText(status), msg))
+		return
+	}
+
+	if len(files) == 1 {
+		w.Header().Set("Location", path.Join(r.URL.Path, files[0].URL))
+	}
+	lines := make([]string, len(files))
+	for i, f := range files {
+		lines[i] = f.URL
+	}
+	content.Respond(w, r, http.StatusCreated,
+		content.JSON(Uploaded{Files: files}),
+		content.Text("%s", strings.Join(lines, "\n")))
+}
+
+//store stores the files in r's form, removing the ones it stored if it
+//can't store them all
+func (u *Uploader) store(r *http.Request) (files []File, err error) {
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return nil, errNotMultipart
+	}
+	defer func() {
+		if err != nil {
+			for _, f := range files {
+				os.Remove(filepath.Join(u.dir, f.Name))
+			}
+			files = nil
+		}
+	}()
+
+	if err := os.MkdirAll(u.dir, 0755); err != nil {
+		return nil, err
+	}
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			break
+		}
+		var maxErr *http.MaxBytesError
+		if errors.As(err, &maxErr) {
+			return files, errTooLarge
+		}
+		if err != nil {
+			return files, errNotMultipart
+		}
+		if part.FormName() != u.opts.Field || part.FileName() == "" {
+			part.Close()
+			continue
+		}
+		if len(files) == u.opts.MaxFiles {
+			return files, errTooMany
+		}
+		f, err := u.storeFile(part, part.FileName())
+		part.Close()
+		if err != nil {
+			return files, err
+		}
+		files = append(files, f)
+	}
+	if len(files) == 0 {
+		return nil, errNoFiles
+	}
+	return files, nil
+}
+
+//storeFile streams one file to a hidden temporary file in the directory,
+//then gives it its name once it's all there, so the file server never
+//serves half an upload
+func (u *Uploader) storeFile(r io.Reader, clientName string) (File, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(r, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return File{}, err
+	}
+	head = head[:n]
+	ctype, _, _ := mime.ParseMediaType(http.DetectContentType(head))
+	ext, ok := u.opts.Types[ctype]
+	if !ok || n == 0 {
+		return File{}, statusError{http.StatusUnsupportedMediaType,
+			fmt.Sprintf("%s is %s, which can't be uploaded", clientName, ctype)}
+	}
+
+	tmp, err := os.CreateTemp(u.dir, ".upload-*")
+	if err != nil {
+		return File{}, err
+	}
+	defer os.Remove(tmp.Name())
+
+	//Read one byte past the limit to tell a file that's exactly the limit
+	//from one that's over it
+	rest := io.LimitReader(r, u.opts.MaxFileBytes-int64(n)+1)
+	written, err := io.Copy(tmp, io.MultiReader(bytes.NewReader(head), rest))
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return File{}, err
+	}
+	if written > u.opts.MaxFileBytes {
+		return File{}, statusError{http.StatusRequestEntityTooLarge,
+			fmt.Sprintf("%s is larger than %d bytes", clientName, u.opts.MaxFileBytes)}
+	}
+
+	name, err := u.link(tmp.Name(), slug(clientName), ext)
+	if err != nil {
+		return File{}, err
+	}
+	return File{Name: name, URL: name, Type: ctype, Size: written}, nil
+}
+
+//link gives the temporary file tmp a name made from base, a random
+//suffix and ext. os.Link fails instead of replacing a file that's already
+//there, so two uploads can't end up with the same name.
+func (u *Uploader) link(tmp, base, ext string) (string, error) {
+	for i := 0; i < 10; i++ {
+		suffix := make([]byte, 4)
+		if _, err := rand.Read(suffix); err != nil {
+			return "", err
+		}
+		name := base + "-" + hex.EncodeToString(suffix) + ext
+		err := os.Link(tmp, filepath.Join(u.dir, name))
+		if err == nil {
+			return name, nil
+		}
+		if !errors.Is(err, os.ErrExist) {
+			return "", err
+		}
+	}
+	return "", errors.New("upload: couldn't find a free name")
+}
+
+//slug makes a safe file name out of the name a client gave a file: its
+//base name without its extension, in lower case, with anything but
+//letters and digits turned into dashes
+func slug(clientName string) string {
+	//Browsers send just the base name, but some clients send a Windows
+	//path
+	base := clientName[strings.LastIndexAny(clientName, `/\`)+1:]
+	base = strings.TrimSuffix(base, path.Ext(base))
+
+	var b strings.Builder
+	dash := false
+	for _, c := range strings.ToLower(base) {
+		if c >= 'a' && c <= 'z' || c >= '0' && c <= '9' {
+			b.WriteRune(c)
+			dash = false
+		} else if !dash && b.Len() > 0 {
+			b.WriteByte('-')
+			dash = true
+		}
+		if b.Len() >= 40 {
+			break
+		}
+	}
+	s := strings.Trim(b.String(), "-")
+	if s == "" {
+		return "upload"
+	}
+	return s
+}
+
+//Delete deletes the uploaded file name, responding with a 204 No Content,
+//or a 404 if there's no such file. Only files directly in the Uploader's
+//directory can be deleted, and not hidden ones.
+func (u *Uploader) Delete(w http.ResponseWriter, r *http.Request, name string) {
+	if name == "" || name != filepath.Base(name) || strings.HasPrefix(name, ".") ||
+		strings.ContainsAny(name, `/\`) {
+		http.NotFound(w, r)
+		return
+	}
+	p := filepath.Join(u.dir, name)
+	info, err := os.Lstat(p)
+	if err != nil || !info.Mode().IsRegular() {
+		http.NotFound(w, r)
+		return
+	}
+	if err := os.Remove(p); err != nil {
+		http.Error(w, "500 Internal Server Error", http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,202 @@
+package upload
+
+import (
+	"bytes"
+	"encoding/json"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+var (
+	pngData  = append([]byte("\x89PNG\r\n\x1a\n"), bytes.Repeat([]byte("sloth"), 100)...)
+	jpegData = append([]byte("\xff\xd8\xff\xe0"), bytes.Repeat([]byte("duck"), 100)...)
+)
+
+type upload struct {
+	field, name string
+	data        []byte
+}
+
+func post(h http.HandlerFunc, uploads ...upload) *httptest.ResponseRecorder {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	mw.WriteField("caption", "Stay slothful!")
+	for _, u := range uploads {
+		fw, _ := mw.CreateFormFile(u.field, u.name)
+		fw.Write(u.data)
+	}
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/img/", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	r.Header.Set("Accept", "application/json")
+	w := httptest.NewRecorder()
+	h(w, r)
+	return w
+}
+
+//files lists the files in dir, including hidden ones
+func files(t *testing.T, dir string) []string {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	names := make([]string, len(entries))
+	for i, e := range entries {
+		names[i] = e.Name()
+	}
+	return names
+}
+
+func TestUpload(t *testing.T) {
+	dir := t.TempDir()
+	u := New(dir, Options{})
+	w := post(u.Upload, upload{"file", "My Sloth!.PNG", pngData}, upload{"file", `C:\photos\duck.jpeg`, jpegData})
+	if w.Code != 201 {
+		t.Fatalf("Upload expected 201, got %d %q", w.Code, w.Body.String())
+	}
+	var uploaded Uploaded
+	if err := json.Unmarshal(w.Body.Bytes(), &uploaded); err != nil {
+		t.Fatal(err)
+	}
+	if len(uploaded.Files) != 2 {
+		t.Fatalf("Upload expected 2 files, got %+v", uploaded)
+	}
+
+	expected := []struct {
+		prefix, ext, ctype string
+		data               []byte
+	}{
+		{"my-sloth-", ".png", "image/png", pngData},
+		{"duck-", ".jpg", "image/jpeg", jpegData},
+	}
+	for i, f := range uploaded.Files {
+		e := expected[i]
+		if !strings.HasPrefix(f.Name, e.prefix) || !strings.HasSuffix(f.Name, e.ext) ||
+			f.Type != e.ctype || f.Size != int64(len(e.data)) {
+			t.Errorf("File %d expected %s...%s, %s, %d bytes, got %+v", i, e.prefix, e.ext, e.ctype, len(e.data), f)
+		}
+		b, err := os.ReadFile(filepath.Join(dir, f.Name))
+		if err != nil || !bytes.Equal(b, e.data) {
+			t.Errorf("File %d expected to be stored as %s, got %v", i, f.Name, err)
+		}
+	}
+	if len(files(t, dir)) != 2 {
+		t.Fatalf("Upload expected to leave just the 2 files, got %v", files(t, dir))
+	}
+}
+
+func TestUniqueNames(t *testing.T) {
+	dir := t.TempDir()
+	u := New(dir, Options{})
+	seen := make(map[string]bool)
+	for i := 0; i < 20; i++ {
+		w := post(u.Upload, upload{"file", "sloth.png", pngData})
+		loc := w.Header().Get("Location")
+		if w.Code != 201 || !strings.HasPrefix(loc, "/img/sloth-") || seen[loc] {
+			t.Fatalf("Upload %d expected 201 at a new /img/sloth-*.png, got %d at %q", i, w.Code, loc)
+		}
+		seen[loc] = true
+	}
+	if len(files(t, dir)) != 20 {
+		t.Fatalf("20 uploads of sloth.png expected 20 files, got %d", len(files(t, dir)))
+	}
+}
+
+func TestRejectedUploads(t *testing.T) {
+	dir := t.TempDir()
+	u := New(dir, Options{MaxFileBytes: 300, MaxFiles: 2})
+	small := pngData[:200]
+	tests := map[string]struct {
+		uploads []upload
+		code    int
+	}{
+		"a file over the limit":      {[]upload{{"file", "sloth.png", pngData}}, 413},
+		"HTML named like an image":   {[]upload{{"file", "sloth.png", []byte("<html><script>alert(1)</script>")}}, 415},
+		"an empty file":              {[]upload{{"file", "sloth.png", nil}}, 415},
+		"a WebP image":               {[]upload{{"file", "sloth.webp", []byte("RIFF\x24\x00\x00\x00WEBPVP8 ")}}, 415},
+		"no files":                   {nil, 400},
+		"a file in another field":    {[]upload{{"picture", "sloth.png", small}}, 400},
+		"too many files":             {[]upload{{"file", "a.png", small}, {"file", "b.png", small}, {"file", "c.png", small}}, 400},
+		"a good file then a bad one": {[]upload{{"file", "a.png", small}, {"file", "b.gif", []byte("GIF? nope")}}, 415},
+	}
+	for name, test := range tests {
+		if w := post(u.Upload, test.uploads...); w.Code != test.code {
+			t.Errorf("Upload with %s expected %d, got %d %q", name, test.code, w.Code, w.Body.String())
+		}
+	}
+	if names := files(t, dir); len(names) != 0 {
+		t.Fatalf("Rejected uploads expected to leave no files behind, got %v", names)
+	}
+
+	r := httptest.NewRequest("POST", "/img/", strings.NewReader(`{"file": "sloth.png"}`))
+	r.Header.Set("Content-Type", "application/json")
+	w := httptest.NewRecorder()
+	u.Upload(w, r)
+	if w.Code != 400 {
+		t.Fatalf("JSON upload expected 400, got %d", w.Code)
+	}
+}
+
+func TestDelete(t *testing.T) {
+	dir := t.TempDir()
+	outside := filepath.Join(t.TempDir(), "secret.png")
+	os.WriteFile(outside, pngData, 0644)
+	os.WriteFile(filepath.Join(dir, "sloth.png"), pngData, 0644)
+	os.WriteFile(filepath.Join(dir, ".env"), []byte("secret"), 0644)
+	os.Mkdir(filepath.Join(dir, "ducks"), 0755)
+	os.Symlink(outside, filepath.Join(dir, "link.png"))
+
+	u := New(dir, Options{})
+	del := func(name string) int {
+		w := httptest.NewRecorder()
+		u.Delete(w, httptest.NewRequest("DELETE", "/img/"+name, nil), name)
+		return w.Code
+	}
+	tests := map[string]int{
+		"../secret.png": 404,
+		".env":          404,
+		"ducks":         404,
+		"hippo.png":     404,
+		"":              404,
+		"link.png":      404,
+		"sloth.png":     204,
+	}
+	for name, code := range tests {
+		if got := del(name); got != code {
+			t.Errorf("Deleting %q expected %d, got %d", name, code, got)
+		}
+	}
+	if _, err := os.Stat(filepath.Join(dir, "sloth.png")); !os.IsNotExist(err) {
+		t.Error("Deleted sloth.png expected to be gone")
+	}
+	if _, err := os.Stat(outside); err != nil {
+		t.Error("File outside the directory expected to still be there")
+	}
+	if got := del("sloth.png"); got != 404 {
+		t.Errorf("Deleting sloth.png twice expected 404, got %d", got)
+	}
+}
+
+func TestSlug(t *testing.T) {
+	tests := map[string]string{
+		"sloth.jpg":              "sloth",
+		"My Sloth!.PNG":          "my-sloth",
+		"../../etc/passwd":       "passwd",
+		`C:\photos\duck.jpeg`:    "duck",
+		".htaccess":              "upload",
+		"---.png":                "upload",
+		"スロース.png":               "upload",
+		strings.Repeat("a", 100): strings.Repeat("a", 40),
+	}
+	for name, expected := range tests {
+		if got := slug(name); got != expected {
+			t.Errorf("slug(%q) expected %q, got %q", name, expected, got)
+		}
+	}
+}
@@ -1,10 +1,16 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
 	"regexp"
 
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/gojimw"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/routes"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
 	"github.com/zenazn/goji/web"
 	"github.com/zenazn/goji/web/middleware"
 )
@@ -20,9 +26,17 @@ func serveHitNumber(c web.C, w http.ResponseWriter, r *http.Request) {
 }
 
 func main() {
-	//Initialize the router with the EnvInit middleware
-	m := web.New()
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	printRoutes := routes.RegisterFlag(flag.CommandLine)
+	flag.Parse()
+
+	//Initialize the router with the EnvInit middleware, then give every
+	//request an ID, available to Goji handlers in c.Env. The router records
+	//its routes in reg, so we can see which ones come first.
+	reg := routes.New()
+	m := reg.Goji(web.New())
 	m.Use(middleware.EnvInit)
+	m.Use(gojimw.RequestID)
 
 	//Make a plain path
 	m.Handle("/sloths", func(w http.ResponseWriter, r *http.Request) {
@@ -50,6 +64,10 @@ func main() {
 		fmt.Fprintf(w, "Lemurs = sloths that had too much coffee")
 	})
 
+	//Lists the routes; it has to come before the catch-all route, which
+	//would match it first
+	m.Get("/debug/routes", reg.Handler())
+
 	m.Handle("/", youreNo1000000)
 
 	//Catch-all route
@@ -57,9 +75,26 @@ func main() {
 		fmt.Fprintf(w, "This route matches all requests.")
 	})
 
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: m,
+	//Warn about routes that other routes take some requests from, and stop
+	//on routes that can't be reached at all
+	checkErr := reg.Check(nil)
+
+	//With -routes, print the routes instead of serving them
+	if *printRoutes {
+		if err := reg.WriteTable(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if checkErr != nil {
+		log.Fatal(checkErr)
+	}
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
+	if err := config.Runner(m).Run(); err != nil {
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
@@ -1,23 +1,41 @@
 package main
 
 import (
+	"flag"
 	"fmt"
+	"log"
 	"net/http"
+	"os"
+	"path/filepath"
 
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/imgproc"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/routes"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/static"
 	"github.com/gorilla/mux"
 )
 
 func main() {
+	configFlags := serve.RegisterFlags(flag.CommandLine)
+	printRoutes := routes.RegisterFlag(flag.CommandLine)
+	flag.Parse()
+
 	m := mux.NewRouter()
+	reg := routes.New()
 
 	//Plain router have the same syntax as in net/http
 	m.HandleFunc("/sloths", func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "Sloths rule!")
 	})
 
-	//Use Router.PathPrefix for matching routes with prefixes
-	m.PathPrefix("/img/").Handler(
-		http.StripPrefix("/img/", http.FileServer(http.Dir("public/images"))))
+	//Use Router.PathPrefix for matching routes with prefixes. The images
+	//can be resized and converted with query parameters in their URLs, like
+	//sloth.jpg?w=200&h=200&fit=cover&fmt=png
+	resizer := imgproc.New(static.DirFS("public/images"), imgproc.Options{
+		CacheDir: filepath.Join(os.TempDir(), "mean-gopher-images"),
+	})
+	m.PathPrefix("/img/").Handler(http.StripPrefix("/img/",
+		resizer.Middleware(http.FileServer(http.Dir("public/images")))))
 
 	//Gorilla mux routes can take in route parameters with curly braces
 	m.HandleFunc("/{flavor}/tea", func(w http.ResponseWriter, r *http.Request) {
@@ -26,22 +44,49 @@ func main() {
 	})
 
 	//Regular expression routes in Gorilla mux are a slight variation on
-	//route parameters.
-	m.HandleFunc(`/{drink:(coffee)+}`,
+	//route parameters. Groups have to be non-capturing.
+	m.HandleFunc(`/{drink:(?:coffee)+}`,
 		func(w http.ResponseWriter, r *http.Request) {
 			fmt.Fprintf(w, "Lemurs = sloths that had too much coffee")
 		})
 
+	//Lists the routes; it has to come before the catch-all route, which
+	//would match it first
+	m.Handle("/debug/routes", reg.Handler()).Methods("GET")
+
 	//Router.PathPrefix("/") creates a catch-all route
 	m.PathPrefix("/").HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		fmt.Fprintf(w, "This route matches all requests.")
 	})
 
+	//Record the routes once they're all registered, since a Gorilla route's
+	//methods are set after the route is added
+	if err := reg.Gorilla(m); err != nil {
+		log.Fatal(err)
+	}
+
+	//Warn about routes that other routes take some requests from, and stop
+	//on routes that can't be reached at all
+	checkErr := reg.Check(nil)
+
+	//With -routes, print the routes instead of serving them
+	if *printRoutes {
+		if err := reg.WriteTable(os.Stdout); err != nil {
+			log.Fatal(err)
+		}
+		return
+	}
+	if checkErr != nil {
+		log.Fatal(checkErr)
+	}
+
+	config, err := configFlags.Load()
+	if err != nil {
+		log.Fatal(err)
+	}
 	//A Gorilla mux Router is a Handler so we can use it as our Server's
 	//main Handler.
-	server := &http.Server{
-		Addr:    ":1123",
-		Handler: m,
+	if err := config.Runner(m).Run(); err != nil {
+		log.Fatal(err)
 	}
-	server.ListenAndServe()
 }
@@ -1,6 +1,11 @@
 package main
 
-import "net/http"
+import (
+	"log"
+	"net/http"
+
+	"github.com/AndyHaskell/MEAN-Gopher/pkg/serve"
+)
 
 //HelloWorld as a global Handler
 var HelloWorld = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
@@ -21,9 +26,7 @@ func InitRouter() *http.ServeMux {
 
 func main() {
 	mux := InitRouter()
-	svr := &http.Server{
-		Addr:    ":1123",
-		Handler: mux,
+	if err := serve.ListenAndServe(mux); err != nil {
+		log.Fatal(err)
 	}
-	svr.ListenAndServe()
 }